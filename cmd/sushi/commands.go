@@ -0,0 +1,148 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/devenjarvis/sushi/internal/shell"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/sys/unix"
+)
+
+// commandsMsg carries the names of the commands that can be run, found
+// again because PATH or one of its directories changed.
+type commandsMsg struct {
+	commands []string
+}
+
+// rescanInterval is how often PATH is scanned again while waiting for
+// input, for commands installed from elsewhere, such as another terminal.
+// Only the directories that were modified are read again.
+const rescanInterval = 5 * time.Second
+
+// rescanMsg is sent when it's time to scan PATH again.
+type rescanMsg struct{}
+
+// tickRescan returns a command that sends a rescanMsg once rescanInterval
+// is over.
+func tickRescan() tea.Cmd {
+	return tea.Tick(rescanInterval, func(time.Time) tea.Msg {
+		return rescanMsg{}
+	})
+}
+
+// pathScanner finds the commands in the directories of PATH. What's in a
+// directory is remembered until it's modified, so scanning again after a
+// command only reads the directories that changed.
+type pathScanner struct {
+	mu       sync.Mutex
+	dirs     map[string]scannedDir
+	commands []string
+}
+
+// scannedDir is what a directory held when it was last read.
+type scannedDir struct {
+	modTime time.Time
+	names   []string
+}
+
+func newPathScanner() *pathScanner {
+	return &pathScanner{dirs: make(map[string]scannedDir)}
+}
+
+// scan returns the builtins and the commands in path, with relative
+// directories in it taken from dir, and whether they changed since the
+// last scan.
+func (s *pathScanner) scan(path, dir string) ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	commands := shell.Builtins()
+	seen := make(map[string]bool)
+	dirs := make(map[string]scannedDir)
+	for _, entry := range filepath.SplitList(path) {
+		if !filepath.IsAbs(entry) {
+			entry = filepath.Join(dir, entry)
+		}
+		scanned, ok := dirs[entry]
+		if !ok {
+			scanned = s.scanDir(entry)
+			dirs[entry] = scanned
+		}
+		for _, name := range scanned.names {
+			if !seen[name] {
+				seen[name] = true
+				commands = append(commands, name)
+			}
+		}
+	}
+	// Directories no longer in PATH are forgotten
+	s.dirs = dirs
+
+	if slices.Equal(commands, s.commands) {
+		return commands, false
+	}
+	s.commands = commands
+	return commands, true
+}
+
+// cached returns the commands found by the last scan, or nil before the
+// first.
+func (s *pathScanner) cached() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commands
+}
+
+// scanDir returns the executables in a directory, reading it only if it
+// was modified since it was last read. Subdirectories aren't searched, as
+// commands in them can't be run by name.
+func (s *pathScanner) scanDir(dir string) scannedDir {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return scannedDir{}
+	}
+	if scanned, ok := s.dirs[dir]; ok && scanned.modTime.Equal(info.ModTime()) {
+		return scanned
+	}
+
+	scanned := scannedDir{modTime: info.ModTime()}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return scannedDir{}
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		// Links to directories are skipped too, and broken ones
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				continue
+			}
+		}
+		// Access checks the user can run the file
+		if unix.Access(path, unix.X_OK) == nil {
+			scanned.names = append(scanned.names, entry.Name())
+		}
+	}
+	return scanned
+}
+
+// rescan returns a command that scans PATH in the background, and sends a
+// commandsMsg if the commands found changed.
+func (s *pathScanner) rescan(path, dir string) tea.Cmd {
+	return func() tea.Msg {
+		commands, changed := s.scan(path, dir)
+		if !changed {
+			return nil
+		}
+		return commandsMsg{commands}
+	}
+}
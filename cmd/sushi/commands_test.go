@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/devenjarvis/sushi/internal/shell"
+)
+
+// writeExec writes a file under dir, executable if exec is set.
+func writeExec(t *testing.T, dir, name string, exec bool) {
+	t.Helper()
+	mode := os.FileMode(0o644)
+	if exec {
+		mode = 0o755
+	}
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// found returns the commands scanned that aren't builtins.
+func found(commands []string) []string {
+	return slices.DeleteFunc(slices.Clone(commands), shell.IsBuiltin)
+}
+
+func TestScan(t *testing.T) {
+	bin, other := t.TempDir(), t.TempDir()
+	writeExec(t, bin, "tool", true)
+	writeExec(t, bin, "data", false)
+	writeExec(t, bin, "sub/nested", true)
+	writeExec(t, other, "tool", true)
+	writeExec(t, other, "more", true)
+	os.Mkdir(filepath.Join(other, "dir"), 0o755)
+	os.Symlink("tool", filepath.Join(bin, "linked"))
+	os.Symlink(other, filepath.Join(bin, "dirlink"))
+	os.Symlink("missing", filepath.Join(bin, "broken"))
+
+	s := newPathScanner()
+	commands, changed := s.scan(bin+":"+other, "/")
+	if !changed {
+		t.Errorf("first scan didn't change the commands")
+	}
+	// Only the executables at the top of each directory, and links to them,
+	// the first of each name
+	want := []string{"linked", "tool", "more"}
+	if got := found(commands); !slices.Equal(got, want) {
+		t.Errorf("scan = %q, want %q", got, want)
+	}
+	if !slices.Equal(commands[:len(shell.Builtins())], shell.Builtins()) {
+		t.Errorf("scan = %q, want the builtins first", commands)
+	}
+	if got := s.cached(); !slices.Equal(got, commands) {
+		t.Errorf("cached = %q, want %q", got, commands)
+	}
+}
+
+func TestScanRelative(t *testing.T) {
+	dir := t.TempDir()
+	writeExec(t, dir, "bin/local", true)
+	commands, _ := newPathScanner().scan("bin", dir)
+	if got := found(commands); !slices.Equal(got, []string{"local"}) {
+		t.Errorf("scan = %q, want local from bin under %s", got, dir)
+	}
+}
+
+func TestScanCache(t *testing.T) {
+	bin := t.TempDir()
+	writeExec(t, bin, "tool", true)
+	s := newPathScanner()
+	s.scan(bin, "/")
+
+	if _, changed := s.scan(bin, "/"); changed {
+		t.Errorf("scan again changed the commands")
+	}
+
+	// A directory that wasn't modified isn't read again: a file slipped in
+	// without changing its time isn't seen
+	info, err := os.Stat(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeExec(t, bin, "new", true)
+	if err := os.Chtimes(bin, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if commands, changed := s.scan(bin, "/"); changed || slices.Contains(commands, "new") {
+		t.Errorf("scan read a directory that wasn't modified: %q", found(commands))
+	}
+
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(bin, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if commands, changed := s.scan(bin, "/"); !changed || !slices.Contains(commands, "new") {
+		t.Errorf("scan of a modified directory = %q, %v; want new found", found(commands), changed)
+	}
+
+	// Directories no longer in PATH are forgotten
+	s.scan("", "/")
+	if len(s.dirs) != 0 {
+		t.Errorf("dirs = %v after PATH was emptied", s.dirs)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/devenjarvis/sushi/internal/shell"
+	"github.com/devenjarvis/sushi/internal/syntax"
+
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	knownCommandStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#C7EF00"))
+	unknownCommandStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#DB162F"))
+	builtinStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("#56EEF4"))
+	keywordStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("#3185FC")).Bold(true)
+	stringStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFC857"))
+	variableStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	operatorStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("#3185FC"))
+	commentStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Italic(true)
+)
+
+// highlighter colors prompt input as it's typed.
+type highlighter struct {
+	homeDir  string
+	commands map[string]bool
+	text     lipgloss.Style
+
+	// paths holds whether the paths typed exist, or can be run where a
+	// command goes, so that they're not looked up again for every letter
+	// typed. It's emptied by forgetPaths once they may have changed.
+	paths map[pathCheck]bool
+}
+
+// pathCheck is a path looked up, for running it or for it to exist.
+type pathCheck struct {
+	path string
+	run  bool
+}
+
+func newHighlighter(homeDir string, commands []string, text lipgloss.Style) *highlighter {
+	h := &highlighter{homeDir: homeDir, text: text}
+	h.setCommands(commands)
+	return h
+}
+
+// setCommands replaces the names highlighted as commands.
+func (h *highlighter) setCommands(commands []string) {
+	commandMap := make(map[string]bool, len(commands))
+	for _, command := range commands {
+		commandMap[command] = true
+	}
+	h.commands = commandMap
+}
+
+// Styles returns a style for each rune of value. It's used as the
+// prompt.Model StyleFunc.
+func (h *highlighter) Styles(value []rune) []lipgloss.Style {
+	styles := make([]lipgloss.Style, len(value))
+	for i := range styles {
+		styles[i] = h.text
+	}
+
+	for _, span := range syntax.Highlight(string(value)) {
+		style, ok := h.spanStyle(span)
+		if !ok {
+			continue
+		}
+		for i := span.Pos; i < span.End && i < len(styles); i++ {
+			styles[i] = style
+		}
+	}
+
+	return styles
+}
+
+func (h *highlighter) spanStyle(span syntax.Span) (lipgloss.Style, bool) {
+	switch span.Class {
+	case syntax.ClassCommand:
+		if span.Word == "" {
+			return h.text, true
+		}
+		if shell.IsBuiltin(span.Word) {
+			return builtinStyle, true
+		}
+		if strings.ContainsRune(span.Word, '/') {
+			if h.exists(span.Word, true) {
+				return knownCommandStyle, true
+			}
+			return unknownCommandStyle, true
+		}
+		if h.commands[span.Word] {
+			return knownCommandStyle, true
+		}
+		return unknownCommandStyle, true
+	case syntax.ClassArgument:
+		if looksLikePath(span.Word) {
+			if !h.exists(span.Word, false) {
+				return h.text.Underline(true), true
+			}
+		}
+		return h.text, true
+	case syntax.ClassKeyword:
+		return keywordStyle, true
+	case syntax.ClassString:
+		return stringStyle, true
+	case syntax.ClassVariable, syntax.ClassAssignment:
+		return variableStyle, true
+	case syntax.ClassOperator, syntax.ClassRedirect:
+		return operatorStyle, true
+	case syntax.ClassComment:
+		return commentStyle, true
+	}
+	return lipgloss.Style{}, false
+}
+
+// exists reports whether the file at path exists, and can be run if run is
+// set. The answer is kept until forgetPaths is called.
+func (h *highlighter) exists(path string, run bool) bool {
+	key := pathCheck{h.expandHome(path), run}
+	if ok, found := h.paths[key]; found {
+		return ok
+	}
+	var err error
+	if run {
+		err = unix.Access(key.path, unix.X_OK)
+	} else {
+		_, err = os.Stat(key.path)
+	}
+	if h.paths == nil {
+		h.paths = make(map[pathCheck]bool)
+	}
+	h.paths[key] = err == nil
+	return err == nil
+}
+
+// forgetPaths forgets the paths looked up, as files may have been created
+// or removed, or relative paths may be in another directory.
+func (h *highlighter) forgetPaths() {
+	h.paths = nil
+}
+
+// looksLikePath reports whether an argument is meant to name a file.
+func looksLikePath(word string) bool {
+	return strings.ContainsRune(word, '/') || word == "~" || strings.HasPrefix(word, "~/")
+}
+
+func (h *highlighter) expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(h.homeDir, path[1:])
+	}
+	return path
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// styleCodes maps the letters describing how each rune is highlighted in
+// the tests to the styles.
+var styleCodes = map[byte]lipgloss.Style{
+	'_': textStyle,
+	'U': textStyle.Underline(true),
+	'K': knownCommandStyle,
+	'X': unknownCommandStyle,
+	'B': builtinStyle,
+	'W': keywordStyle,
+	'S': stringStyle,
+	'V': variableStyle,
+	'O': operatorStyle,
+	'C': commentStyle,
+}
+
+// codes returns the letters of styleCodes for each style, or '?' for those
+// not there.
+func codes(styles []lipgloss.Style) string {
+	b := make([]byte, len(styles))
+	for i, style := range styles {
+		b[i] = '?'
+		for code, s := range styleCodes {
+			if style.Render("x") == s.Render("x") {
+				b[i] = code
+			}
+		}
+	}
+	return string(b)
+}
+
+func testHighlighter(t *testing.T) (*highlighter, string) {
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	t.Cleanup(func() { lipgloss.SetColorProfile(profile) })
+
+	home := t.TempDir()
+	if err := os.WriteFile(filepath.Join(home, "run"), nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "file"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return newHighlighter(home, []string{"ls", "git"}, textStyle), home
+}
+
+func TestHighlightStyles(t *testing.T) {
+	h, _ := testHighlighter(t)
+	tests := []struct {
+		value, want string
+	}{
+		{"ls x | cat", "KK___O_XXX"},
+		{"git status && cd", "KKK________OO_BB"},
+		{"~/run ~/file", "KKKKK_______"},
+		{"~/file ~/nope", "XXXXXX_UUUUUU"},
+		{"cat ~/nope ~ nope/", "XXX_UUUUUU___UUUUU"},
+		{`cd "hi" $HOME # c`, "BB_SSSS_VVVVV_CCC"},
+		{"x=1 ls > out", "VV__KK_O____"},
+		{"for i in a; do ls; done", "WWW_V_WW__O_WW_KKO_WWWW"},
+	}
+	for _, tt := range tests {
+		if got := codes(h.Styles([]rune(tt.value))); got != tt.want {
+			t.Errorf("Styles(%q)\n got %s\nwant %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestHighlightPathCache(t *testing.T) {
+	h, home := testHighlighter(t)
+	value := []rune("~/tool ~/later")
+	const missing, found = "XXXXXX_UUUUUUU", "KKKKKK________"
+	if got := codes(h.Styles(value)); got != missing {
+		t.Fatalf("Styles(%q) = %s, want %s", string(value), got, missing)
+	}
+
+	// The files are only looked for again once the paths are forgotten
+	os.WriteFile(filepath.Join(home, "tool"), nil, 0o755)
+	os.WriteFile(filepath.Join(home, "later"), nil, 0o644)
+	if got := codes(h.Styles(value)); got != missing {
+		t.Errorf("Styles(%q) before forgetting = %s, want %s", string(value), got, missing)
+	}
+	h.forgetPaths()
+	if got := codes(h.Styles(value)); got != found {
+		t.Errorf("Styles(%q) after forgetting = %s, want %s", string(value), got, found)
+	}
+}
@@ -3,69 +3,193 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io/fs"
+	"io"
 	"os"
-	"os/exec"
+	"os/signal"
 	"os/user"
-	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/devenjarvis/sushi/internal/frecency"
+	"github.com/devenjarvis/sushi/internal/git"
 	"github.com/devenjarvis/sushi/internal/hint"
 	"github.com/devenjarvis/sushi/internal/prompt"
+	"github.com/devenjarvis/sushi/internal/rank"
+	"github.com/devenjarvis/sushi/internal/shell"
+	"github.com/devenjarvis/sushi/internal/spec"
+	"github.com/devenjarvis/sushi/internal/syntax"
+	"github.com/devenjarvis/sushi/internal/usage"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	"golang.org/x/sys/unix"
 )
 
-var exitError = errors.New("exit")
-
 type errMsg error
 
+// signalMsg is a signal received by sushi while the TUI is running.
+type signalMsg struct {
+	sig os.Signal
+}
+
+// doneMsg is sent when the command that was running has finished.
+type doneMsg struct {
+	err error
+}
+
+// readMsg asks for a line of input for the read builtin, which waits for
+// it on reply.
+type readMsg struct {
+	prompt string
+	secret bool
+	reply  chan<- readResult
+}
+
+type readResult struct {
+	line string
+	err  error
+}
+
+// readDoneMsg is sent when the read builtin or z stops waiting, because it
+// timed out or was interrupted.
+type readDoneMsg struct{}
+
+// pickMsg asks for one of several choices, for the z builtin, which waits
+// for it on reply.
+type pickMsg struct {
+	query   string
+	choices []string
+	reply   chan<- readResult
+}
+
 type command struct {
 	textInput prompt.Model
 	hintInput hint.Model
 	stdout    string
 	stderr    string
+	trace     string
+
+	// suggested is the value the suggestion was found for, so that it's
+	// only found again once the value changes
+	suggested string
+
+	// input is the command as it was run, and corrections the fixes the
+	// shell suggested for it
+	input       string
+	corrections []shell.Correction
+
+	// running holds the output so far while the command runs
+	running *output
+
+	// reading is set while the read builtin waits for a line typed into
+	// readInput, and picking while z waits for a choice made with picker.
+	// Either is sent to reply.
+	reading   bool
+	readInput prompt.Model
+	picking   bool
+	picker    hint.Model
+	reply     chan<- readResult
+}
+
+// output collects what a command writes while it runs.
+type output struct {
+	stdout syncBuffer
+	stderr syncBuffer
+	trace  syncBuffer
 }
 
-func NewCommand(commands []string) command {
+var textStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#F0F7F4"))
+
+// traceStyle dims the commands printed by set -x
+var traceStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+
+// correctionStyle marks the keys that run a corrected command
+var correctionStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#C7EF00")).Bold(true)
+
+func NewCommand(commands []string, hl *highlighter, providers []hint.Provider, ranker hint.Ranker, dir string) command {
 	ti := prompt.New()
+	ti.Prompt = gitPrompt(dir)
 	ti.Placeholder = "Cmd"
 	ti.Focus(false)
 	ti.Width = 0
 	ti.PromptStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#3185FC")).Faint(true)
 	ti.CursorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#3185FC"))
-	ti.TextStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#F0F7F4"))
+	ti.TextStyle = textStyle
+	ti.StyleFunc = hl.Styles
+	ti.DiagnosticStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#DB162F"))
+	ti.GutterStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
 
+	hi := hint.New(commands, providers...)
+	hi.SetRanker(ranker)
 	return command{
 		textInput: ti,
-		hintInput: hint.New(commands),
+		hintInput: hi,
+	}
+}
+
+// gitPrompt returns what the prompt shows in a git repository: the branch
+// checked out, and the operation in progress if any. It's read from the
+// repository, without running git.
+func gitPrompt(dir string) string {
+	repo, ok := git.Find(dir)
+	if !ok {
+		return ""
+	}
+	info := repo.Head()
+	if state := repo.State(); state != "" {
+		info += "|" + state
 	}
+	return info + " "
 }
 
 type model struct {
 	commands    []command
 	commandList []string
+	highlighter *highlighter
 	currentCmd  int
 	viewport    viewport.Model
 	ready       bool
 	homeDir     string
 	err         error
-	cmd         []string
+	runner      *shell.Runner
 	cmdHistory  []string
 	historyPos  int
 	width       int
 	height      int
 	cursor      int
 	toBottom    bool
+
+	// msgs carries the messages sent by the command running
+	msgs chan tea.Msg
+
+	// cancel stops the command running, with the signal its processes get
+	// as the cause
+	cancel context.CancelCauseFunc
+
+	// fixable is set from when a command with corrections finishes until
+	// the next key is pressed, which picks one of them if it's a digit
+	fixable bool
+
+	// scanner finds the commands in PATH for hints and highlighting
+	scanner *pathScanner
+
+	// providers complete arguments besides files
+	providers []hint.Provider
+
+	// stats ranks the hints by how commands were used, learning at first
+	// from history: the lines run before sushi started, with when they ran
+	stats   *rank.Stats
+	history []rank.Run
 }
 
-func initialModel(homeDir string, cmdHistory []string, commands []string) model {
+func initialModel(homeDir string, history []rank.Run, runner *shell.Runner, providers []hint.Provider, stats *rank.Stats) model {
 
 	// Build custom viewport keymap to avoid screen jumping when typing
 	keymap := viewport.KeyMap{
@@ -80,22 +204,116 @@ func initialModel(homeDir string, cmdHistory []string, commands []string) model
 	customViewport := viewport.New(100, 100)
 	customViewport.KeyMap = keymap
 
+	// The commands in PATH are added once they've been found
+	commands := shell.Builtins()
+	hl := newHighlighter(homeDir, commands, textStyle)
+
+	msgs := make(chan tea.Msg)
+	runner.ReadLine = readLine(msgs)
+	runner.Pick = pick(msgs)
+
+	// Commands not found are corrected to those found for hints, rather
+	// than reading PATH again
+	scanner := newPathScanner()
+	runner.Commands = scanner.cached
+
+	cmdHistory := make([]string, len(history))
+	for i, run := range history {
+		cmdHistory[i] = run.Line
+	}
+
 	return model{
 		ready:       false,
 		toBottom:    false,
 		commandList: commands,
-		commands:    []command{NewCommand(commands)},
+		highlighter: hl,
+		commands:    []command{NewCommand(commands, hl, providers, stats, runner.Dir)},
+		providers:   providers,
+		stats:       stats,
 		currentCmd:  0,
 		homeDir:     homeDir,
+		runner:      runner,
 		cmdHistory:  cmdHistory,
+		history:     history,
 		err:         nil,
 		historyPos:  0,
 		viewport:    customViewport,
+		msgs:        msgs,
+		scanner:     scanner,
 	}
 }
 
 func (m model) Init() tea.Cmd {
-	return prompt.Blink
+	return tea.Batch(prompt.Blink, waitMsg(m.msgs), m.rescan(), tickRescan(), m.learn())
+}
+
+// rescan looks for the commands in the shell's PATH again, in case they
+// changed.
+func (m model) rescan() tea.Cmd {
+	path, _ := m.runner.Var("PATH")
+	return m.scanner.rescan(path, m.runner.Dir)
+}
+
+// learn ranks hints by the commands in history, in the background.
+func (m model) learn() tea.Cmd {
+	stats, history := m.stats, m.history
+	return func() tea.Msg {
+		stats.Learn(history)
+		return nil
+	}
+}
+
+// waitMsg waits for the next message from the command running.
+func waitMsg(msgs <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-msgs
+	}
+}
+
+// readLine returns the function the read builtin uses to ask for a line in
+// the block of the command running.
+func readLine(msgs chan<- tea.Msg) func(context.Context, string, bool) (string, error) {
+	return func(ctx context.Context, prompt string, secret bool) (string, error) {
+		reply := make(chan readResult, 1)
+		msgs <- readMsg{prompt: prompt, secret: secret, reply: reply}
+		select {
+		case res := <-reply:
+			return res.line, res.err
+		case <-ctx.Done():
+			msgs <- readDoneMsg{}
+			return "", context.Cause(ctx)
+		}
+	}
+}
+
+// pick returns the function z uses to let the user choose between
+// directories in the block of the command running.
+func pick(msgs chan<- tea.Msg) func(context.Context, string, []string) (string, error) {
+	return func(ctx context.Context, query string, choices []string) (string, error) {
+		reply := make(chan readResult, 1)
+		msgs <- pickMsg{query: query, choices: choices, reply: reply}
+		select {
+		case res := <-reply:
+			return res.line, res.err
+		case <-ctx.Done():
+			msgs <- readDoneMsg{}
+			return "", context.Cause(ctx)
+		}
+	}
+}
+
+// newReadInput returns the input shown for the read builtin.
+func newReadInput(promptText string, secret bool) prompt.Model {
+	ti := prompt.New()
+	ti.Prompt = promptText
+	ti.PromptStyle = textStyle
+	ti.CursorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#3185FC"))
+	ti.TextStyle = textStyle
+	if secret {
+		ti.EchoMode = prompt.EchoPassword
+	}
+	ti.Focus(false)
+	return ti
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -106,38 +324,39 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.commands[m.currentCmd].running != nil {
+			cmds = append(cmds, m.runningKey(msg))
+			break
+		}
+		fixable := m.fixable
+		m.fixable = false
 		switch msg.Type {
 		case tea.KeyRunes:
 			m.toBottom = true
+			// A digit typed first thing after the last command picks one of
+			// its corrections
+			if fixed, ok := m.correction(msg.Runes); ok && fixable {
+				m.commands[m.currentCmd].textInput.SetValue(fixed)
+				cmds = append(cmds, m.run())
+			}
 		case tea.KeyEnter:
-			input := strings.TrimSuffix(m.commands[m.currentCmd].textInput.Value(), "\n")
-			m.cmd = parseInput(m.homeDir, input)
-			m.commands[m.currentCmd].textInput.Blur()
-			m.commands[m.currentCmd].hintInput.Clear()
-			m.commands[m.currentCmd].hintInput.Blur()
-			if stdout, stderr, err := execCmd(m.cmd); err != nil {
-				if err == exitError {
-					return m, tea.Quit
-				} else {
-					m.commands[m.currentCmd].stderr = err.Error()
-				}
-
-			} else {
-				m.commands[m.currentCmd].stdout = stdout.String()
-				m.commands[m.currentCmd].stderr = stderr.String()
+			if msg.Alt { // The prompt starts a new line
+				break
 			}
-			// Store command in history
-			m.cmdHistory = appendHistory(m.homeDir, input, m.cmdHistory)
-			// Add a new command
-			m.commands = append(m.commands, NewCommand(m.commandList))
-			m.currentCmd += 1
-			m.toBottom = true
+			if m.commands[m.currentCmd].hintInput.Focused() {
+				m.commands[m.currentCmd].acceptHint()
+				break
+			}
+			cmds = append(cmds, m.run())
 
 		case tea.KeyUp:
 			if m.commands[m.currentCmd].hintInput.Focused() {
-				m.commands[m.currentCmd].hintInput.Blur()
-				m.commands[m.currentCmd].textInput.Focus(true)
-			} else {
+				// The menu is left from its first hint
+				if m.commands[m.currentCmd].hintInput.Compact || m.commands[m.currentCmd].hintInput.GetCursor() == 0 {
+					m.commands[m.currentCmd].hintInput.Blur()
+					m.commands[m.currentCmd].textInput.Focus(true)
+				}
+			} else if !m.commands[m.currentCmd].textInput.CursorUp() {
 				if len(m.commands[m.currentCmd].textInput.Value()) == 0 && len(m.cmdHistory) > 0 {
 					m.historyPos = 1
 					m.commands[m.currentCmd].textInput.SetValue(m.cmdHistory[len(m.cmdHistory)-m.historyPos])
@@ -147,14 +366,16 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			}
 		case tea.KeyRight:
-			if !m.commands[m.currentCmd].hintInput.Focused() {
+			// At the end of the line, the row of hints is chosen from, unless
+			// the prompt accepts the suggestion shown
+			if m.commands[m.currentCmd].hintInput.Compact && !m.commands[m.currentCmd].hintInput.Focused() && m.commands[m.currentCmd].textInput.Suggestion() == "" {
 				if m.commands[m.currentCmd].textInput.Cursor() == len(m.commands[m.currentCmd].textInput.Value()) {
 					m.commands[m.currentCmd].textInput.Blur()
 					m.commands[m.currentCmd].hintInput.Focus()
 				}
 			}
 		case tea.KeyLeft:
-			if m.commands[m.currentCmd].hintInput.Focused() {
+			if m.commands[m.currentCmd].hintInput.Compact && m.commands[m.currentCmd].hintInput.Focused() {
 				if m.commands[m.currentCmd].hintInput.GetCursor() == 0 {
 					m.commands[m.currentCmd].hintInput.Blur()
 					m.commands[m.currentCmd].textInput.Focus(true)
@@ -162,6 +383,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 		case tea.KeyDown:
+			// Moves through the menu once it's focused
+			if m.commands[m.currentCmd].hintInput.Focused() || m.commands[m.currentCmd].textInput.CursorDown() {
+				break
+			}
 			if m.historyPos > 1 {
 				m.historyPos--
 				m.commands[m.currentCmd].textInput.SetValue(m.cmdHistory[len(m.cmdHistory)-m.historyPos])
@@ -179,17 +404,86 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.commands[m.currentCmd].textInput.Focus(false)
 			}
 		case tea.KeyTab: // Accept hint
-			m.commands[m.currentCmd].hintInput.Blur()
-			m.commands[m.currentCmd].textInput.SetValue(m.commands[m.currentCmd].hintInput.GetChoice())
-			m.commands[m.currentCmd].textInput.SetCursor(len(m.commands[m.currentCmd].textInput.Value()))
-			m.commands[m.currentCmd].textInput.Focus(true)
+			m.commands[m.currentCmd].acceptHint()
+		case tea.KeyEsc:
+			if m.commands[m.currentCmd].hintInput.Focused() {
+				m.commands[m.currentCmd].hintInput.Blur()
+				m.commands[m.currentCmd].textInput.Focus(true)
+			}
 		case tea.KeyCtrlC:
 			if m.commands[m.currentCmd].hintInput.Focused() {
 				m.commands[m.currentCmd].hintInput.Blur()
 				m.commands[m.currentCmd].textInput.Focus(true)
 			}
 			m.commands[m.currentCmd].textInput.SetValue("")
+			// The terminal is in raw mode, so this is how an INT trap runs
+			if cmd := m.handleSignal(syscall.SIGINT); cmd != nil {
+				return m, cmd
+			}
+		}
+	case signalMsg:
+		if m.commands[m.currentCmd].running != nil {
+			// Handled once the current command is stopped
+			m.interrupt(msg.sig)
+			break
 		}
+		if cmd := m.handleSignal(msg.sig); cmd != nil {
+			return m, cmd
+		}
+	case doneMsg:
+		c := &m.commands[m.currentCmd]
+		c.stdout = c.running.stdout.String()
+		c.stderr = c.running.stderr.String()
+		c.trace = c.running.trace.String()
+		c.running, c.reading, c.picking = nil, false, false
+		m.cancel(nil)
+		if msg.err == shell.ErrExit {
+			return m, tea.Quit
+		}
+		if msg.err != nil {
+			c.stderr += msg.err.Error()
+		}
+		c.corrections = m.runner.Corrections()
+		m.fixable = len(c.corrections) > 0
+		// Add a new command
+		m.commands = append(m.commands, NewCommand(m.commandList, m.highlighter, m.providers, m.stats, m.runner.Dir))
+		m.currentCmd += 1
+		m.toBottom = true
+		// The command may have changed PATH or installed something, or
+		// changed the files highlighted
+		m.highlighter.forgetPaths()
+		cmds = append(cmds, m.rescan())
+	case rescanMsg:
+		// Not while a command runs, as it may be changing PATH, which is
+		// scanned once it's done
+		if m.commands[m.currentCmd].running == nil {
+			cmds = append(cmds, m.rescan())
+		}
+		// Files may change outside the shell too
+		m.highlighter.forgetPaths()
+		cmds = append(cmds, tickRescan())
+	case commandsMsg:
+		m.commandList = msg.commands
+		m.highlighter.setCommands(msg.commands)
+		cmds = append(cmds, m.commands[m.currentCmd].hintInput.SetChoices(msg.commands))
+	case readMsg:
+		c := &m.commands[m.currentCmd]
+		c.reading = true
+		c.readInput = newReadInput(msg.prompt, msg.secret)
+		c.reply = msg.reply
+		m.toBottom = true
+		cmds = append(cmds, waitMsg(m.msgs))
+	case pickMsg:
+		c := &m.commands[m.currentCmd]
+		c.picking = true
+		c.picker = hint.NewPicker(msg.choices, msg.query)
+		c.reply = msg.reply
+		m.toBottom = true
+		cmds = append(cmds, waitMsg(m.msgs))
+	case readDoneMsg:
+		m.commands[m.currentCmd].reading = false
+		m.commands[m.currentCmd].picking = false
+		cmds = append(cmds, waitMsg(m.msgs))
 	case tea.WindowSizeMsg: // Resize window
 		m.width = msg.Width
 		m.height = msg.Height
@@ -202,35 +496,256 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	m.commands[m.currentCmd].textInput, cmd = m.commands[m.currentCmd].textInput.Update(msg)
-	cmds = append(cmds, cmd)
-	m.commands[m.currentCmd].hintInput.UpdateHintOptions(m.commands[m.currentCmd].textInput.Value())
-	m.commands[m.currentCmd].hintInput, cmd = m.commands[m.currentCmd].hintInput.Update(msg)
-	cmds = append(cmds, cmd)
+	if m.commands[m.currentCmd].running == nil {
+		m.commands[m.currentCmd].textInput, cmd = m.commands[m.currentCmd].textInput.Update(msg)
+		cmds = append(cmds, cmd)
+		if value := m.commands[m.currentCmd].textInput.Value(); value != m.commands[m.currentCmd].suggested {
+			m.commands[m.currentCmd].suggested = value
+			m.commands[m.currentCmd].textInput.SetSuggestion(m.stats.Suggest(value))
+		}
+		m.commands[m.currentCmd].hintInput.SetEnv(hint.Env{Dir: m.runner.Dir, Var: m.runner.Var})
+		m.commands[m.currentCmd].hintInput.Compact = m.compactHints()
+		cmds = append(cmds, m.commands[m.currentCmd].hintInput.UpdateHintOptions(m.commands[m.currentCmd].textInput.Value(), m.commands[m.currentCmd].textInput.Cursor()))
+		m.commands[m.currentCmd].hintInput, cmd = m.commands[m.currentCmd].hintInput.Update(msg)
+		cmds = append(cmds, cmd)
+	}
 
 	m.SetContent(m.width)
-	m.viewport, cmd = m.viewport.Update(msg)
-	cmds = append(cmds, cmd)
+	// Paging through the menu doesn't scroll the output
+	if !m.commands[m.currentCmd].hintInput.Focused() || !isPageKey(msg) {
+		m.viewport, cmd = m.viewport.Update(msg)
+		cmds = append(cmds, cmd)
+	}
 
 	return m, tea.Batch(cmds...)
 }
 
+// run starts running the input of the current command, or makes it take
+// another line if it's incomplete.
+func (m *model) run() tea.Cmd {
+	c := &m.commands[m.currentCmd]
+	input := strings.TrimSuffix(c.textInput.Value(), "\n")
+	prog, err := parseInput(input)
+	if err != nil {
+		var syntaxErr *syntax.Error
+		if errors.As(err, &syntaxErr) {
+			if syntaxErr.Incomplete {
+				// Let the rest of the command be typed on the next line
+				c.textInput.InsertNewline()
+			} else {
+				c.textInput.SetDiagnostic(syntaxErr.Pos, syntaxErr.Msg)
+			}
+		}
+		return nil
+	}
+	c.textInput.Blur()
+	c.textInput.SetSuggestion("")
+	c.hintInput.Clear()
+	c.hintInput.Blur()
+	c.input = input
+	// Store command in history
+	m.cmdHistory = appendHistory(m.homeDir, input, m.cmdHistory)
+	// Run it outside of Update, so that it can wait for input
+	out := &output{}
+	c.running = out
+	m.toBottom = true
+	ctx, cancel := context.WithCancelCause(context.Background())
+	m.cancel = cancel
+	runner, stats, dir := m.runner, m.stats, m.runner.Dir
+	return func() tea.Msg {
+		stats.Record(dir, input, time.Now())
+		err := execCmd(ctx, runner, prog, out)
+		stats.Save()
+		return doneMsg{err}
+	}
+}
+
+// fixes returns the corrected inputs suggested for a command, in the order
+// they're numbered.
+func (c command) fixes() []string {
+	var fixes []string
+	runes := []rune(c.input)
+	for _, corr := range c.corrections {
+		if corr.End > len(runes) {
+			continue
+		}
+		for _, fix := range corr.Fixes {
+			fixes = append(fixes, string(runes[:corr.Pos])+fix+string(runes[corr.End:]))
+		}
+	}
+	return fixes
+}
+
+// correction returns the corrected input picked by a digit typed at an
+// empty prompt, from those suggested for the last command.
+func (m *model) correction(typed []rune) (string, bool) {
+	if m.currentCmd == 0 || len(typed) != 1 || typed[0] < '1' || typed[0] > '9' || m.commands[m.currentCmd].textInput.Value() != "" {
+		return "", false
+	}
+	fixes := m.commands[m.currentCmd-1].fixes()
+	n := int(typed[0] - '1')
+	if n >= len(fixes) {
+		return "", false
+	}
+	return fixes[n], true
+}
+
+// acceptHint replaces the word before the cursor with the hint chosen.
+func (c *command) acceptHint() {
+	c.hintInput.Blur()
+	value, pos := c.hintInput.Complete(c.textInput.Value())
+	c.textInput.SetValue(value)
+	c.textInput.SetCursor(pos)
+	c.textInput.Focus(true)
+}
+
+// compactHints reports whether hints are shown in a row rather than a menu,
+// which SUSHI_HINTS=compact asks for.
+func (m *model) compactHints() bool {
+	value, _ := m.runner.Var("SUSHI_HINTS")
+	return value == "compact"
+}
+
+func isPageKey(msg tea.Msg) bool {
+	key, ok := msg.(tea.KeyMsg)
+	return ok && (key.Type == tea.KeyPgUp || key.Type == tea.KeyPgDown)
+}
+
+// runningKey handles a key pressed while a command runs, which only goes
+// somewhere if the read builtin is waiting for input or z for a choice.
+func (m *model) runningKey(msg tea.KeyMsg) tea.Cmd {
+	c := &m.commands[m.currentCmd]
+	switch {
+	case msg.Type == tea.KeyCtrlC:
+		// The shell stops the rest of the input, and read gets no line
+		m.interrupt(syscall.SIGINT)
+		if c.reading || c.picking {
+			c.reading, c.picking = false, false
+			c.reply <- readResult{err: io.EOF}
+		}
+		return nil
+	case c.picking:
+		switch msg.Type {
+		case tea.KeyEnter, tea.KeyTab:
+			c.picking = false
+			c.reply <- readResult{line: c.picker.GetChoice()}
+		case tea.KeyEsc:
+			c.picking = false
+			c.reply <- readResult{err: io.EOF}
+		default:
+			c.picker, _ = c.picker.Update(msg)
+		}
+		return nil
+	case !c.reading:
+		return nil
+	case msg.Type == tea.KeyCtrlD && c.readInput.Value() == "":
+		c.reading = false
+		c.reply <- readResult{err: io.EOF}
+		return nil
+	case msg.Type == tea.KeyEnter:
+		// Keep what was typed in the block, as a terminal would show it
+		line := c.readInput.Value()
+		c.readInput.Blur()
+		fmt.Fprintln(&c.running.stdout, c.readInput.View())
+		c.reading = false
+		c.reply <- readResult{line: line}
+		return nil
+	}
+	var cmd tea.Cmd
+	c.readInput, cmd = c.readInput.Update(msg)
+	return cmd
+}
+
+// interrupt passes a signal received while a command runs to the shell and
+// to the processes it's running, which stops the rest of the input.
+func (m *model) interrupt(sig os.Signal) {
+	m.runner.Signal(sig)
+	m.cancel(shell.SignalCause(sig))
+}
+
+// handleSignal passes a signal to the shell, adding the output of any trap
+// it runs to the block of the last command. It quits if the signal ends the
+// shell.
+func (m *model) handleSignal(sig os.Signal) tea.Cmd {
+	var stdout, stderr, trace syncBuffer
+	m.runner.Stdout = &stdout
+	m.runner.Stderr = &stderr
+	m.runner.Trace = &trace
+
+	m.runner.Signal(sig)
+	err := m.runner.HandleSignals(context.Background())
+	if m.currentCmd > 0 {
+		last := &m.commands[m.currentCmd-1]
+		last.stdout += stdout.String()
+		last.stderr += stderr.String()
+		last.trace += trace.String()
+	}
+	if err == shell.ErrExit {
+		return tea.Quit
+	}
+	return nil
+}
+
 func (c command) View(width int) string {
 	promptStyle := lipgloss.NewStyle().Width(width - 2).MarginTop(1).BorderStyle(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("#56EEF4")).Render
 	errorStyle := lipgloss.NewStyle().Width(width - 2).MarginTop(1).BorderStyle(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("#DB162F")).Render
 	successStyle := lipgloss.NewStyle().Width(width - 2).MarginTop(1).BorderStyle(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("#C7EF00")).Render
 
-	if len(c.stdout) == 0 && len(c.stderr) == 0 {
+	if c.running != nil {
+		blocks := []string{c.textInput.View()}
+		if trace := c.running.trace.String(); len(trace) > 0 {
+			blocks = append(blocks, traceStyle.Render(strings.TrimSuffix(trace, "\n")))
+		}
+		if stdout := c.running.stdout.String(); len(stdout) > 0 {
+			blocks = append(blocks, strings.TrimSuffix(stdout, "\n"))
+		}
+		if stderr := c.running.stderr.String(); len(stderr) > 0 {
+			blocks = append(blocks, strings.TrimSuffix(stderr, "\n"))
+		}
+		if c.reading {
+			blocks = append(blocks, c.readInput.View())
+		}
+		if c.picking {
+			blocks = append(blocks, c.picker.View())
+		}
+		return promptStyle(lipgloss.JoinVertical(lipgloss.Left, blocks...))
+	}
+
+	if len(c.stdout) == 0 && len(c.stderr) == 0 && len(c.trace) == 0 {
 		return promptStyle(lipgloss.JoinVertical(lipgloss.Left, c.textInput.View(), c.hintInput.View()))
-	} else if len(c.stdout) > 0 {
-		if len(c.stderr) > 0 {
-			return errorStyle(lipgloss.JoinVertical(lipgloss.Left, c.textInput.View(), c.stdout, c.stderr))
+	}
+
+	blocks := []string{c.textInput.View()}
+	if len(c.trace) > 0 {
+		blocks = append(blocks, traceStyle.Render(strings.TrimSuffix(c.trace, "\n")))
+	}
+	if len(c.stdout) > 0 {
+		blocks = append(blocks, c.stdout)
+	}
+	if len(c.stderr) > 0 {
+		if len(c.corrections) > 0 {
+			blocks = append(blocks, strings.TrimSuffix(c.stderr, "\n"), c.correctionsView())
 		} else {
-			return successStyle(lipgloss.JoinVertical(lipgloss.Left, c.textInput.View(), c.stdout))
+			blocks = append(blocks, c.stderr)
+		}
+		return errorStyle(lipgloss.JoinVertical(lipgloss.Left, blocks...))
+	}
+	return successStyle(lipgloss.JoinVertical(lipgloss.Left, blocks...))
+}
+
+// correctionsView lists the fixes suggested for a command, with the digit
+// that runs each.
+func (c command) correctionsView() string {
+	var b strings.Builder
+	b.WriteString(traceStyle.Render("did you mean"))
+	n := 1
+	for _, corr := range c.corrections {
+		for _, fix := range corr.Fixes {
+			b.WriteString("  " + correctionStyle.Render(fmt.Sprint(n)) + " " + fix)
+			n++
 		}
-	} else {
-		return errorStyle(lipgloss.JoinVertical(lipgloss.Left, c.textInput.View(), c.stderr))
 	}
+	return b.String()
 }
 
 func (m *model) SetContent(width int) {
@@ -252,56 +767,117 @@ func (m model) View() string {
 	return m.viewport.View()
 }
 
-func execCmd(args []string) (bytes.Buffer, bytes.Buffer, error) {
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
+// syncBuffer is a bytes.Buffer that background jobs can keep writing to
+// after the command that started them has finished.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
 
-	if len(args) > 0 {
-		// Check for background process
-		backgroundProcess := false
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
 
-		// Check for background process
-		if args[len(args)-1] == "&" {
-			backgroundProcess = true
-			args = args[:len(args)-1]
-		}
-		// Check for built-in commands
-		switch args[0] {
-		case "cd":
-			if len(args) < 2 {
-				return stdout, stderr, errors.New("path required")
-			}
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
 
-			return stdout, stderr, os.Chdir(args[1])
-		case "exit":
-			return stdout, stderr, exitError
-		}
+// execCmd runs a command, writing its output to out.
+func execCmd(ctx context.Context, runner *shell.Runner, prog *syntax.File, out *output) error {
+	runner.Stdin = os.Stdin
+	runner.Stdout = &out.stdout
+	runner.Stderr = &out.stderr
+	runner.Trace = &out.trace
 
-		// Make sure command exists
-		_, err := exec.LookPath(args[0])
-		if err != nil {
-			errMsg := fmt.Sprintf("didn't find '%s'", args[0])
-			return stdout, stderr, errors.New(errMsg)
-		} else {
-			// Prepare command to execute
-			cmd := exec.Command(args[0], args[1:]...)
+	err := runner.Run(ctx, prog)
 
-			// cmd.Stdout = os.Stdout
-			// cmd.Stderr = os.Stderr
-			cmd.Stdout = &stdout
-			cmd.Stderr = &stderr
+	// Keep the process in the shell's directory for anything that looks at
+	// relative paths, like highlighting
+	os.Chdir(runner.Dir)
+	if runner.Dirs != nil {
+		runner.Dirs.Save()
+	}
 
-			//Execute the command
-			if backgroundProcess {
-				return stdout, stderr, cmd.Start()
-			} else {
-				cmd.Stdin = os.Stdin
-				return stdout, stderr, cmd.Run()
-			}
+	if err == nil && runner.Status() != 0 && len(out.stderr.String()) == 0 {
+		err = fmt.Errorf("exit status %d", runner.Status())
+	}
+	return err
+}
+
+// runScript runs commands without the TUI, from a script file or given
+// with -c, and returns the exit status.
+func runScript(args []string) int {
+	name, src := args[0], ""
+	if args[0] == "-c" {
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "sushi: -c: option requires an argument")
+			return 2
+		}
+		// As in other shells, the argument after the commands is $0
+		name, src, args = "sushi", args[1], args[2:]
+		if len(args) > 0 {
+			name, args = args[0], args[1:]
 		}
 	} else {
-		return stdout, stderr, nil
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sushi: %v\n", err)
+			return 127
+		}
+		src, args = string(data), args[1:]
+	}
+
+	prog, err := syntax.Parse(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, syntaxError(src, err))
+		return 2
+	}
+
+	dir, _ := os.Getwd()
+	runner := shell.New(dir)
+	runner.Name = name
+	runner.SetParams(args)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, shell.Signals()...)
+	go func() {
+		for sig := range sigs {
+			runner.Signal(sig)
+		}
+	}()
+
+	runner.Run(context.Background(), prog)
+	return runner.Exit(context.Background())
+}
+
+// runConfig runs the commands in the config file before the TUI starts, so
+// they can set variables and options for the session.
+func runConfig(runner *shell.Runner, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	prog, err := syntax.Parse(string(data))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, syntaxError(string(data), err))
+		return
 	}
+	runner.Run(context.Background(), prog)
+}
+
+// syntaxError describes a parse error with the line it's on.
+func syntaxError(src string, err error) string {
+	var syntaxErr *syntax.Error
+	if !errors.As(err, &syntaxErr) {
+		return err.Error()
+	}
+	runes := []rune(src)
+	line := 1 + strings.Count(string(runes[:min(syntaxErr.Pos, len(runes))]), "\n")
+	return fmt.Sprintf("line %d: %s", line, syntaxErr.Msg)
 }
 
 func prependString(array []string, val string) []string {
@@ -311,7 +887,7 @@ func prependString(array []string, val string) []string {
 	return array
 }
 
-func initHistory(sushiHistoryPath string) ([]string, error) {
+func initHistory(sushiHistoryPath string) ([]rank.Run, error) {
 
 	if _, err := os.Stat(sushiHistoryPath); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -325,91 +901,99 @@ func initHistory(sushiHistoryPath string) ([]string, error) {
 		}
 
 	} else {
-		var cmdHistory []string
 		// load history
 		file, err := os.Open(sushiHistoryPath)
 		if err != nil {
 			return nil, err
 		}
 		defer file.Close()
+		return readHistory(file)
+	}
 
-		scanner := bufio.NewScanner(file)
+	return nil, nil
+}
 
-		for scanner.Scan() {
-			cmdHistory = append(cmdHistory, scanner.Text())
+// readHistory reads the lines of a history file, with when they were run.
+// Multi-line commands are stored with a backslash ending each line but the
+// last, and each command follows a comment with the Unix time it was run,
+// as bash does, except in history written before sushi kept the times.
+func readHistory(r io.Reader) ([]rank.Run, error) {
+	var history []rank.Run
+	scanner := bufio.NewScanner(r)
+	var entry strings.Builder
+	var ran time.Time
+	for scanner.Scan() {
+		line := scanner.Text()
+		if entry.Len() == 0 && ran.IsZero() {
+			if secs, ok := strings.CutPrefix(line, "#"); ok {
+				if n, err := strconv.ParseInt(secs, 10, 64); err == nil {
+					ran = time.Unix(n, 0)
+					continue
+				}
+			}
 		}
-
-		if err := scanner.Err(); err != nil {
-			return nil, err
-		} else {
-			return cmdHistory, err
+		if strings.HasSuffix(line, "\\") {
+			entry.WriteString(strings.TrimSuffix(line, "\\") + "\n")
+			continue
 		}
+		entry.WriteString(line)
+		history = append(history, rank.Run{Line: entry.String(), Time: ran})
+		entry.Reset()
+		ran = time.Time{}
 	}
-
-	return nil, nil
+	return history, scanner.Err()
 }
 
-func initialize(homeDir string) ([]string, []string, error) {
+func initialize(homeDir string) ([]rank.Run, error) {
 	// Create history file
 	sushiHistoryPath := fmt.Sprintf("%s/.sushi_history", homeDir)
 
 	cmdHistory, err := initHistory(sushiHistoryPath)
 	if err != nil {
-		return nil, nil, err
-	}
-
-	// Load PATH
-	full_path := os.Getenv("PATH")
-	split_path := filepath.SplitList(full_path)
-
-	// Initialize with internal list of commands
-	commandMap := make(map[string]bool)
-	commands := []string{"cd", "exit"}
-
-	for _, path := range split_path {
-		filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
-			if err != nil || d.IsDir() {
-				return err
-			}
-			info, err := d.Info()
-			if err == nil {
-				// Check if executable
-				if info.Mode().Perm()&0111 != 0 {
-					// Check if user has access (Unix)
-					access_err := unix.Access(path, 0x1)
-					if access_err != nil {
-						return nil
-					} else {
-						if _, value := commandMap[d.Name()]; !value {
-							commandMap[d.Name()] = true
-							commands = append(commands, d.Name())
-						}
-					}
-				}
-			}
-
-			return nil
-		})
+		return nil, err
 	}
 
 	// Create config file
-	sushiConfigPath := fmt.Sprintf("%s/.sushi_config", homeDir)
-
-	if _, err = os.Stat(sushiConfigPath); err != nil {
+	if _, err = os.Stat(sushiConfigPath(homeDir)); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			// sushi config file does not exist
-			_, create_err := os.Create(sushiConfigPath)
+			_, create_err := os.Create(sushiConfigPath(homeDir))
 			if create_err != nil {
-				return cmdHistory, commands, create_err
+				return cmdHistory, create_err
 			}
 		} else {
-			return cmdHistory, commands, err
+			return cmdHistory, err
 		}
-	} else {
-		// run config
 	}
 
-	return cmdHistory, commands, nil
+	return cmdHistory, nil
+}
+
+func sushiConfigPath(homeDir string) string {
+	return fmt.Sprintf("%s/.sushi_config", homeDir)
+}
+
+// sushiCompletionsPath returns the directory of the spec files describing
+// the completions of commands.
+func sushiCompletionsPath(homeDir string) string {
+	return fmt.Sprintf("%s/.sushi_completions", homeDir)
+}
+
+// sushiFlagsPath returns the file that keeps the flags of commands found
+// in their man page or --help.
+func sushiFlagsPath(homeDir string) string {
+	return fmt.Sprintf("%s/.sushi_flags", homeDir)
+}
+
+// sushiContextPath returns the file that keeps the words of the commands
+// run in each directory, for ranking hints.
+func sushiContextPath(homeDir string) string {
+	return fmt.Sprintf("%s/.sushi_context", homeDir)
+}
+
+// sushiDirsPath returns the file that keeps the directories visited, for z.
+func sushiDirsPath(homeDir string) string {
+	return fmt.Sprintf("%s/.sushi_dirs", homeDir)
 }
 
 func appendHistory(home_dir string, command string, cmdHistory []string) []string {
@@ -427,7 +1011,7 @@ func appendHistory(home_dir string, command string, cmdHistory []string) []strin
 
 			defer f.Close()
 
-			if _, err = f.WriteString(fmt.Sprintln(command)); err != nil {
+			if _, err = fmt.Fprintf(f, "#%d\n%s\n", time.Now().Unix(), strings.ReplaceAll(command, "\n", "\\\n")); err != nil {
 				panic(err)
 			}
 		}
@@ -436,39 +1020,62 @@ func appendHistory(home_dir string, command string, cmdHistory []string) []strin
 	return cmdHistory
 }
 
-func parseInput(homeDir string, input string) []string {
-	// Sustitute home directory
-	input = strings.ReplaceAll(input, "~", homeDir)
-
-	if len(input) > 0 {
-		// Make sure background commands have a space
-		if input[len(input)-1] == '&' && input[len(input)-2] != ' ' {
-			input = fmt.Sprintf("%s%s", input[:len(input)-1], " &")
-		}
-
-		// Split on space to build command
-		cmd := strings.Split(input, " ")
-
-		return cmd
-	} else {
-		return []string{}
-	}
+func parseInput(input string) (*syntax.File, error) {
+	return syntax.Parse(input)
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runScript(os.Args[1:]))
+	}
+
 	usr, _ := user.Current()
 	homeDir := usr.HomeDir
 
-	cmdHistory, commands, init_err := initialize(homeDir)
+	history, init_err := initialize(homeDir)
 	if init_err != nil {
 		fmt.Println("Initialization Error:", init_err)
 	} else {
-		p := tea.NewProgram(initialModel(homeDir, cmdHistory, commands), tea.WithAltScreen(), tea.WithMouseCellMotion())
+		dir, _ := os.Getwd()
+		runner := shell.New(dir)
+		runner.Interactive = true
+		if dirs, err := frecency.Load(sushiDirsPath(homeDir)); err == nil {
+			runner.Dirs = dirs
+		}
+		runConfig(runner, sushiConfigPath(homeDir))
 
-		_, err := p.Run()
+		specs, err := spec.Load(sushiCompletionsPath(homeDir))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "sushi: completions:", err)
+		}
+		// Flags are only read from man pages and --help for commands
+		// without a spec, and not for builtins
+		flags := usage.New(sushiFlagsPath(homeDir), func(name string) bool {
+			return specs.Has(name) || shell.IsBuiltin(name)
+		})
+		providers := []hint.Provider{specs, flags, git.New(specs.ArgType)}
+
+		stats, _ := rank.Load(sushiContextPath(homeDir))
+
+		p := tea.NewProgram(initialModel(homeDir, history, runner, providers, stats), tea.WithAltScreen(), tea.WithMouseCellMotion(), tea.WithoutSignalHandler())
+
+		// Signals go to the shell, which decides whether to quit
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, shell.Signals()...)
+		go func() {
+			for sig := range sigs {
+				p.Send(signalMsg{sig})
+			}
+		}()
+
+		_, err = p.Run()
 		if err != nil {
 			fmt.Println("Oh no:", err)
 			os.Exit(1)
 		}
+
+		// Run the EXIT trap and hang up jobs in the terminal the TUI left
+		runner.Stdin, runner.Stdout, runner.Stderr, runner.Trace = os.Stdin, os.Stdout, os.Stderr, nil
+		os.Exit(runner.Exit(context.Background()))
 	}
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/devenjarvis/sushi/internal/prompt"
+	"github.com/devenjarvis/sushi/internal/rank"
+	"github.com/devenjarvis/sushi/internal/shell"
+	"github.com/devenjarvis/sushi/internal/syntax"
+	"github.com/muesli/termenv"
+)
+
+func TestReadHistory(t *testing.T) {
+	file := strings.Join([]string{
+		"ls",            // before history had times
+		"echo a\\", "b", // over two lines
+		"#1700000000", "pwd", // with the time it ran
+		"#1700000100", "for i in 1 2\\", "do echo $i\\", "done",
+		"#1700000200", "#1", // a comment run as a command
+		"make",
+	}, "\n") + "\n"
+
+	want := []rank.Run{
+		{Line: "ls"},
+		{Line: "echo a\nb"},
+		{Line: "pwd", Time: time.Unix(1700000000, 0)},
+		{Line: "for i in 1 2\ndo echo $i\ndone", Time: time.Unix(1700000100, 0)},
+		{Line: "#1", Time: time.Unix(1700000200, 0)},
+		{Line: "make"},
+	}
+	got, err := readHistory(strings.NewReader(file))
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("readHistory = %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestTraceView(t *testing.T) {
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	defer lipgloss.SetColorProfile(profile)
+
+	prog, err := syntax.Parse(`set -x; echo a`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &output{}
+	runner := shell.New(t.TempDir())
+	runner.Stdout, runner.Stderr, runner.Trace = &out.stdout, &out.stderr, &out.trace
+	if err := runner.Run(context.Background(), prog); err != nil {
+		t.Fatal(err)
+	}
+
+	// The traced command is dimmed apart from the output, while the
+	// command runs and once it's done
+	dimmed := traceStyle.Render("+ echo a")
+	c := command{textInput: prompt.New(), running: out}
+	if view := c.View(80); !strings.Contains(view, dimmed) || strings.Contains(view, traceStyle.Render("a")) {
+		t.Errorf("running View = %q, want the trace %q", view, dimmed)
+	}
+	c.running, c.trace, c.stdout = nil, out.trace.String(), out.stdout.String()
+	if view := c.View(80); !strings.Contains(view, dimmed) {
+		t.Errorf("View = %q, want the trace %q", view, dimmed)
+	}
+}
+
+// press sends keys to a model.
+func press(m tea.Model, keys ...tea.KeyMsg) tea.Model {
+	for _, key := range keys {
+		m, _ = m.Update(key)
+	}
+	return m
+}
+
+// typed returns the keys typing s.
+func typed(s string) []tea.KeyMsg {
+	var keys []tea.KeyMsg
+	for _, c := range s {
+		keys = append(keys, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{c}})
+	}
+	return keys
+}
+
+func TestSuggested(t *testing.T) {
+	dir := t.TempDir()
+	stats, err := rank.Load(filepath.Join(dir, "context"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats.Record(dir, "git status", time.Now())
+	var m tea.Model = initialModel(dir, nil, shell.New(dir), nil, stats)
+	suggestion := func() string {
+		return m.(model).commands[0].textInput.Suggestion()
+	}
+
+	m = press(m, typed("git s")...)
+	if got := suggestion(); got != "tatus" {
+		t.Fatalf("suggestion for %q = %q, want %q", "git s", got, "tatus")
+	}
+
+	// Until the value changes the suggestion isn't looked for again, even
+	// if a better one would be found now
+	for range 3 {
+		stats.Record(dir, "git stash", time.Now())
+	}
+	m = press(m, tea.KeyMsg{Type: tea.KeyLeft}, tea.KeyMsg{Type: tea.KeyRight})
+	if got := suggestion(); got != "tatus" {
+		t.Errorf("suggestion after moving the cursor = %q, want %q", got, "tatus")
+	}
+	m = press(m, typed("t")...)
+	if got := suggestion(); got != "ash" {
+		t.Errorf("suggestion for %q = %q, want %q", "git st", got, "ash")
+	}
+
+	m = press(m, tea.KeyMsg{Type: tea.KeyRight})
+	if got, want := m.(model).commands[0].textInput.Value(), "git stash"; got != want {
+		t.Errorf("value after accepting the suggestion = %q, want %q", got, want)
+	}
+	if got := suggestion(); got != "" {
+		t.Errorf("suggestion once accepted = %q, want none", got)
+	}
+}
+
+func TestContinue(t *testing.T) {
+	enter := tea.KeyMsg{Type: tea.KeyEnter}
+	tests := [][]string{
+		{`echo a \`, "b"},
+		{"echo a |", "cat"},
+		{"true &&", "echo b"},
+		{"for i in 1 2; do", "echo $i", "done"},
+		{"if true", "then echo a", "fi"},
+		{"cat <<EOF", "a", "b", "EOF"},
+		{`echo "a`, `b"`},
+	}
+	for _, lines := range tests {
+		dir := t.TempDir()
+		stats, _ := rank.Load(filepath.Join(dir, "context"))
+		var m tea.Model = initialModel(dir, nil, shell.New(dir), nil, stats)
+
+		// Each line but the last leaves the input incomplete, so Enter
+		// starts another line rather than running it
+		for i, line := range lines[:len(lines)-1] {
+			m = press(m, append(typed(line), enter)...)
+			c := m.(model).commands[0]
+			want := strings.Join(lines[:i+1], "\n") + "\n"
+			if c.running != nil || c.textInput.Value() != want {
+				t.Errorf("after %q, input = %q, running %t; want %q, not running", line, c.textInput.Value(), c.running != nil, want)
+			}
+		}
+
+		m = press(m, append(typed(lines[len(lines)-1]), enter)...)
+		c := m.(model).commands[0]
+		if want := strings.Join(lines, "\n"); c.running == nil || c.input != want {
+			t.Errorf("ran %q, running %t; want %q to run", c.input, c.running != nil, want)
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	dir := t.TempDir()
+	stats, _ := rank.Load(filepath.Join(dir, "context"))
+	var m tea.Model = initialModel(dir, nil, shell.New(dir), nil, stats)
+	m = press(m, append(typed("echo a )"), tea.KeyMsg{Type: tea.KeyEnter})...)
+	c := m.(model).commands[0]
+	if c.running != nil || c.textInput.Value() != "echo a )" {
+		t.Errorf("input with a syntax error = %q, running %t; want it kept, not running", c.textInput.Value(), c.running != nil)
+	}
+	if view := c.textInput.View(); !strings.Contains(view, "^ ") {
+		t.Errorf("input with a syntax error shows %q, want a diagnostic", view)
+	}
+}
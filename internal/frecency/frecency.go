@@ -0,0 +1,256 @@
+// Package frecency ranks things by how often and how recently they were
+// used, like the directories jumped to with z.
+package frecency
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRank is the total rank above which all the ranks are aged, so that
+// things not used anymore are eventually forgotten.
+const maxRank = 9000
+
+// Entry is something that was used, with the number of times it was used,
+// decayed with age, and when it was last used.
+type Entry struct {
+	Key  string
+	Rank float64
+	Time time.Time
+}
+
+// Score returns the frecency of the entry at a time: its rank, weighted by
+// how recently it was used.
+func (e Entry) Score(now time.Time) float64 {
+	switch age := now.Sub(e.Time); {
+	case age < time.Hour:
+		return e.Rank * 4
+	case age < 24*time.Hour:
+		return e.Rank * 2
+	case age < 7*24*time.Hour:
+		return e.Rank / 2
+	default:
+		return e.Rank / 4
+	}
+}
+
+// Store holds the entries in a file, with a line for each in the format used
+// by z: the key, its rank and the Unix time it was last used, separated by
+// '|'. It's safe for concurrent use.
+type Store struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]*Entry
+	dirty   bool
+
+	// total is the sum of the ranks
+	total float64
+}
+
+// New returns an empty store that's only kept in memory, which Save
+// doesn't write.
+func New() *Store {
+	return &Store{entries: make(map[string]*Entry)}
+}
+
+// Load reads the entries saved in the file at path. The file doesn't have to
+// exist yet.
+func Load(path string) (*Store, error) {
+	s := &Store{path: path, entries: make(map[string]*Entry)}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return s, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The key can contain '|', so the fields are taken from the end
+		line := scanner.Text()
+		rest, secs, ok := cutLast(line)
+		if !ok {
+			continue
+		}
+		key, rank, ok := cutLast(rest)
+		if !ok || key == "" {
+			continue
+		}
+		e := &Entry{Key: key}
+		if e.Rank, err = strconv.ParseFloat(rank, 64); err != nil {
+			continue
+		}
+		n, err := strconv.ParseInt(secs, 10, 64)
+		if err != nil {
+			continue
+		}
+		e.Time = time.Unix(n, 0)
+		s.entries[key] = e
+		s.total += e.Rank
+	}
+	return s, scanner.Err()
+}
+
+func cutLast(s string) (string, string, bool) {
+	i := strings.LastIndexByte(s, '|')
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+1:], true
+}
+
+// Add records a use of key at t. Uses recorded out of order don't make it
+// any older, and those at a zero t, when it's not known, only count
+// towards how often it was used.
+func (s *Store) Add(key string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &Entry{Key: key}
+		s.entries[key] = e
+	}
+	e.Rank++
+	if t.After(e.Time) {
+		e.Time = t
+	}
+	s.dirty = true
+	s.total++
+	s.age()
+}
+
+// Merge adds the uses recorded in o, such as those learned apart from the
+// store, keeping the latest time each key was used.
+func (s *Store) Merge(o *Store) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, oe := range o.entries {
+		e, ok := s.entries[key]
+		if !ok {
+			e = &Entry{Key: key}
+			s.entries[key] = e
+		}
+		e.Rank += oe.Rank
+		if oe.Time.After(e.Time) {
+			e.Time = oe.Time
+		}
+		s.dirty = true
+		s.total += oe.Rank
+	}
+	s.age()
+}
+
+// age ages all the ranks once their total is over maxRank.
+func (s *Store) age() {
+	if s.total <= maxRank {
+		return
+	}
+	s.total = 0
+	for key, e := range s.entries {
+		e.Rank *= 0.99
+		if e.Rank < 1 {
+			delete(s.entries, key)
+			continue
+		}
+		s.total += e.Rank
+	}
+}
+
+// Remove forgets key.
+func (s *Store) Remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		delete(s.entries, key)
+		s.total -= e.Rank
+		s.dirty = true
+	}
+}
+
+// Score returns the frecency of key, 0 if it was never used.
+func (s *Store) Score(key string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		return e.Score(time.Now())
+	}
+	return 0
+}
+
+// Scored is an entry with its score.
+type Scored struct {
+	Key   string
+	Score float64
+}
+
+// Ranked returns the entries whose key match, highest score first. A nil
+// match keeps them all.
+func (s *Store) Ranked(match func(key string) bool) []Scored {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var ranked []Scored
+	for key, e := range s.entries {
+		if match == nil || match(key) {
+			ranked = append(ranked, Scored{Key: key, Score: e.Score(now)})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Key < ranked[j].Key
+	})
+	return ranked
+}
+
+// Save writes the entries to the file, if they changed since they were
+// loaded or last saved.
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty || s.path == "" {
+		return nil
+	}
+
+	// Write to a temporary file first so that the entries are never lost
+	// half written
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, e := range s.entries {
+		fmt.Fprintf(w, "%s|%s|%d\n", e.Key, strconv.FormatFloat(e.Rank, 'f', -1, 64), e.Time.Unix())
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	s.dirty = false
+	return nil
+}
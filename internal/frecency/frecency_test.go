@@ -0,0 +1,173 @@
+package frecency
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func keys(ranked []Scored) []string {
+	var keys []string
+	for _, s := range ranked {
+		keys = append(keys, s.Key)
+	}
+	return keys
+}
+
+func TestScore(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		age  time.Duration
+		want float64
+	}{
+		{time.Minute, 40},
+		{2 * time.Hour, 20},
+		{2 * 24 * time.Hour, 5},
+		{30 * 24 * time.Hour, 2.5},
+	}
+	for _, tt := range tests {
+		e := Entry{Key: "a", Rank: 10, Time: now.Add(-tt.age)}
+		if got := e.Score(now); got != tt.want {
+			t.Errorf("Score after %v = %v, want %v", tt.age, got, tt.want)
+		}
+	}
+}
+
+func TestRanked(t *testing.T) {
+	now := time.Now()
+	s := New()
+	// Used more often, but weeks ago
+	for i := 0; i < 10; i++ {
+		s.Add("/often", now.Add(-30*24*time.Hour))
+	}
+	s.Add("/recent", now)
+	s.Add("/recent", now)
+	s.Add("/other", now.Add(-2*time.Hour))
+	s.Add("/tie", now.Add(-2*time.Hour))
+
+	if got, want := keys(s.Ranked(nil)), []string{"/recent", "/often", "/other", "/tie"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Ranked = %q, want %q", got, want)
+	}
+	match := func(key string) bool { return key != "/recent" }
+	if got, want := keys(s.Ranked(match)), []string{"/often", "/other", "/tie"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Ranked(match) = %q, want %q", got, want)
+	}
+
+	s.Remove("/recent")
+	if got := s.Score("/recent"); got != 0 {
+		t.Errorf("Score after Remove = %v, want 0", got)
+	}
+}
+
+func TestAddTime(t *testing.T) {
+	now := time.Now()
+	s := New()
+	s.Add("/a", now)
+	// Neither a use recorded late nor one at an unknown time make it older
+	s.Add("/a", now.Add(-48*time.Hour))
+	s.Add("/a", time.Time{})
+	if got, want := s.Score("/a"), 3.0*4; got != want {
+		t.Errorf("Score = %v, want %v", got, want)
+	}
+
+	s.Add("/b", time.Time{})
+	if got, want := s.Score("/b"), 1.0/4; got != want {
+		t.Errorf("Score of a use at an unknown time = %v, want %v", got, want)
+	}
+}
+
+func TestAge(t *testing.T) {
+	now := time.Now()
+	s := New()
+	s.Add("/rare", now)
+	s.Add("/rare", now)
+	for i := 0; i < maxRank-2; i++ {
+		s.Add("/often", now)
+	}
+	if got := s.Score("/rare"); got != 2*4 {
+		t.Fatalf("Score before aging = %v, want %v", got, 2*4)
+	}
+
+	// Going over the total ages every rank, forgetting those under 1
+	s.Add("/once", now)
+	if got, want := s.Score("/rare"), 2*0.99*4; got != want {
+		t.Errorf("Score of /rare after aging = %v, want %v", got, want)
+	}
+	if got, want := s.Score("/often"), (maxRank-2)*0.99*4; got != want {
+		t.Errorf("Score of /often after aging = %v, want %v", got, want)
+	}
+	if got := s.Score("/once"); got != 0 {
+		t.Errorf("Score of /once after aging = %v, want it forgotten", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	now := time.Now()
+	s, o := New(), New()
+	s.Add("/a", now.Add(-48*time.Hour))
+	o.Add("/a", now)
+	o.Add("/b", now)
+	s.Merge(o)
+
+	if got, want := s.Score("/a"), 2.0*4; got != want {
+		t.Errorf("Score of /a = %v, want %v with the latest time", got, want)
+	}
+	if got, want := s.Score("/b"), 1.0*4; got != want {
+		t.Errorf("Score of /b = %v, want %v", got, want)
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "z")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load of a missing file: %v", err)
+	}
+	now := time.Unix(time.Now().Unix(), 0)
+	s.Add("/a", now)
+	s.Add("/a", now)
+	s.Add("/with|bar", now.Add(-time.Hour))
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.entries, s.entries) || loaded.total != s.total {
+		t.Errorf("Load = %v, want %v", loaded.entries, s.entries)
+	}
+
+	// Nothing is left of the temporary file, and nothing is written again
+	// until the entries change
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("files after Save = %v, want only z", files)
+	}
+	os.Remove(path)
+	if err := loaded.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Errorf("Save wrote entries that didn't change")
+	}
+}
+
+func TestLoadSkipsBadLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "z")
+	data := "/a|2|1700000000\nno fields\n|1|1700000000\n/b|x|1700000000\n/c|1|x\n/d|1.5|1700000000\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(s.Ranked(nil)), []string{"/a", "/d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Ranked = %q, want %q", got, want)
+	}
+}
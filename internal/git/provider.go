@@ -0,0 +1,205 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/devenjarvis/sushi/internal/hint"
+)
+
+// How long the status of a working tree stays cached, while its index
+// doesn't change, and how long git status can take
+const (
+	statusTTL     = 5 * time.Second
+	statusTimeout = 3 * time.Second
+)
+
+// What the arguments of git commands complete
+const (
+	argBranch = 1 << iota
+	argTag
+	argRemoteBranch
+	argRemote
+	argStash
+	argChanged
+	argStaged
+
+	argRef = argBranch | argTag | argRemoteBranch
+)
+
+// kinds are what the argument types of git's spec complete.
+var kinds = map[string]int{
+	"branch":  argBranch,
+	"tag":     argTag,
+	"ref":     argRef,
+	"remote":  argRemote,
+	"stash":   argStash,
+	"changed": argChanged,
+}
+
+// Provider completes the branches, tags, remotes, stash entries and
+// changed files git commands take, and the aliases configured as
+// subcommands. All but the changed files are read from the repository,
+// which is fast enough for every key typed.
+//
+// What an argument completes is found from its type in git's spec, so
+// that the commands and flags taking them are only listed there.
+type Provider struct {
+	argType func(line hint.Line) string
+
+	// status holds the changes in each working tree, while its index is
+	// modified at the same time
+	status *hint.Cache[[]Change]
+}
+
+// New returns a provider for the repositories completed in, with argType
+// returning the type the spec gives the argument completed.
+func New(argType func(line hint.Line) string) *Provider {
+	return &Provider{argType: argType, status: hint.NewCache[[]Change](statusTTL, statusTimeout)}
+}
+
+// Complete offers what the argument of the git command typed can be.
+func (p *Provider) Complete(ctx context.Context, line hint.Line) []hint.Candidate {
+	if len(line.Args) == 0 || filepath.Base(line.Args[0]) != "git" || strings.HasPrefix(line.Typed, "-") {
+		return nil
+	}
+
+	// Skip the options before the command, such as -C to run in another
+	// directory
+	dir, words := line.Dir, line.Args[1:]
+	for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+		switch {
+		case words[0] == "-C" && len(words) > 1:
+			dir = abs(dir, words[1])
+			words = words[1:]
+		case words[0] == "-c" && len(words) > 1:
+			words = words[1:]
+		}
+		words = words[1:]
+	}
+	repo, ok := Find(dir)
+	if !ok {
+		return nil
+	}
+	if len(words) == 0 {
+		return aliasCandidates(repo, line.Typed)
+	}
+
+	what := kinds[p.argType(line)]
+	if what == argChanged && words[0] == "restore" && (slices.Contains(words, "--staged") || slices.Contains(words, "-S")) {
+		what = argStaged
+	}
+
+	var candidates []hint.Candidate
+	add := func(text, desc string) {
+		if score, ok := hint.Match(line.Typed, text); ok {
+			candidates = append(candidates, hint.Candidate{Text: text, Description: desc, Kind: hint.KindValue, Score: score + hint.ProviderBonus})
+		}
+	}
+	if what&argBranch != 0 {
+		for _, name := range repo.Refs("refs/heads/") {
+			add(name, "branch")
+		}
+	}
+	if what&argTag != 0 {
+		for _, name := range repo.Refs("refs/tags/") {
+			add(name, "tag")
+		}
+	}
+	if what&argRemoteBranch != 0 {
+		for _, name := range repo.Refs("refs/remotes/") {
+			add(name, "remote branch")
+		}
+	}
+	if what&argRemote != 0 {
+		for _, name := range repo.Remotes() {
+			add(name, "remote")
+		}
+	}
+	if what&argStash != 0 {
+		for _, s := range repo.Stashes() {
+			add(s.Name, s.Message)
+		}
+	}
+	if what&(argChanged|argStaged) != 0 {
+		candidates = append(candidates, p.changeCandidates(ctx, repo, dir, line.Typed, what == argStaged)...)
+	}
+	return candidates
+}
+
+// aliasCandidates returns the aliases configured that match what's typed,
+// as subcommands.
+func aliasCandidates(repo *Repo, typed string) []hint.Candidate {
+	var candidates []hint.Candidate
+	for name, command := range repo.Aliases() {
+		if score, ok := hint.Match(typed, name); ok {
+			candidates = append(candidates, hint.Candidate{Text: name, Description: command, Kind: hint.KindSubcommand, Score: score + hint.ProviderBonus})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Text < candidates[j].Text })
+	return candidates
+}
+
+// changeCandidates returns the files changed in the working tree, or in
+// the index if staged, as paths relative to dir.
+func (p *Provider) changeCandidates(ctx context.Context, repo *Repo, dir, typed string, staged bool) []hint.Candidate {
+	var candidates []hint.Candidate
+	for _, c := range p.changes(ctx, repo) {
+		status := c.Worktree
+		if staged {
+			status = c.Index
+		}
+		if status == ' ' || staged && status == '?' {
+			continue
+		}
+		path, err := filepath.Rel(dir, filepath.Join(repo.Root, c.Path))
+		// Names that would need quoting are left to the file completions
+		if err != nil || strings.ContainsAny(path, " \t\n\"'\\$`&|;<>()*?[]{}#!~") {
+			continue
+		}
+		if strings.HasSuffix(c.Path, "/") {
+			path += "/"
+		}
+		if score, ok := hint.Match(typed, path); ok {
+			candidates = append(candidates, hint.Candidate{Text: path, Description: describe(status), Kind: hint.KindFile, Score: score + hint.ProviderBonus})
+		}
+	}
+	return candidates
+}
+
+func describe(status byte) string {
+	switch status {
+	case 'M':
+		return "modified"
+	case 'A':
+		return "added"
+	case 'D':
+		return "deleted"
+	case 'R':
+		return "renamed"
+	case 'C':
+		return "copied"
+	case 'T':
+		return "type changed"
+	case 'U':
+		return "unmerged"
+	case '?':
+		return "untracked"
+	}
+	return ""
+}
+
+// changes returns the status of the working tree, which is kept for a
+// while so git doesn't run again for every letter typed.
+func (p *Provider) changes(ctx context.Context, repo *Repo) []Change {
+	var modTime int64
+	if info, err := os.Stat(filepath.Join(repo.Dir, "index")); err == nil {
+		modTime = info.ModTime().UnixNano()
+	}
+	return p.status.Get(ctx, repo.Root, modTime, repo.Status)
+}
@@ -0,0 +1,58 @@
+package git
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/devenjarvis/sushi/internal/hint"
+)
+
+func TestComplete(t *testing.T) {
+	root := fixture(t)
+	types := map[string]string{
+		"switch":   "branch",
+		"checkout": "ref",
+		"push":     "remote",
+		"tag":      "tag",
+		"drop":     "stash",
+	}
+	p := New(func(line hint.Line) string {
+		return types[line.Args[len(line.Args)-1]]
+	})
+
+	tests := []struct {
+		args  []string
+		typed string
+		want  []string
+	}{
+		{[]string{"git"}, "", []string{"co", "st"}},
+		{[]string{"git", "switch"}, "", []string{"feature/login", "main", "old"}},
+		{[]string{"git", "switch"}, "fl", []string{"feature/login"}},
+		{[]string{"git", "checkout"}, "main", []string{"main", "origin/main", "upstream/main"}},
+		{[]string{"git", "push"}, "", []string{"origin", "upstream"}},
+		{[]string{"git", "tag"}, "", []string{"v1.0", "v1.1"}},
+		{[]string{"git", "stash", "drop"}, "", []string{"stash@{0}", "stash@{1}"}},
+		{[]string{"git", "status"}, "", nil},
+		{[]string{"git", "switch"}, "-", nil},
+		{[]string{"ls"}, "", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, c := range p.Complete(context.Background(), hint.Line{Args: tt.args, Typed: tt.typed, Dir: root}) {
+			got = append(got, c.Text)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Complete(%q, %q) = %q, want %q", tt.args, tt.typed, got, tt.want)
+		}
+	}
+}
+
+func TestCompleteOutsideRepo(t *testing.T) {
+	p := New(func(hint.Line) string { return "branch" })
+	if got := p.Complete(context.Background(), hint.Line{Args: []string{"git", "switch"}, Dir: t.TempDir()}); got != nil {
+		t.Errorf("Complete outside a repository = %v, want none", got)
+	}
+}
@@ -0,0 +1,262 @@
+// Package git reads what completions and the prompt show about git
+// repositories from their .git directory, only running git for the status
+// of the working tree.
+package git
+
+import (
+	"bufio"
+	"context"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Repo is a git repository.
+type Repo struct {
+	// Root is the top of the working tree
+	Root string
+
+	// Dir is the git directory, and Common the directory of the refs it
+	// shares with other working trees, which are the same unless it's one
+	// added by git worktree
+	Dir    string
+	Common string
+}
+
+// Find returns the repository dir is in, looking for .git in its parents.
+func Find(dir string) (*Repo, bool) {
+	for {
+		gitPath := filepath.Join(dir, ".git")
+		if info, err := os.Stat(gitPath); err == nil {
+			r := &Repo{Root: dir, Dir: gitPath, Common: gitPath}
+			if !info.IsDir() {
+				// A working tree or submodule, with its git directory
+				// elsewhere
+				data, err := os.ReadFile(gitPath)
+				link, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+				if err != nil || !ok {
+					return nil, false
+				}
+				r.Dir, r.Common = abs(dir, link), abs(dir, link)
+			}
+			if data, err := os.ReadFile(filepath.Join(r.Dir, "commondir")); err == nil {
+				r.Common = abs(r.Dir, strings.TrimSpace(string(data)))
+			}
+			return r, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, false
+		}
+		dir = parent
+	}
+}
+
+func abs(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(dir, path)
+}
+
+// Head returns the branch checked out, or the abbreviated commit if none
+// is.
+func (r *Repo) Head() string {
+	data, err := os.ReadFile(filepath.Join(r.Dir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	head := strings.TrimSpace(string(data))
+	if ref, ok := strings.CutPrefix(head, "ref: "); ok {
+		return strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if len(head) > 7 {
+		head = head[:7]
+	}
+	return head
+}
+
+// State returns the operation in progress in the working tree, such as
+// "merging" or "rebasing", if any.
+func (r *Repo) State() string {
+	for _, s := range []struct{ file, state string }{
+		{"rebase-merge", "rebasing"},
+		{"rebase-apply", "rebasing"},
+		{"MERGE_HEAD", "merging"},
+		{"CHERRY_PICK_HEAD", "cherry-picking"},
+		{"REVERT_HEAD", "reverting"},
+		{"BISECT_LOG", "bisecting"},
+	} {
+		if _, err := os.Stat(filepath.Join(r.Dir, s.file)); err == nil {
+			return s.state
+		}
+	}
+	return ""
+}
+
+// Refs returns the short names of the refs under prefix, such as
+// "refs/heads/", both loose and packed, in order.
+func (r *Repo) Refs(prefix string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(ref string) {
+		name := strings.TrimPrefix(ref, prefix)
+		if !seen[name] && !strings.HasSuffix(name, "/HEAD") {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	root := filepath.Join(r.Common, filepath.FromSlash(prefix))
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !strings.HasSuffix(path, ".lock") {
+			rel, _ := filepath.Rel(root, path)
+			add(prefix + filepath.ToSlash(rel))
+		}
+		return nil
+	})
+
+	if f, err := os.Open(filepath.Join(r.Common, "packed-refs")); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// Lines are a commit and a ref, except for comments and the
+			// commits annotated tags point to
+			_, ref, ok := strings.Cut(scanner.Text(), " ")
+			if ok && strings.HasPrefix(ref, prefix) {
+				add(ref)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Remotes returns the names of the remotes configured.
+func (r *Repo) Remotes() []string {
+	var names []string
+	for _, s := range r.config() {
+		if s.name == "remote" && s.sub != "" && !slices.Contains(names, s.sub) {
+			names = append(names, s.sub)
+		}
+	}
+	return names
+}
+
+// Aliases returns the aliases of git commands configured in the
+// repository, by name.
+func (r *Repo) Aliases() map[string]string {
+	aliases := make(map[string]string)
+	for _, s := range r.config() {
+		if s.name == "alias" {
+			for k, v := range s.values {
+				aliases[k] = v
+			}
+		}
+	}
+	return aliases
+}
+
+// Stash is an entry of the stash.
+type Stash struct {
+	Name    string
+	Message string
+}
+
+// Stashes returns the entries of the stash, the latest first.
+func (r *Repo) Stashes() []Stash {
+	data, err := os.ReadFile(filepath.Join(r.Common, "logs", "refs", "stash"))
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var stashes []Stash
+	for i := len(lines) - 1; i >= 0; i-- {
+		// The reflog has the commits and the author before a tab, then the
+		// message
+		_, message, _ := strings.Cut(lines[i], "\t")
+		stashes = append(stashes, Stash{Name: "stash@{" + strconv.Itoa(len(stashes)) + "}", Message: message})
+	}
+	return stashes
+}
+
+// section is a section of a git config file, such as [remote "origin"].
+type section struct {
+	name, sub string
+	values    map[string]string
+}
+
+// config returns the sections of the repository's config file, without
+// following includes.
+func (r *Repo) config() []section {
+	f, err := os.Open(filepath.Join(r.Common, "config"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var sections []section
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[':
+			header := strings.Trim(line, "[]")
+			name, sub, _ := strings.Cut(header, " ")
+			sections = append(sections, section{
+				name:   strings.ToLower(name),
+				sub:    strings.Trim(sub, `"`),
+				values: make(map[string]string),
+			})
+		case len(sections) > 0:
+			key, value, _ := strings.Cut(line, "=")
+			sections[len(sections)-1].values[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	return sections
+}
+
+// Change is a file changed in the working tree or the index.
+type Change struct {
+	// Path is relative to the top of the working tree
+	Path string
+
+	// Index and Worktree are the status of the file in each, as in the
+	// short format of git status: ' ' for unchanged, 'M' for modified, '?'
+	// for untracked and so on
+	Index, Worktree byte
+}
+
+// Status runs git status for the changes in the working tree.
+func (r *Repo) Status(ctx context.Context) ([]Change, error) {
+	cmd := exec.CommandContext(ctx, "git", "status", "--porcelain", "-z")
+	cmd.Dir = r.Root
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseStatus(string(out)), nil
+}
+
+// parseStatus returns the changes listed by git status --porcelain -z.
+func parseStatus(out string) []Change {
+	var changes []Change
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		changes = append(changes, Change{Path: entry[3:], Index: entry[0], Worktree: entry[1]})
+		if entry[0] == 'R' || entry[0] == 'C' {
+			// Followed by the path it was renamed or copied from
+			i++
+		}
+	}
+	return changes
+}
@@ -0,0 +1,156 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFiles writes files with their contents under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// fixture returns the root of a repository with a few branches, tags,
+// remotes, stash entries and aliases.
+func fixture(t *testing.T) string {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".git/HEAD":                     "ref: refs/heads/main\n",
+		".git/refs/heads/main":          "1111111111111111111111111111111111111111\n",
+		".git/refs/heads/feature/login": "2222222222222222222222222222222222222222\n",
+		".git/refs/heads/main.lock":     "",
+		".git/refs/remotes/origin/HEAD": "ref: refs/remotes/origin/main\n",
+		".git/refs/remotes/origin/main": "1111111111111111111111111111111111111111\n",
+		".git/refs/tags/v1.1":           "3333333333333333333333333333333333333333\n",
+		".git/logs/refs/stash":          "0000 4444 A U Thor <a@example.com> 1700000000 +0000\tWIP on main: first\n4444 5555 A U Thor <a@example.com> 1700000100 +0000\tOn main: second\n",
+		"sub/dir/file.go":               "",
+		".git/packed-refs": `# pack-refs with: peeled fully-peeled sorted
+1111111111111111111111111111111111111111 refs/heads/main
+6666666666666666666666666666666666666666 refs/heads/old
+7777777777777777777777777777777777777777 refs/tags/v1.0
+^8888888888888888888888888888888888888888
+9999999999999999999999999999999999999999 refs/remotes/upstream/main
+`,
+		".git/config": `[core]
+	bare = false
+[remote "origin"]
+	url = https://example.com/a.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+[remote "upstream"]
+	url = https://example.com/b.git
+; a comment
+[alias]
+	co = checkout
+	St = status -sb
+`,
+	})
+	return root
+}
+
+func TestFind(t *testing.T) {
+	root := fixture(t)
+	r, ok := Find(filepath.Join(root, "sub", "dir"))
+	if !ok || r.Root != root || r.Dir != filepath.Join(root, ".git") || r.Common != r.Dir {
+		t.Fatalf("Find = %+v, %v; want the repository at %s", r, ok, root)
+	}
+	if _, ok := Find(t.TempDir()); ok {
+		t.Errorf("Find outside a repository succeeded")
+	}
+}
+
+func TestFindWorktree(t *testing.T) {
+	root := fixture(t)
+	wt := t.TempDir()
+	writeFiles(t, wt, map[string]string{".git": "gitdir: " + filepath.Join(root, ".git", "worktrees", "wt") + "\n"})
+	writeFiles(t, root, map[string]string{
+		".git/worktrees/wt/HEAD":      "ref: refs/heads/feature/login\n",
+		".git/worktrees/wt/commondir": "../..\n",
+	})
+
+	r, ok := Find(wt)
+	if !ok || r.Dir != filepath.Join(root, ".git", "worktrees", "wt") || r.Common != filepath.Join(root, ".git") {
+		t.Fatalf("Find = %+v, %v; want the worktree sharing %s", r, ok, filepath.Join(root, ".git"))
+	}
+	if got := r.Head(); got != "feature/login" {
+		t.Errorf("Head = %q, want feature/login", got)
+	}
+	if got := r.Refs("refs/heads/"); !reflect.DeepEqual(got, []string{"feature/login", "main", "old"}) {
+		t.Errorf("Refs = %q, want those of the main working tree", got)
+	}
+}
+
+func TestHead(t *testing.T) {
+	root := fixture(t)
+	r, _ := Find(root)
+	if got := r.Head(); got != "main" {
+		t.Errorf("Head = %q, want main", got)
+	}
+	writeFiles(t, root, map[string]string{".git/HEAD": "1234567890abcdef1234567890abcdef12345678\n"})
+	if got := r.Head(); got != "1234567" {
+		t.Errorf("detached Head = %q, want 1234567", got)
+	}
+	writeFiles(t, root, map[string]string{".git/MERGE_HEAD": ""})
+	if got := r.State(); got != "merging" {
+		t.Errorf("State = %q, want merging", got)
+	}
+}
+
+func TestRefs(t *testing.T) {
+	r, _ := Find(fixture(t))
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"refs/heads/", []string{"feature/login", "main", "old"}},
+		{"refs/tags/", []string{"v1.0", "v1.1"}},
+		{"refs/remotes/", []string{"origin/main", "upstream/main"}},
+	}
+	for _, tt := range tests {
+		if got := r.Refs(tt.prefix); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Refs(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	r, _ := Find(fixture(t))
+	if got, want := r.Remotes(), []string{"origin", "upstream"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Remotes = %q, want %q", got, want)
+	}
+	if got, want := r.Aliases(), map[string]string{"co": "checkout", "st": "status -sb"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Aliases = %q, want %q", got, want)
+	}
+}
+
+func TestStashes(t *testing.T) {
+	r, _ := Find(fixture(t))
+	want := []Stash{{"stash@{0}", "On main: second"}, {"stash@{1}", "WIP on main: first"}}
+	if got := r.Stashes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stashes = %q, want %q", got, want)
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	out := " M a.go\x00R  new name.go\x00old name.go\x00?? dir/\x00MM b.go\x00C  copy.go\x00orig.go\x00"
+	want := []Change{
+		{"a.go", ' ', 'M'},
+		{"new name.go", 'R', ' '},
+		{"dir/", '?', '?'},
+		{"b.go", 'M', 'M'},
+		{"copy.go", 'C', ' '},
+	}
+	if got := parseStatus(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseStatus = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,88 @@
+package hint
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache keeps what providers find by running commands for a while, so that
+// the commands don't run again for every letter typed.
+type Cache[T any] struct {
+	ttl     time.Duration
+	timeout time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry[T]
+	// pending holds the keys whose values are being found, closed when
+	// they are
+	pending map[string]chan struct{}
+}
+
+type cacheEntry[T any] struct {
+	time    time.Time
+	version int64
+	value   T
+}
+
+// NewCache returns a cache keeping values for ttl, found by commands that
+// can take up to timeout.
+func NewCache[T any](ttl, timeout time.Duration) *Cache[T] {
+	return &Cache[T]{
+		ttl:     ttl,
+		timeout: timeout,
+		entries: make(map[string]cacheEntry[T]),
+		pending: make(map[string]chan struct{}),
+	}
+}
+
+// Get returns the value kept for key, unless it's older than the TTL or
+// was kept for another version, such as the modification time of a file it
+// depends on. Otherwise it's found again with find, which is given until
+// the timeout, waiting for it until ctx is done.
+//
+// The value is found apart from ctx, so that typing on doesn't stop it,
+// and once for all the callers waiting for it. A value find fails to get,
+// even by running out of time, is kept as the zero value, so that a
+// command failing or too slow isn't run again until the TTL is over.
+func (c *Cache[T]) Get(ctx context.Context, key string, version int64, find func(ctx context.Context) (T, error)) T {
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && time.Since(e.time) < c.ttl && e.version == version {
+		c.mu.Unlock()
+		return e.value
+	}
+	done, ok := c.pending[key]
+	if !ok {
+		done = make(chan struct{})
+		c.pending[key] = done
+		go c.find(key, version, find, done)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-done:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.entries[key].value
+	case <-ctx.Done():
+		var zero T
+		return zero
+	}
+}
+
+// find finds the value of key and keeps it.
+func (c *Cache[T]) find(key string, version int64, find func(ctx context.Context) (T, error), done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	value, err := find(ctx)
+	if err != nil {
+		var zero T
+		value = zero
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry[T]{time.Now(), version, value}
+	delete(c.pending, key)
+	close(done)
+}
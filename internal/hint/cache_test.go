@@ -0,0 +1,91 @@
+package hint
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	c := NewCache[int](time.Hour, time.Second)
+	calls := 0
+	find := func(n int, err error) func(context.Context) (int, error) {
+		return func(context.Context) (int, error) {
+			calls++
+			return n, err
+		}
+	}
+	ctx := context.Background()
+
+	steps := []struct {
+		key     string
+		version int64
+		find    func(context.Context) (int, error)
+		want    int
+		calls   int
+	}{
+		{"a", 0, find(1, nil), 1, 1},
+		{"a", 0, find(2, nil), 1, 1},            // kept
+		{"b", 0, find(3, nil), 3, 2},            // another key
+		{"a", 1, find(4, nil), 4, 3},            // another version
+		{"a", 1, find(5, nil), 4, 3},            // kept for that version
+		{"c", 0, find(6, errors.New("")), 0, 4}, // failed
+		{"c", 0, find(7, nil), 0, 4},            // kept failing
+	}
+	for i, s := range steps {
+		if got := c.Get(ctx, s.key, s.version, s.find); got != s.want || calls != s.calls {
+			t.Errorf("step %d: Get(%q, %v) = %d after %d calls, want %d after %d", i, s.key, s.version, got, calls, s.want, s.calls)
+		}
+	}
+}
+
+func TestCacheExpires(t *testing.T) {
+	c := NewCache[int](time.Millisecond, time.Second)
+	c.Get(context.Background(), "a", 0, func(context.Context) (int, error) { return 1, nil })
+	time.Sleep(2 * time.Millisecond)
+	if got := c.Get(context.Background(), "a", 0, func(context.Context) (int, error) { return 2, nil }); got != 2 {
+		t.Errorf("Get after the TTL = %d, want 2", got)
+	}
+}
+
+func TestCacheTimeout(t *testing.T) {
+	c := NewCache[int](time.Hour, 10*time.Millisecond)
+	slow := func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 1, ctx.Err()
+	}
+	if got := c.Get(context.Background(), "a", 0, slow); got != 0 {
+		t.Errorf("Get timing out = %d, want 0", got)
+	}
+	// Kept failing, so the command isn't run again
+	if got := c.Get(context.Background(), "a", 0, func(context.Context) (int, error) { return 2, nil }); got != 0 {
+		t.Errorf("Get after a timeout = %d, want 0", got)
+	}
+}
+
+func TestCacheCanceled(t *testing.T) {
+	c := NewCache[int](time.Hour, time.Second)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	find := func(context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 1, nil
+	}
+
+	// Typing on cancels the callers, but not the command they wait for
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := c.Get(ctx, "a", 0, find); got != 0 {
+		t.Errorf("Get canceled = %d, want 0", got)
+	}
+	if got := c.Get(ctx, "a", 0, find); got != 0 {
+		t.Errorf("Get canceled again = %d, want 0", got)
+	}
+	close(release)
+	if got := c.Get(context.Background(), "a", 0, find); got != 1 || calls.Load() != 1 {
+		t.Errorf("Get = %d after %d calls, want 1 after 1", got, calls.Load())
+	}
+}
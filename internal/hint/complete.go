@@ -0,0 +1,250 @@
+package hint
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// Env is what completing a word depends on besides the input.
+type Env struct {
+	// Dir is the directory relative paths are completed in
+	Dir string
+
+	// Var returns the value of a shell variable, which paths can start
+	// with. HOME is used for ~.
+	Var func(name string) (string, bool)
+}
+
+// SetEnv sets what completions depend on besides the input.
+func (m *Model) SetEnv(env Env) {
+	m.env = env
+}
+
+// SetRanker sets what boosts the candidates found.
+func (m *Model) SetRanker(r Ranker) {
+	m.ranker = r
+}
+
+// commandProvider completes command names where a command goes.
+type commandProvider struct {
+	mu       sync.Mutex
+	commands []string
+	matcher  *matcher
+}
+
+func newCommandProvider(commands []string) *commandProvider {
+	return &commandProvider{commands: commands}
+}
+
+func (p *commandProvider) Complete(ctx context.Context, line Line) []Candidate {
+	if !isCommandWord(line) || line.Typed == "" || strings.ContainsRune(line.Typed, '/') {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// The index is only built once a command is typed
+	if p.matcher == nil {
+		p.matcher = newMatcher(p.commands)
+	}
+
+	var candidates []Candidate
+	for _, i := range p.matcher.find(line.Typed, maxHints) {
+		score, _ := Match(line.Typed, p.commands[i])
+		candidates = append(candidates, Candidate{Text: p.commands[i], Kind: KindCommand, Score: score})
+	}
+	return candidates
+}
+
+func isCommandWord(line Line) bool {
+	return line.Word.Class == syntax.ClassCommand || line.Word.Class == syntax.ClassKeyword
+}
+
+// fileProvider completes the files and directories a path being typed
+// could name, or only the directories and executables where a command
+// goes. The candidates are the names in the directory, replacing the word
+// with the path completed, so that the directory is kept as typed.
+type fileProvider struct{}
+
+func (fileProvider) Complete(ctx context.Context, line Line) []Candidate {
+	command := isCommandWord(line)
+	typed := line.Typed
+	switch {
+	case command && !strings.ContainsRune(typed, '/'):
+		return nil
+	case !command && line.Word.Class != syntax.ClassArgument:
+		return nil
+	}
+
+	dirTyped, base := "", typed
+	if i := strings.LastIndex(typed, "/"); i >= 0 {
+		dirTyped, base = typed[:i+1], typed[i+1:]
+	} else if strings.HasPrefix(typed, "~") {
+		// A home directory, which needs a / to be completed in
+		if typed == "~" {
+			return []Candidate{{Text: "~/", Kind: KindDir}}
+		}
+		return nil
+	}
+
+	// A quote opened in the directory may still be open in the name
+	dir, dirQuote := line.expand(dirTyped)
+	path, quote := line.expand(typed)
+	base = strings.TrimPrefix(path, dir)
+	if quote != 0 && quote != dirQuote {
+		// The quote opened before the name is kept
+		dirTyped += string(quote)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(line.Dir, dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var candidates []Candidate
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		name := e.Name()
+		// Hidden files are only completed once a . is typed
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		score, ok := Match(base, name)
+		if !ok {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if command && !info.IsDir() && info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+
+		c := Candidate{Text: name, Value: dirTyped + escape(name, quote), Kind: KindFile, Score: score}
+		switch {
+		case info.IsDir():
+			c.Text += "/"
+			c.Value += "/"
+			c.Kind = KindDir
+		case quote != 0:
+			c.Value += string(quote)
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+// expand returns a word with a leading ~ replaced by the home directory,
+// variables replaced by their values, and quotes removed. It also returns
+// the quote left open at the end of the word, if any.
+func (l Line) expand(word string) (string, rune) {
+	if strings.HasPrefix(word, "~") {
+		name, rest, slash := strings.Cut(word, "/")
+		if home, ok := l.home(name[1:]); ok {
+			word = home
+			if slash {
+				word = home + "/" + rest
+			}
+		}
+	}
+
+	var b strings.Builder
+	var quote rune
+	runes := []rune(word)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'' && c == '\'':
+			quote = 0
+		case quote == '\'':
+			b.WriteRune(c)
+		case c == '\\' && i+1 < len(runes):
+			i++
+			b.WriteRune(runes[i])
+		case c == '"' && quote == '"':
+			quote = 0
+		case (c == '"' || c == '\'') && quote == 0:
+			quote = c
+		case c == '$':
+			name, n := varName(runes[i+1:])
+			if name == "" {
+				b.WriteRune(c)
+				break
+			}
+			b.WriteString(l.Var(name))
+			i += n
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String(), quote
+}
+
+// home returns the home directory of a user, or of the current one if name
+// is empty.
+func (l Line) home(name string) (string, bool) {
+	if name == "" {
+		if home := l.Var("HOME"); home != "" {
+			return home, true
+		}
+		home, err := os.UserHomeDir()
+		return home, err == nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", false
+	}
+	return u.HomeDir, true
+}
+
+// varName returns the name of the variable at the start of s, after a $,
+// as $NAME or ${NAME}, and the number of runes it takes.
+func varName(s []rune) (string, int) {
+	if len(s) > 0 && s[0] == '{' {
+		for i, c := range s {
+			if c == '}' {
+				return string(s[1:i]), i + 1
+			}
+		}
+		return "", 0
+	}
+	n := 0
+	for n < len(s) && (s[n] == '_' || unicode.IsLetter(s[n]) || n > 0 && unicode.IsDigit(s[n])) {
+		n++
+	}
+	return string(s[:n]), n
+}
+
+// escape quotes a name completed in a word, for the quote open at the end
+// of the word if any.
+func escape(name string, quote rune) string {
+	var b strings.Builder
+	for _, c := range name {
+		switch {
+		case quote == '\'' && c == '\'':
+			b.WriteString(`'\''`)
+		case quote == '\'':
+			b.WriteRune(c)
+		case quote == '"' && strings.ContainsRune(`"\$`+"`", c):
+			b.WriteRune('\\')
+			b.WriteRune(c)
+		case quote == 0 && (unicode.IsSpace(c) || strings.ContainsRune(`"'\$`+"`&|;<>()*?[]{}#!~", c)):
+			b.WriteRune('\\')
+			b.WriteRune(c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
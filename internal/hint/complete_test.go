@@ -0,0 +1,144 @@
+package hint
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// completeDir returns a directory of files to complete, and the
+// environment completing in it, with HOME there and $SRC its src.
+func completeDir(t *testing.T) (string, Env) {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]os.FileMode{
+		"main.go":     0o644,
+		"my file.txt": 0o644,
+		".hidden":     0o644,
+		"src/app.go":  0o644,
+		"bin/run":     0o755,
+		"bin/data":    0o644,
+	}
+	for name, mode := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, nil, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vars := map[string]string{"HOME": dir, "SRC": filepath.Join(dir, "src")}
+	return dir, Env{Dir: dir, Var: func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}}
+}
+
+// completeAt returns a model with the candidates of the command and file
+// providers for the cursor at pos in value, or at its end if pos is -1.
+func completeAt(value string, pos int, env Env) Model {
+	if pos < 0 {
+		pos = len([]rune(value))
+	}
+	m := New([]string{"make", "mkdir"})
+	m.line = newLine(value, pos, env)
+	m.matchString = value
+	for _, p := range m.providers() {
+		m.merge(p.Complete(context.Background(), m.line))
+	}
+	return m
+}
+
+func TestComplete(t *testing.T) {
+	_, env := completeDir(t)
+	tests := []struct {
+		value string
+		pos   int
+		pick  string
+		want  string
+		cur   int
+	}{
+		{"cat ma", -1, "main.go", "cat main.go", 11},
+		// Only the word at the cursor is replaced, up to the cursor
+		{"cat ma | wc -l", 6, "main.go", "cat main.go | wc -l", 11},
+		{"cp ma dst", 5, "main.go", "cp main.go dst", 10},
+		{"ls; cat ma", -1, "main.go", "ls; cat main.go", 15},
+		{"ma", -1, "make", "make", 4},
+		{"cd && ma", -1, "make", "cd && make", 10},
+		// Directories keep the cursor in them, and what's typed of the
+		// directory stays as it was
+		{"cat s", -1, "src/", "cat src/", 8},
+		{"cat src/a", -1, "app.go", "cat src/app.go", 14},
+		{"cat ./src/a", -1, "app.go", "cat ./src/app.go", 16},
+		// Names are escaped for the quote open, which is closed after files
+		{"cat my", -1, "my file.txt", `cat my\ file.txt`, 16},
+		{`cat "my`, -1, "my file.txt", `cat "my file.txt"`, 17},
+		{`cat 'my`, -1, "my file.txt", `cat 'my file.txt'`, 17},
+		{`cat "src/a`, -1, "app.go", `cat "src/app.go"`, 16},
+		// ~ and variables are expanded to look in, but kept in the word
+		{"cat ~/ma", -1, "main.go", "cat ~/main.go", 13},
+		{"cat ~", -1, "~/", "cat ~/", 6},
+		{"cat $SRC/a", -1, "app.go", "cat $SRC/app.go", 15},
+		{"cat ${SRC}/a", -1, "app.go", "cat ${SRC}/app.go", 17},
+		{"cat .h", -1, ".hidden", "cat .hidden", 11},
+		// Where a command goes, only directories and what can be run
+		{"./b", -1, "bin/", "./bin/", 6},
+		{"./bin/r", -1, "run", "./bin/run", 9},
+	}
+	for _, tt := range tests {
+		m := completeAt(tt.value, tt.pos, env)
+		i := slices.Index(m.hints, tt.pick)
+		if i < 0 {
+			t.Errorf("hints for %q at %d = %q, want %q", tt.value, tt.pos, m.hints, tt.pick)
+			continue
+		}
+		m.cursor = i
+		if got, cur := m.Complete(tt.value); got != tt.want || cur != tt.cur {
+			t.Errorf("Complete(%q) with %q = %q, %d; want %q, %d", tt.value, tt.pick, got, cur, tt.want, tt.cur)
+		}
+	}
+}
+
+func TestCompleteHints(t *testing.T) {
+	_, env := completeDir(t)
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		// Hidden files only once a . is typed
+		{"cat ", []string{"bin/", "main.go", "my file.txt", "src/"}},
+		{"cat .h", []string{".hidden"}},
+		{"cat h", nil},
+		{"./bin/", []string{"run"}},
+		{"cat bin/", []string{"data", "run"}},
+		{"cat missing/", nil},
+		{"cat zz", nil},
+		// Commands aren't files without a /
+		{"mk", []string{"mkdir", "make"}},
+		{"echo mk", nil},
+		{"cat ~nosuchuser/", nil},
+	}
+	for _, tt := range tests {
+		m := completeAt(tt.value, -1, env)
+		got := slices.Clone(m.hints)
+		if tt.value != "mk" {
+			slices.Sort(got)
+		}
+		if len(got) == 0 {
+			got = nil
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("hints for %q = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCompleteStale(t *testing.T) {
+	_, env := completeDir(t)
+	m := completeAt("cat ma", -1, env)
+	// The hints are for another value than the one being completed
+	if got, cur := m.Complete("cat mai"); got != "cat mai" || cur != 6 {
+		t.Errorf("Complete of a changed value = %q, %d; want it unchanged", got, cur)
+	}
+}
@@ -1,28 +1,80 @@
 package hint
 
 import (
-	"fmt"
+	"context"
 	"sort"
+	"strings"
+	"sync"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/lipgloss"
 	"github.com/lithammer/fuzzysearch/fuzzy"
 )
 
+// Internal ID management, so that results only go to the model that asked
+var (
+	lastID int
+	idMtx  sync.Mutex
+)
+
+// Return the next ID we should use on the Model.
+func nextID() int {
+	idMtx.Lock()
+	defer idMtx.Unlock()
+	lastID++
+	return lastID
+}
+
 type switchMsg struct{}
 
+// maxHints is the most hints found for a value, which the menu scrolls
+// through.
+const maxHints = 100
+
+// Rows shown at once by the menu, unless Height is set, and hints in
+// compact mode
+const (
+	menuHeight   = 8
+	compactHints = 5
+)
+
 type Model struct {
+	// Compact shows the hints in a row, chosen with Left and Right,
+	// instead of a menu below the prompt, chosen with Up and Down
+	Compact bool
+
+	// Height is how many rows of the menu are shown at once
+	Height int
+
 	focus       bool
 	activated   bool
 	accepted    bool
 	cursor      int
+	offset      int
 	matchString string
 	choices     []string
 	hints       []string
-	selected    string
+
+	// The providers of candidates, besides the commands and files, the
+	// environment they complete in and what ranks their candidates
+	commands *commandProvider
+	extra    []Provider
+	env      Env
+	ranker   Ranker
+
+	// line is what the providers last completed, results what they found
+	// so far and candidates those shown as hints. seq counts the lines
+	// completed, and cancel stops the providers completing the last one.
+	id         int
+	seq        int
+	cancel     context.CancelFunc
+	line       Line
+	results    []Candidate
+	candidates []Candidate
 }
 
-func New(choices []string) Model {
+// New returns a model hinting choices as commands, files and directories
+// as arguments, and the candidates found by any other providers.
+func New(choices []string, providers ...Provider) Model {
 	return Model{
 		focus:     false,
 		activated: false,
@@ -30,10 +82,27 @@ func New(choices []string) Model {
 		cursor:    0,
 		choices:   choices,
 		hints:     []string{},
-		selected:  "",
+		commands:  newCommandProvider(choices),
+		extra:     providers,
+		id:        nextID(),
 	}
 }
 
+// providers returns all the providers of candidates.
+func (m *Model) providers() []Provider {
+	return append([]Provider{m.commands, fileProvider{}}, m.extra...)
+}
+
+// SetChoices replaces the commands hinted, updating the hints shown for the
+// current value.
+func (m *Model) SetChoices(choices []string) tea.Cmd {
+	m.choices = choices
+	m.commands = newCommandProvider(choices)
+	value := m.matchString
+	m.matchString = ""
+	return m.UpdateHintOptions(value, m.line.Pos)
+}
+
 func (m *Model) GetCursor() int {
 	return m.cursor
 }
@@ -61,37 +130,32 @@ func (m *Model) Blur() {
 
 func (m *Model) Clear() {
 	m.hints = []string{}
+	m.candidates = nil
+	if m.cancel != nil {
+		m.cancel()
+	}
+	// Results still on their way are dropped
+	m.seq++
 }
 
 func (m *Model) AcceptHint() {
 	m.accepted = true
 }
 
-func (m *Model) UpdateHintOptions(value string) {
-	if value != m.matchString {
-		m.matchString = value
-		m.accepted = false
-		m.hints = []string{}
-		// Check for hint
-		if len(value) > 0 {
-			// Find matches
-			matches := fuzzy.RankFind(string(value), m.choices)
-
-			// Show hint if available
-			if len(matches) > 0 {
-				m.hints = []string{}
-				sort.Sort(matches)
-				for i, match := range matches {
-					if i <= 4 && match.Distance <= (len(value)+1) {
-						m.hints = append(m.hints, match.Target)
-					} else {
-						break
-					}
-				}
-			}
-		}
-		m.cursor = 0
+// UpdateHintOptions starts finding the hints for the word before the
+// cursor, at rune offset pos of value. The providers run in the command
+// returned, and the hints are shown as their results come in.
+func (m *Model) UpdateHintOptions(value string, pos int) tea.Cmd {
+	if value == m.matchString && pos == m.line.Pos {
+		return nil
 	}
+	m.matchString = value
+	m.accepted = false
+	m.hints = []string{}
+	m.candidates = nil
+	m.cursor, m.offset = 0, 0
+	m.line = newLine(value, pos, m.env)
+	return m.complete(m.line)
 }
 
 func (m Model) Init() tea.Cmd {
@@ -99,6 +163,12 @@ func (m Model) Init() tea.Cmd {
 }
 
 func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	if msg, ok := msg.(resultsMsg); ok {
+		if msg.id == m.id && msg.seq == m.seq {
+			m.merge(msg.candidates)
+		}
+		return m, nil
+	}
 	if !m.focus {
 		return m, nil
 	}
@@ -113,43 +183,82 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 		case tea.KeyCtrlC:
 			return m, tea.Quit
 		case tea.KeyLeft:
-			if m.cursor > 0 {
-				m.cursor--
+			if m.Compact {
+				m.move(-1)
 			}
 		case tea.KeyRight:
-			if m.cursor < len(m.hints)-1 {
-				m.cursor++
+			if m.Compact {
+				m.move(1)
+			}
+		case tea.KeyUp:
+			if !m.Compact {
+				m.move(-1)
+			}
+		case tea.KeyDown:
+			if !m.Compact {
+				m.move(1)
+			}
+		case tea.KeyPgUp:
+			if !m.Compact {
+				m.move(-m.height())
+			}
+		case tea.KeyPgDown:
+			if !m.Compact {
+				m.move(m.height())
 			}
-		case tea.KeyTab:
-			m.selected = m.choices[m.cursor]
-			return m, tea.Quit
 		}
 	}
 
 	return m, nil
 }
 
-func (m Model) View() string {
-	var s string
-	var selectedColor string
+// move moves the cursor by n hints, scrolling to keep it in view.
+func (m *Model) move(n int) {
+	m.cursor = max(0, min(m.cursor+n, len(m.hints)-1))
+	m.scroll()
+}
 
-	if m.focus {
-		selectedColor = "205"
-	} else {
-		selectedColor = "237"
+// scroll moves the hints shown so that the cursor is among them.
+func (m *Model) scroll() {
+	h := m.height()
+	switch {
+	case m.cursor < m.offset:
+		m.offset = m.cursor
+	case m.cursor >= m.offset+h:
+		m.offset = m.cursor - h + 1
 	}
-	selectedText := lipgloss.NewStyle().Background(lipgloss.Color(selectedColor)).Inline(true).Render
-	unSelectedText := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Inline(true).Render
-
-	for i, hint := range m.hints {
-		cursor := " "
-		if m.cursor == i {
-			cursor = " "
-			s += selectedText(fmt.Sprintf("%s%s ", cursor, hint))
-		} else {
-			s += unSelectedText(fmt.Sprintf("%s%s ", cursor, hint))
-		}
+	m.offset = max(0, min(m.offset, len(m.hints)-h))
+}
+
+// height returns how many hints are shown at once.
+func (m Model) height() int {
+	switch {
+	case m.Compact:
+		return compactHints
+	case m.Height > 0:
+		return m.Height
 	}
+	return menuHeight
+}
 
-	return s
+// NewPicker returns a focused model for choosing one of choices, which are
+// all shown as hints, the ones that best fuzzy match value first.
+func NewPicker(choices []string, value string) Model {
+	m := New(choices)
+	m.matchString = value
+	m.focus = true
+
+	picked := make(map[string]bool)
+	matches := fuzzy.RankFindFold(strings.Join(strings.Fields(value), ""), choices)
+	sort.Stable(matches)
+	for _, match := range matches {
+		m.hints = append(m.hints, match.Target)
+		picked[match.Target] = true
+	}
+	for _, choice := range choices {
+		if !picked[choice] {
+			m.hints = append(m.hints, choice)
+		}
+	}
+	return m
 }
@@ -0,0 +1,113 @@
+package hint
+
+import (
+	"fmt"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// menuModel returns a focused model showing n hints, file00 scoring best,
+// for "f" typed.
+func menuModel(n int) Model {
+	m := New(nil)
+	m.line = newLine("f", 1, Env{})
+	var candidates []Candidate
+	for i := 0; i < n; i++ {
+		candidates = append(candidates, Candidate{Text: fmt.Sprintf("file%02d", i), Kind: KindFile, Score: n - i})
+	}
+	m.merge(candidates)
+	m.focus = true
+	return m
+}
+
+func TestMenuScroll(t *testing.T) {
+	tests := []struct {
+		keys   []tea.KeyType
+		cursor int
+		offset int
+	}{
+		{nil, 0, 0},
+		{[]tea.KeyType{tea.KeyDown, tea.KeyDown}, 2, 0},
+		// The menu scrolls once the cursor goes past the last row shown
+		{[]tea.KeyType{tea.KeyDown, tea.KeyDown, tea.KeyDown}, 3, 1},
+		{[]tea.KeyType{tea.KeyDown, tea.KeyDown, tea.KeyDown, tea.KeyUp, tea.KeyUp}, 1, 1},
+		{[]tea.KeyType{tea.KeyDown, tea.KeyDown, tea.KeyDown, tea.KeyUp, tea.KeyUp, tea.KeyUp}, 0, 0},
+		{[]tea.KeyType{tea.KeyUp}, 0, 0},
+		// A page is the rows shown
+		{[]tea.KeyType{tea.KeyPgDown}, 3, 1},
+		{[]tea.KeyType{tea.KeyPgDown, tea.KeyPgDown}, 6, 4},
+		{[]tea.KeyType{tea.KeyPgDown, tea.KeyPgDown, tea.KeyPgUp}, 3, 3},
+		// Neither goes past the ends
+		{[]tea.KeyType{tea.KeyPgDown, tea.KeyPgDown, tea.KeyPgDown, tea.KeyPgDown}, 9, 7},
+		{[]tea.KeyType{tea.KeyPgDown, tea.KeyPgUp, tea.KeyPgUp}, 0, 0},
+		// Left and Right are for the text in the menu
+		{[]tea.KeyType{tea.KeyRight}, 0, 0},
+	}
+	for _, tt := range tests {
+		m := menuModel(10)
+		m.Height = 3
+		for _, k := range tt.keys {
+			m, _ = m.Update(tea.KeyMsg{Type: k})
+		}
+		if m.cursor != tt.cursor || m.offset != tt.offset {
+			t.Errorf("after %v: cursor %d, offset %d; want %d, %d", tt.keys, m.cursor, m.offset, tt.cursor, tt.offset)
+		}
+	}
+}
+
+func TestCompactScroll(t *testing.T) {
+	m := menuModel(10)
+	m.Compact = true
+	for i := 0; i < compactHints; i++ {
+		m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRight})
+	}
+	if m.cursor != compactHints || m.offset != 1 {
+		t.Errorf("cursor %d, offset %d; want %d, 1", m.cursor, m.offset, compactHints)
+	}
+	// Up, Down and the page keys are left to the prompt
+	for _, k := range []tea.KeyType{tea.KeyUp, tea.KeyDown, tea.KeyPgDown, tea.KeyPgUp} {
+		m, _ = m.Update(tea.KeyMsg{Type: k})
+	}
+	if m.cursor != compactHints {
+		t.Errorf("cursor %d after Up and Down in compact mode, want %d", m.cursor, compactHints)
+	}
+}
+
+func TestMenuKeysBlurred(t *testing.T) {
+	m := menuModel(10)
+	m.Blur()
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	if m.cursor != 0 {
+		t.Errorf("cursor %d after Down while blurred, want 0", m.cursor)
+	}
+
+	// The key that focuses the menu isn't taken as moving in it
+	m.Focus()
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	if m.cursor != 1 {
+		t.Errorf("cursor %d, want 1", m.cursor)
+	}
+
+	// Tab is taken by the prompt, to accept the hint
+	if _, cmd := m.Update(tea.KeyMsg{Type: tea.KeyTab}); cmd != nil {
+		t.Errorf("Tab returned a command")
+	}
+}
+
+func TestMergeKeepsCursor(t *testing.T) {
+	m := menuModel(10)
+	m.Height = 3
+	for i := 0; i < 4; i++ {
+		m, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	}
+	// A better candidate coming in doesn't move the cursor off file04
+	m.merge([]Candidate{{Text: "first", Kind: KindFile, Score: 100}})
+	if got := m.GetChoice(); got != "file04" || m.cursor != 5 {
+		t.Errorf("choice %q at %d, want file04 at 5", got, m.cursor)
+	}
+	if m.offset > m.cursor || m.cursor >= m.offset+3 {
+		t.Errorf("offset %d doesn't show the cursor at %d", m.offset, m.cursor)
+	}
+}
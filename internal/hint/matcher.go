@@ -0,0 +1,201 @@
+package hint
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Bonuses added to the score of a match
+const (
+	// The query is the start of the choice
+	prefixBonus = 8
+	// A letter of the query starts a word of the choice, after a separator
+	// or as an upper case letter after a lower case one
+	boundaryBonus = 3
+	// A letter of the query follows the one matched before it
+	consecutiveBonus = 1
+)
+
+// matcher finds the choices that fuzzy match a query, the letters of the
+// query appearing in them in order. The choices are indexed by the letters
+// they contain, and the choices matched by a query are kept, so that as the
+// query is typed only the choices that matched it so far are looked at.
+type matcher struct {
+	choices [][]rune
+	// byRune lists the choices containing each letter
+	byRune map[rune][]int
+
+	query      []rune
+	candidates []int
+}
+
+// match is a choice that matched a query, with its score.
+type match struct {
+	index int
+	score int
+}
+
+func newMatcher(choices []string) *matcher {
+	m := &matcher{
+		choices: make([][]rune, len(choices)),
+		byRune:  make(map[rune][]int),
+	}
+	// last holds the last choice each letter was seen in, plus one
+	last := make(map[rune]int)
+	for i, choice := range choices {
+		m.choices[i] = []rune(choice)
+		for _, r := range m.choices[i] {
+			if last[r] != i+1 {
+				last[r] = i + 1
+				m.byRune[r] = append(m.byRune[r], i)
+			}
+		}
+	}
+	return m
+}
+
+// find returns the indexes of at most n choices matching query, the best
+// first. Choices much longer than the query aren't matched, as they're
+// unlikely to be what's being typed.
+func (m *matcher) find(query string, n int) []int {
+	q := []rune(query)
+	if len(q) == 0 {
+		m.query, m.candidates = nil, nil
+		return nil
+	}
+
+	// A choice matching the query also matched the start of it, so when the
+	// query grew only the choices matched before need looking at
+	candidates := m.candidates
+	if m.query == nil || !hasPrefix(q, m.query) {
+		candidates = m.byRune[q[0]]
+	}
+
+	var kept []int
+	var best []match
+	for _, i := range candidates {
+		score, ok := scoreMatch(q, m.choices[i])
+		if !ok {
+			continue
+		}
+		kept = append(kept, i)
+		if len(m.choices[i])-len(q) > len(q)+1 {
+			continue
+		}
+		best = insertMatch(best, match{i, score}, n)
+	}
+	m.query, m.candidates = q, kept
+
+	indexes := make([]int, len(best))
+	for i, b := range best {
+		indexes[i] = b.index
+	}
+	return indexes
+}
+
+// insertMatch adds a match to best, which holds at most n matches, the
+// highest score first and then in the order of the choices.
+func insertMatch(best []match, b match, n int) []match {
+	pos := len(best)
+	for pos > 0 && best[pos-1].score < b.score {
+		pos--
+	}
+	if pos >= n {
+		return best
+	}
+	if len(best) < n {
+		best = append(best, match{})
+	}
+	copy(best[pos+1:], best[pos:])
+	best[pos] = b
+	return best
+}
+
+// scoreMatch reports whether the letters of query appear in order in
+// choice, and how well they match: the query being the start of the choice,
+// or its letters starting words or following each other, make it better,
+// and each letter of the choice left over makes it worse.
+func scoreMatch(query, choice []rune) (int, bool) {
+	if len(query) == 0 {
+		// Everything matches as well, to be kept in order
+		return 0, true
+	}
+	score := len(query) - len(choice)
+	if hasPrefix(choice, query) {
+		return score + prefixBonus + boundaryBonus + (len(query)-1)*consecutiveBonus, true
+	}
+
+	q, last := 0, -2
+	for i := 0; i < len(choice) && q < len(query); i++ {
+		if choice[i] != query[q] {
+			continue
+		}
+		if i == last+1 {
+			score += consecutiveBonus
+		}
+		if isBoundary(choice, i) {
+			score += boundaryBonus
+		}
+		last = i
+		q++
+	}
+	return score, q == len(query)
+}
+
+// isBoundary reports whether a word of s starts at i.
+func isBoundary(s []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev, r := s[i-1], s[i]
+	if strings.ContainsRune("-_./ ", prev) {
+		return true
+	}
+	return 'a' <= prev && prev <= 'z' && 'A' <= r && r <= 'Z'
+}
+
+func hasPrefix(s, prefix []rune) bool {
+	if len(prefix) > len(s) {
+		return false
+	}
+	for i, r := range prefix {
+		if s[i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPositions returns the indexes of the runes of choice that query
+// matches, as scoreMatch finds them but ignoring case, or nil if it doesn't
+// match.
+func matchPositions(query, choice []rune) []int {
+	query, choice = foldRunes(query), foldRunes(choice)
+	if len(query) == 0 || len(query) > len(choice) {
+		return nil
+	}
+	positions := make([]int, 0, len(query))
+	if hasPrefix(choice, query) {
+		for i := range query {
+			positions = append(positions, i)
+		}
+		return positions
+	}
+	for i := 0; i < len(choice) && len(positions) < len(query); i++ {
+		if choice[i] == query[len(positions)] {
+			positions = append(positions, i)
+		}
+	}
+	if len(positions) < len(query) {
+		return nil
+	}
+	return positions
+}
+
+func foldRunes(s []rune) []rune {
+	folded := make([]rune, len(s))
+	for i, r := range s {
+		folded[i] = unicode.ToLower(r)
+	}
+	return folded
+}
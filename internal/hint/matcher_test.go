@@ -0,0 +1,56 @@
+package hint
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/lithammer/fuzzysearch/fuzzy"
+)
+
+// benchChoices returns command names like those of a PATH with thousands
+// of executables.
+func benchChoices() []string {
+	stems := []string{"git", "go", "python", "docker", "kube", "npm", "cargo", "ssh", "grep", "make", "llvm", "perl", "x86_64-linux-gnu", "gpg", "zip"}
+	suffixes := []string{"", "-config", "-receive-pack", "fmt", "3.12", "-compose", "ctl", "-keygen", "-objdump", "doc", "-agent", "info", "-upload", "test", "-shell"}
+	var choices []string
+	for i := 0; len(choices) < 6000; i++ {
+		stem := stems[i%len(stems)]
+		suffix := suffixes[i/len(stems)%len(suffixes)]
+		choices = append(choices, fmt.Sprintf("%s%s%d", stem, suffix, i/(len(stems)*len(suffixes))))
+	}
+	return choices
+}
+
+// The queries as each letter of them is typed
+var benchQueries = []string{"g", "gi", "git", "git-", "git-r", "git-re", "d", "do", "doc", "dock", "k", "ku", "kc", "kct", "kctl"}
+
+func BenchmarkRankFind(b *testing.B) {
+	choices := benchChoices()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, query := range benchQueries {
+			matches := fuzzy.RankFind(query, choices)
+			sort.Sort(matches)
+		}
+	}
+}
+
+func BenchmarkMatcher(b *testing.B) {
+	choices := benchChoices()
+	m := newMatcher(choices)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, query := range benchQueries {
+			m.find(query, maxHints)
+		}
+	}
+}
+
+func BenchmarkNewMatcher(b *testing.B) {
+	choices := benchChoices()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		newMatcher(choices)
+	}
+}
@@ -0,0 +1,167 @@
+package hint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	rw "github.com/mattn/go-runewidth"
+)
+
+// Widths the text and descriptions of the menu are cut to
+const (
+	maxTextWidth = 40
+	maxDescWidth = 50
+)
+
+// icons mark the kind of each candidate in the menu.
+var icons = map[Kind]string{
+	KindCommand:    "$",
+	KindSubcommand: "»",
+	KindFlag:       "-",
+	KindFile:       "≡",
+	KindDir:        "/",
+	KindValue:      "=",
+}
+
+// iconColors are the colors of the icons of each kind.
+var iconColors = map[Kind]lipgloss.Color{
+	KindCommand:    "#3185FC",
+	KindSubcommand: "#56EEF4",
+	KindFlag:       "#C7EF00",
+	KindFile:       "#F0F7F4",
+	KindDir:        "#3185FC",
+	KindValue:      "205",
+}
+
+var (
+	hintColor  = lipgloss.Color("240")
+	textColor  = lipgloss.Color("#F0F7F4")
+	matchColor = lipgloss.Color("#56EEF4")
+)
+
+func (m Model) View() string {
+	if m.Compact {
+		return m.rowView()
+	}
+	return m.menuView()
+}
+
+// selectedColor is the background of the hint at the cursor, which is
+// brighter once the hints are focused.
+func (m Model) selectedColor() lipgloss.Color {
+	if m.focus {
+		return "205"
+	}
+	return "237"
+}
+
+// rowView shows the hints in view in a row.
+func (m Model) rowView() string {
+	selectedText := lipgloss.NewStyle().Background(m.selectedColor()).Inline(true).Render
+	unSelectedText := lipgloss.NewStyle().Foreground(hintColor).Inline(true).Render
+
+	var s string
+	for i := m.offset; i < min(len(m.hints), m.offset+m.height()); i++ {
+		if m.cursor == i {
+			s += selectedText(fmt.Sprintf(" %s ", m.hints[i]))
+		} else {
+			s += unSelectedText(fmt.Sprintf(" %s ", m.hints[i]))
+		}
+	}
+	return s
+}
+
+// menuView shows the hints in view one per row, with an icon for their
+// kind, the characters matching what's typed highlighted and their
+// descriptions in a second column. Where there are more hints than shown,
+// the last row tells which one the cursor is at.
+func (m Model) menuView() string {
+	if len(m.hints) == 0 {
+		return ""
+	}
+
+	// The descriptions line up after the widest hint
+	width := 0
+	for _, hint := range m.hints {
+		width = max(width, min(rw.StringWidth(hint), maxTextWidth))
+	}
+
+	var rows []string
+	end := min(len(m.hints), m.offset+m.height())
+	for i := m.offset; i < end; i++ {
+		c := m.candidate(i)
+		row := lipgloss.NewStyle().Inline(true)
+		if i == m.cursor {
+			row = row.Background(m.selectedColor())
+		}
+
+		text := rw.Truncate(c.Text, maxTextWidth, "…")
+		var b strings.Builder
+		b.WriteString(row.Render(" "))
+		b.WriteString(row.Foreground(iconColors[c.Kind]).Render(icons[c.Kind]))
+		b.WriteString(row.Render(" "))
+		b.WriteString(m.highlight(row, text))
+		b.WriteString(row.Render(strings.Repeat(" ", width-rw.StringWidth(text)+2)))
+		b.WriteString(row.Foreground(hintColor).Render(rw.Truncate(c.Description, maxDescWidth, "…") + " "))
+		rows = append(rows, b.String())
+	}
+	if len(m.hints) > m.height() {
+		rows = append(rows, lipgloss.NewStyle().Foreground(hintColor).Render(fmt.Sprintf(" %d/%d", m.cursor+1, len(m.hints))))
+	}
+	return strings.Join(rows, "\n")
+}
+
+// candidate returns the candidate shown as hint i. The hints of a picker
+// only have their text.
+func (m Model) candidate(i int) Candidate {
+	if i < len(m.candidates) {
+		return m.candidates[i]
+	}
+	return Candidate{Text: m.hints[i], Kind: KindValue}
+}
+
+// highlight renders the text of a hint in style, with the characters
+// matching what's typed standing out.
+func (m Model) highlight(style lipgloss.Style, text string) string {
+	runes := []rune(text)
+	matched := make([]bool, len(runes))
+	for _, i := range matchPositions([]rune(m.query(text)), runes) {
+		matched[i] = true
+	}
+
+	var b strings.Builder
+	for start := 0; start < len(runes); {
+		end := start
+		for end < len(runes) && matched[end] == matched[start] {
+			end++
+		}
+		s := style.Foreground(textColor)
+		if matched[start] {
+			s = style.Foreground(matchColor).Bold(true)
+		}
+		b.WriteString(s.Render(string(runes[start:end])))
+		start = end
+	}
+	return b.String()
+}
+
+// query returns what's typed that a hint matched: the whole word, or the
+// part after its directory or the = of a flag, which is what files and flag
+// values are completed for. A picker matches the value it was made for.
+func (m Model) query(text string) string {
+	if m.candidates == nil {
+		return strings.Join(strings.Fields(m.matchString), "")
+	}
+	typed := m.line.Typed
+	for _, sep := range []string{"", "/", "="} {
+		q := typed
+		if sep != "" {
+			q = typed[strings.LastIndex(typed, sep)+1:]
+		}
+		if matchPositions([]rune(q), []rune(text)) != nil {
+			return q
+		}
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package hint
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// colors renders styles in tests as on a terminal with 256 colors, until
+// the test is over.
+func colors(t *testing.T) {
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	t.Cleanup(func() { lipgloss.SetColorProfile(profile) })
+}
+
+func TestMenuView(t *testing.T) {
+	colors(t)
+	m := menuModel(10)
+	m.Height = 3
+	for i := 0; i < 3; i++ {
+		m, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	}
+
+	// The rows scrolled to, and where the cursor is among all the hints
+	rows := strings.Split(m.View(), "\n")
+	if len(rows) != 4 {
+		t.Fatalf("View has %d rows, want 3 and the position", len(rows))
+	}
+	for i, want := range []string{"file01", "file02", "file03"} {
+		if !strings.Contains(rows[i], want[1:]) {
+			t.Errorf("row %d = %q, want %s", i, rows[i], want)
+		}
+	}
+	if !strings.Contains(rows[3], "4/10") {
+		t.Errorf("last row = %q, want 4/10", rows[3])
+	}
+
+	// What's typed stands out in each hint, on the background of the
+	// cursor's row
+	plain := lipgloss.NewStyle().Inline(true)
+	if want := plain.Foreground(matchColor).Bold(true).Render("f") + plain.Foreground(textColor).Render("ile01"); !strings.Contains(rows[0], want) {
+		t.Errorf("row 0 = %q, want f highlighted as %q", rows[0], want)
+	}
+	cursor := plain.Background(m.selectedColor())
+	if want := cursor.Foreground(matchColor).Bold(true).Render("f") + cursor.Foreground(textColor).Render("ile03"); !strings.Contains(rows[2], want) {
+		t.Errorf("row 2 = %q, want the cursor's row %q", rows[2], want)
+	}
+}
+
+func TestMenuViewFits(t *testing.T) {
+	m := menuModel(2)
+	if rows := strings.Split(m.View(), "\n"); len(rows) != 2 {
+		t.Errorf("View = %q, want the two hints without a position", rows)
+	}
+	if got := New(nil).View(); got != "" {
+		t.Errorf("View without hints = %q", got)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	colors(t)
+	plain := lipgloss.NewStyle().Inline(true)
+	matched := plain.Foreground(matchColor).Bold(true).Render
+	text := plain.Foreground(textColor).Render
+
+	tests := []struct {
+		typed string
+		hint  string
+		want  string
+	}{
+		{"gco", "git-checkout", matched("g") + text("it-") + matched("c") + text("heck") + matched("o") + text("ut")},
+		// Files match after their directory, and flag values after the =
+		{"src/ma", "main.go", matched("ma") + text("in.go")},
+		{"--color=al", "always", matched("al") + text("ways")},
+		{"xyz", "main.go", text("main.go")},
+	}
+	for _, tt := range tests {
+		m := New(nil)
+		m.line = newLine(tt.typed, len([]rune(tt.typed)), Env{})
+		m.candidates = []Candidate{{Text: tt.hint}}
+		if got := m.highlight(plain, tt.hint); got != tt.want {
+			t.Errorf("highlight(%q) for %q = %q, want %q", tt.hint, tt.typed, got, tt.want)
+		}
+	}
+}
+
+func TestRowView(t *testing.T) {
+	m := menuModel(10)
+	m.Compact = true
+	for i := 0; i < compactHints; i++ {
+		m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRight})
+	}
+	view := m.View()
+	if strings.Contains(view, "file00") || !strings.Contains(view, "file01") || !strings.Contains(view, "file05") || strings.Contains(view, "file06") {
+		t.Errorf("View = %q, want file01 to file05", view)
+	}
+}
+
+func TestPicker(t *testing.T) {
+	m := NewPicker([]string{"/src/alpha", "/src/gamma", "/tmp/game"}, "gam")
+	// The choices that don't match are still there, after those that do
+	if !m.Focused() || len(m.hints) != 3 || m.hints[2] != "/src/alpha" {
+		t.Errorf("hints = %q, want the matches first and then /src/alpha", m.hints)
+	}
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	if m.GetChoice() != m.hints[1] {
+		t.Errorf("choice %q after Down, want %q", m.GetChoice(), m.hints[1])
+	}
+}
@@ -0,0 +1,212 @@
+package hint
+
+import (
+	"context"
+	"sort"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// Kind is what a candidate completes a word with.
+type Kind int
+
+const (
+	KindCommand Kind = iota
+	KindSubcommand
+	KindFlag
+	KindFile
+	KindDir
+	KindValue
+)
+
+// Candidate is a completion found by a provider.
+type Candidate struct {
+	// Text is shown as the hint
+	Text string
+
+	// Value replaces the word being completed. It's Text if empty.
+	Value string
+
+	Description string
+	Kind        Kind
+
+	// Score ranks the candidates of all providers, the highest first. Match
+	// gives a score for how well what's typed matches a candidate.
+	Score int
+}
+
+// Line is the input a provider completes: the word before the cursor, in
+// the command it's an argument of.
+type Line struct {
+	Value string
+	// Pos is the rune offset of the cursor in Value
+	Pos int
+
+	// Word is the word before the cursor, which is replaced by the
+	// candidate picked, and Typed its text up to the cursor
+	Word  syntax.Span
+	Typed string
+
+	// Args are the words of the command before the word completed, starting
+	// with the command name. They're empty where not only literal text.
+	Args []string
+
+	// Dir is the directory relative paths are completed in
+	Dir string
+
+	// vars holds the values of the variables in Typed, HOME, PATH and
+	// SUSHI_NO_HELP, as providers can't look them up while the shell runs
+	// commands
+	vars map[string]string
+}
+
+// Var returns the value of a variable used in the word completed, HOME,
+// PATH or SUSHI_NO_HELP.
+func (l Line) Var(name string) string {
+	return l.vars[name]
+}
+
+// ProviderBonus is added to the scores of the candidates providers find
+// from what they know of a command, such as its subcommands, flags and the
+// values of its arguments, so that they come before the files completed
+// for any argument.
+const ProviderBonus = 100
+
+// Provider finds the candidates for completing a line. Complete runs in
+// its own goroutine, and ctx is canceled once the line changes, so a slow
+// provider doesn't hold up typing but should stop when ctx is done.
+type Provider interface {
+	Complete(ctx context.Context, line Line) []Candidate
+}
+
+// Ranker boosts the candidates found for a line, such as by how often
+// they were used. Boost is called from the goroutines providers run in.
+type Ranker interface {
+	Boost(line Line, c Candidate) int
+}
+
+// Match reports whether the letters of query appear in order in text, and
+// scores how well: text starting with query, or its letters starting words
+// or following each other, score higher, and each letter of text left over
+// scores lower.
+func Match(query, text string) (int, bool) {
+	return scoreMatch([]rune(query), []rune(text))
+}
+
+// resultsMsg carries the candidates a provider found for a line.
+type resultsMsg struct {
+	id, seq    int
+	candidates []Candidate
+}
+
+// newLine returns the line providers complete for the cursor at pos in
+// value.
+func newLine(value string, pos int, env Env) Line {
+	runes := []rune(value)
+	pos = max(0, min(pos, len(runes)))
+	word := syntax.WordAt(value, pos)
+	line := Line{
+		Value: value,
+		Pos:   pos,
+		Word:  word,
+		Typed: string(runes[word.Pos:pos]),
+		Args:  syntax.CommandArgs(value, pos),
+		Dir:   env.Dir,
+		vars:  make(map[string]string),
+	}
+	if env.Var != nil {
+		names := []string{"HOME", "PATH", "SUSHI_NO_HELP"}
+		typed := []rune(line.Typed)
+		for i, c := range typed {
+			if c == '$' {
+				if name, _ := varName(typed[i+1:]); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+		for _, name := range names {
+			line.vars[name], _ = env.Var(name)
+		}
+	}
+	return line
+}
+
+// complete starts the providers on a line, each returning its candidates
+// in a resultsMsg. Those still running for the line before are canceled.
+func (m *Model) complete(line Line) tea.Cmd {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.seq++
+	m.results = nil
+
+	id, seq, ranker := m.id, m.seq, m.ranker
+	var cmds []tea.Cmd
+	for _, p := range m.providers() {
+		cmds = append(cmds, func() tea.Msg {
+			candidates := p.Complete(ctx, line)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if ranker != nil {
+				for i := range candidates {
+					candidates[i].Score += ranker.Boost(line, candidates[i])
+				}
+			}
+			return resultsMsg{id, seq, candidates}
+		})
+	}
+	return tea.Batch(cmds...)
+}
+
+// merge adds the candidates of a provider to those found so far, and shows
+// the best as hints. Candidates replacing the word with the same value
+// are only shown once.
+func (m *Model) merge(candidates []Candidate) {
+	selected := m.GetChoice()
+	m.results = append(m.results, candidates...)
+	sort.SliceStable(m.results, func(i, j int) bool {
+		return m.results[i].Score > m.results[j].Score
+	})
+
+	m.hints, m.candidates = []string{}, nil
+	seen := make(map[string]bool)
+	for _, c := range m.results {
+		if c.Value == "" {
+			c.Value = c.Text
+		}
+		if seen[c.Value] {
+			continue
+		}
+		seen[c.Value] = true
+		m.candidates = append(m.candidates, c)
+		m.hints = append(m.hints, c.Text)
+		if len(m.hints) == maxHints {
+			break
+		}
+	}
+
+	// Keep the hint chosen if it's still there
+	m.cursor = 0
+	for i, hint := range m.hints {
+		if m.focus && hint == selected {
+			m.cursor = i
+		}
+	}
+	m.scroll()
+}
+
+// Complete returns value with the word the hints were found for replaced
+// by the hint chosen, and the position of the cursor after it.
+func (m *Model) Complete(value string) (string, int) {
+	runes := []rune(value)
+	if m.cursor >= len(m.candidates) || value != m.line.Value || m.line.Pos > len(runes) {
+		return value, m.line.Pos
+	}
+	fix := []rune(m.candidates[m.cursor].Value)
+	completed := append(append(append([]rune(nil), runes[:m.line.Word.Pos]...), fix...), runes[m.line.Pos:]...)
+	return string(completed), m.line.Word.Pos + len(fix)
+}
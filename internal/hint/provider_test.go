@@ -0,0 +1,196 @@
+package hint
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// providerFunc is a provider completing with a function.
+type providerFunc func(ctx context.Context, line Line) []Candidate
+
+func (f providerFunc) Complete(ctx context.Context, line Line) []Candidate {
+	return f(ctx, line)
+}
+
+type rankerFunc func(line Line, c Candidate) int
+
+func (f rankerFunc) Boost(line Line, c Candidate) int {
+	return f(line, c)
+}
+
+// results runs the commands of the providers one after the other, and
+// returns their messages.
+func results(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	msg := cmd()
+	if batch, ok := msg.(tea.BatchMsg); ok {
+		var msgs []tea.Msg
+		for _, cmd := range batch {
+			msgs = append(msgs, results(cmd)...)
+		}
+		return msgs
+	}
+	return []tea.Msg{msg}
+}
+
+// start runs the commands of the providers at once, sending their messages
+// as they come in.
+func start(cmd tea.Cmd) <-chan tea.Msg {
+	cmds := []tea.Cmd{cmd}
+	if batch, ok := cmd().(tea.BatchMsg); ok {
+		cmds = batch
+	}
+	msgs := make(chan tea.Msg, len(cmds))
+	for _, cmd := range cmds {
+		go func() { msgs <- cmd() }()
+	}
+	return msgs
+}
+
+func providerModel(t *testing.T, providers ...Provider) Model {
+	m := New(nil, providers...)
+	m.SetEnv(Env{Dir: t.TempDir()})
+	return m
+}
+
+func receive[T any](t *testing.T, c <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-c:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a provider")
+		panic("unreachable")
+	}
+}
+
+func TestProviderSlow(t *testing.T) {
+	started := make(chan Line, 1)
+	canceled := make(chan Line, 1)
+	found := make(chan []Candidate)
+	slow := providerFunc(func(ctx context.Context, line Line) []Candidate {
+		started <- line
+		select {
+		case c := <-found:
+			return c
+		case <-ctx.Done():
+			canceled <- line
+			return nil
+		}
+	})
+	m := providerModel(t, slow)
+
+	// Typing goes on while the provider is still busy with the line before
+	msgs := start(m.UpdateHintOptions("git ch", 6))
+	if line := receive(t, started); line.Typed != "ch" {
+		t.Errorf("provider completing %q, want %q", line.Typed, "ch")
+	}
+	next := m.UpdateHintOptions("git che", 7)
+	if line := receive(t, canceled); line.Typed != "ch" {
+		t.Errorf("canceled completing %q, want %q", line.Typed, "ch")
+	}
+	for range 3 {
+		if msg := receive(t, msgs); msg != nil {
+			m, _ = m.Update(msg)
+		}
+	}
+	if len(m.hints) != 0 {
+		t.Errorf("hints of a canceled line = %q, want none", m.hints)
+	}
+
+	msgs = start(next)
+	if line := receive(t, started); line.Typed != "che" {
+		t.Errorf("provider completing %q, want %q", line.Typed, "che")
+	}
+	found <- []Candidate{{Text: "checkout"}}
+	for range 3 {
+		m, _ = m.Update(receive(t, msgs))
+	}
+	if want := []string{"checkout"}; !slices.Equal(m.hints, want) {
+		t.Errorf("hints = %q, want %q", m.hints, want)
+	}
+}
+
+func TestProviderStale(t *testing.T) {
+	p := providerFunc(func(ctx context.Context, line Line) []Candidate {
+		return []Candidate{{Text: line.Typed + "-hint"}}
+	})
+	m := providerModel(t, p)
+	old := results(m.UpdateHintOptions("git c", 5))
+	for _, msg := range results(m.UpdateHintOptions("git ch", 6)) {
+		m, _ = m.Update(msg)
+	}
+
+	// Results for the line before come in late
+	for _, msg := range old {
+		m, _ = m.Update(msg)
+	}
+	if want := []string{"ch-hint"}; !slices.Equal(m.hints, want) {
+		t.Errorf("hints after stale results = %q, want %q", m.hints, want)
+	}
+
+	// and those for a line cleared, or of another model, are dropped too
+	old = results(m.UpdateHintOptions("git che", 7))
+	m.Clear()
+	other := providerModel(t, p)
+	old = append(old, results(other.UpdateHintOptions("git che", 7))...)
+	for _, msg := range old {
+		m, _ = m.Update(msg)
+	}
+	if len(m.hints) != 0 {
+		t.Errorf("hints after clearing = %q, want none", m.hints)
+	}
+}
+
+func TestProviderMerge(t *testing.T) {
+	first := providerFunc(func(ctx context.Context, line Line) []Candidate {
+		return []Candidate{
+			{Text: "--cached", Score: 3},
+			{Text: "checkout", Score: 2},
+			// The same value as checkout, so not shown again
+			{Text: "co", Value: "checkout", Score: 1},
+		}
+	})
+	second := providerFunc(func(ctx context.Context, line Line) []Candidate {
+		return []Candidate{
+			{Text: "checkout", Description: "Switch branches", Score: 5},
+			{Text: "cherry-pick", Score: 1},
+		}
+	})
+	m := providerModel(t, first, second)
+	m.SetRanker(rankerFunc(func(line Line, c Candidate) int {
+		if line.Typed == "ch" && c.Text == "cherry-pick" {
+			return 10
+		}
+		return 0
+	}))
+
+	msgs := results(m.UpdateHintOptions("git ch", 6))
+	if len(msgs) != 4 {
+		t.Fatalf("got %d results, want one for each of the 4 providers", len(msgs))
+	}
+	// The hints grow as each provider's results come in
+	m, _ = m.Update(msgs[2])
+	if want := []string{"--cached", "checkout"}; !slices.Equal(m.hints, want) {
+		t.Errorf("hints of the first provider = %q, want %q", m.hints, want)
+	}
+	m, _ = m.Update(msgs[3])
+	if want := []string{"cherry-pick", "checkout", "--cached"}; !slices.Equal(m.hints, want) {
+		t.Errorf("hints of both providers = %q, want %q", m.hints, want)
+	}
+	if got := m.candidates[1].Description; got != "Switch branches" {
+		t.Errorf("checkout described as %q, want the best scored candidate's", got)
+	}
+	for _, msg := range msgs[:2] {
+		m, _ = m.Update(msg)
+	}
+	if len(m.hints) != 3 {
+		t.Errorf("hints after the empty results = %q, want them unchanged", m.hints)
+	}
+}
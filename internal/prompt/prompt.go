@@ -2,6 +2,7 @@ package prompt
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"sync"
 	"time"
@@ -73,6 +74,16 @@ type blinkCtx struct {
 	cancel context.CancelFunc
 }
 
+// styleCache holds the result of StyleFunc so it isn't recomputed on every
+// render.
+type styleCache struct {
+	value  string
+	styles []lipgloss.Style
+
+	// breaks[i] is set where the style of rune i differs from the one before
+	breaks []bool
+}
+
 // CursorMode describes the behavior of the cursor.
 type CursorMode int
 
@@ -114,13 +125,31 @@ type Model struct {
 	PlaceholderStyle lipgloss.Style
 	CursorStyle      lipgloss.Style
 
+	// SuggestionStyle is applied to the rest of the suggestion set with
+	// SetSuggestion, shown after the cursor.
+	SuggestionStyle lipgloss.Style
+
+	// GutterStyle is applied to the line numbers shown beside multi-line
+	// values.
+	GutterStyle lipgloss.Style
+
+	// StyleFunc, if set, returns a style for each rune of the value and is
+	// used in place of TextStyle, e.g. for syntax highlighting. Runes beyond
+	// the end of the returned slice are rendered with TextStyle. It's not
+	// used when the echo mode masks the input.
+	StyleFunc func(value []rune) []lipgloss.Style
+
+	// DiagnosticStyle is applied to the message set with SetDiagnostic.
+	DiagnosticStyle lipgloss.Style
+
 	// CharLimit is the maximum amount of characters this input element will
 	// accept. If 0 or less, there's no limit.
 	CharLimit int
 
 	// Width is the maximum number of characters that can be displayed at once.
 	// It essentially treats the text field like a horizontally scrolling
-	// viewport. If 0 or less this setting is ignored.
+	// viewport. If 0 or less this setting is ignored. Multi-line values
+	// aren't scrolled.
 	Width int
 
 	// The ID of this Model as it relates to other textinput Models.
@@ -152,6 +181,16 @@ type Model struct {
 	// Used to manage cursor blink
 	blinkCtx *blinkCtx
 
+	// Styles computed by StyleFunc for the last value rendered
+	styleCache *styleCache
+
+	// Message shown under the input and the position it points at
+	diagnostic    string
+	diagnosticPos int
+
+	// suggestion is a value the value typed may be completed to
+	suggestion string
+
 	// cursorMode determines the behavior of the cursor
 	cursorMode CursorMode
 }
@@ -164,6 +203,7 @@ func New() Model {
 		EchoCharacter:    '*',
 		CharLimit:        0,
 		PlaceholderStyle: lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
+		SuggestionStyle:  lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
 
 		id:         nextID(),
 		value:      nil,
@@ -175,6 +215,7 @@ func New() Model {
 		blinkCtx: &blinkCtx{
 			ctx: context.Background(),
 		},
+		styleCache: &styleCache{},
 	}
 }
 
@@ -186,12 +227,53 @@ func (m *Model) SetValue(s string) {
 	} else {
 		m.value = runes
 	}
+	m.diagnostic = ""
 	if m.pos == 0 || m.pos > len(m.value) {
 		m.setCursor(len(m.value))
 	}
 	m.handleOverflow()
 }
 
+// SetSuggestion sets a value the value typed may be completed to. While the
+// value starts it and the cursor is at the end, the rest is shown after
+// the cursor, and Right or End accepts it, or Alt+Right its next word.
+func (m *Model) SetSuggestion(s string) {
+	m.suggestion = s
+}
+
+// Suggestion returns the rest of the suggestion set, after the value, or
+// an empty string if it's not shown.
+func (m Model) Suggestion() string {
+	value := string(m.value)
+	if m.pos != len(m.value) || value == "" || !strings.HasPrefix(m.suggestion, value) {
+		return ""
+	}
+	return m.suggestion[len(value):]
+}
+
+// acceptSuggestion adds the rest of the suggestion to the value, or only
+// its next word if word is set. It returns false if there's none.
+func (m *Model) acceptSuggestion(word bool) bool {
+	rest := []rune(m.Suggestion())
+	if len(rest) == 0 {
+		return false
+	}
+	if word {
+		// The spaces before the word are taken along with it
+		i := 0
+		for i < len(rest) && unicode.IsSpace(rest[i]) {
+			i++
+		}
+		for i < len(rest) && !unicode.IsSpace(rest[i]) {
+			i++
+		}
+		rest = rest[:i]
+	}
+	m.value = append(m.value, rest...)
+	m.setCursor(len(m.value))
+	return true
+}
+
 // Value returns the value of the text input.
 func (m Model) Value() string {
 	return string(m.value)
@@ -202,6 +284,76 @@ func (m Model) Cursor() int {
 	return m.pos
 }
 
+// LineCount returns the number of lines in the value.
+func (m Model) LineCount() int {
+	return strings.Count(string(m.value), "\n") + 1
+}
+
+// CursorUp moves the cursor to the line above, keeping its column where
+// possible. It returns false if the cursor is already on the first line.
+func (m *Model) CursorUp() bool {
+	start := m.lineStart(m.pos)
+	if start == 0 {
+		return false
+	}
+	col := m.pos - start
+	prevStart := m.lineStart(start - 1)
+	m.setCursor(min(prevStart+col, start-1))
+	return true
+}
+
+// CursorDown moves the cursor to the line below, keeping its column where
+// possible. It returns false if the cursor is already on the last line.
+func (m *Model) CursorDown() bool {
+	end := m.lineEnd(m.pos)
+	if end == len(m.value) {
+		return false
+	}
+	col := m.pos - m.lineStart(m.pos)
+	m.setCursor(min(end+1+col, m.lineEnd(end+1)))
+	return true
+}
+
+// InsertNewline breaks the line at the cursor, e.g. to continue incomplete
+// input.
+func (m *Model) InsertNewline() {
+	if m.CharLimit > 0 && len(m.value) >= m.CharLimit {
+		return
+	}
+	m.value = append(m.value[:m.pos], append([]rune{'\n'}, m.value[m.pos:]...)...)
+	m.setCursor(m.pos + 1)
+}
+
+// lineStart returns the index of the first rune of the line containing pos.
+func (m Model) lineStart(pos int) int {
+	for pos > 0 && m.value[pos-1] != '\n' {
+		pos--
+	}
+	return pos
+}
+
+// lineEnd returns the index of the newline ending the line containing pos,
+// or the length of the value on the last line.
+func (m Model) lineEnd(pos int) int {
+	for pos < len(m.value) && m.value[pos] != '\n' {
+		pos++
+	}
+	return pos
+}
+
+// SetDiagnostic shows msg under the input with a caret pointing at rune
+// position pos, e.g. for a syntax error. It's cleared once the value
+// changes.
+func (m *Model) SetDiagnostic(pos int, msg string) {
+	m.diagnostic = msg
+	m.diagnosticPos = clamp(pos, 0, len(m.value))
+}
+
+// ClearDiagnostic removes the message set with SetDiagnostic.
+func (m *Model) ClearDiagnostic() {
+	m.diagnostic = ""
+}
+
 // Blink returns whether or not to draw the cursor.
 func (m Model) Blink() bool {
 	return m.blink
@@ -296,6 +448,7 @@ func (m *Model) Blur() {
 // or not the cursor blink should reset.
 func (m *Model) Reset() bool {
 	m.value = nil
+	m.diagnostic = ""
 	return m.setCursor(0)
 }
 
@@ -348,7 +501,7 @@ func (m *Model) handlePaste(v string) bool {
 // If a max width is defined, perform some logic to treat the visible area
 // as a horizontally scrolling viewport.
 func (m *Model) handleOverflow() {
-	if m.Width <= 0 || rw.StringWidth(string(m.value)) <= m.Width {
+	if m.Width <= 0 || rw.StringWidth(string(m.value)) <= m.Width || m.LineCount() > 1 {
 		m.offset = 0
 		m.offsetRight = len(m.value)
 		return
@@ -390,20 +543,22 @@ func (m *Model) handleOverflow() {
 	}
 }
 
-// deleteBeforeCursor deletes all text before the cursor. Returns whether or
-// not the cursor blink should be reset.
+// deleteBeforeCursor deletes all text before the cursor on its line. Returns
+// whether or not the cursor blink should be reset.
 func (m *Model) deleteBeforeCursor() bool {
-	m.value = m.value[m.pos:]
+	start := m.lineStart(m.pos)
+	m.value = append(m.value[:start], m.value[m.pos:]...)
 	m.offset = 0
-	return m.setCursor(0)
+	return m.setCursor(start)
 }
 
-// deleteAfterCursor deletes all text after the cursor. Returns whether or not
-// the cursor blink should be reset. If input is masked delete everything after
-// the cursor so as not to reveal word breaks in the masked input.
+// deleteAfterCursor deletes all text after the cursor on its line. Returns
+// whether or not the cursor blink should be reset. If input is masked delete
+// everything after the cursor so as not to reveal word breaks in the masked
+// input.
 func (m *Model) deleteAfterCursor() bool {
-	m.value = m.value[:m.pos]
-	return m.setCursor(len(m.value))
+	m.value = append(m.value[:m.pos], m.value[m.lineEnd(m.pos):]...)
+	return m.setCursor(m.pos)
 }
 
 // deleteWordLeft deletes the word left to the cursor. Returns whether or not
@@ -610,6 +765,7 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 	}
 
 	var resetBlink bool
+	oldValue := string(m.value)
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -637,6 +793,10 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 				resetBlink = m.setCursor(m.pos - 1)
 			}
 		case tea.KeyRight, tea.KeyCtrlF:
+			if m.acceptSuggestion(msg.Alt) { // at the end, accept the suggestion
+				resetBlink = m.cursorMode == CursorBlink
+				break
+			}
 			if msg.Alt { // alt+right arrow, forward one word
 				resetBlink = m.wordRight()
 				break
@@ -646,14 +806,23 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 			}
 		case tea.KeyCtrlW: // ^W, delete word left of cursor
 			resetBlink = m.deleteWordLeft()
-		case tea.KeyHome, tea.KeyCtrlA: // ^A, go to beginning
-			resetBlink = m.cursorStart()
+		case tea.KeyHome, tea.KeyCtrlA: // ^A, go to beginning of line
+			resetBlink = m.setCursor(m.lineStart(m.pos))
 		case tea.KeyDelete, tea.KeyCtrlD: // ^D, delete char under cursor
 			if len(m.value) > 0 && m.pos < len(m.value) {
 				m.value = append(m.value[:m.pos], m.value[m.pos+1:]...)
 			}
-		case tea.KeyCtrlE, tea.KeyEnd: // ^E, go to end
-			resetBlink = m.cursorEnd()
+		case tea.KeyCtrlE, tea.KeyEnd: // ^E, go to end of line
+			if m.acceptSuggestion(false) { // at the end, accept the suggestion
+				resetBlink = m.cursorMode == CursorBlink
+				break
+			}
+			resetBlink = m.setCursor(m.lineEnd(m.pos))
+		case tea.KeyEnter: // alt+enter, start a new line
+			if msg.Alt {
+				m.InsertNewline()
+				resetBlink = m.cursorMode == CursorBlink
+			}
 		case tea.KeyCtrlK: // ^K, kill text after cursor
 			resetBlink = m.deleteAfterCursor()
 		case tea.KeyCtrlU: // ^U, kill text before cursor
@@ -671,7 +840,9 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 					break
 				}
 				if msg.Runes[0] == 'f' { // alt+f, forward one word
-					resetBlink = m.wordRight()
+					if !m.acceptSuggestion(true) {
+						resetBlink = m.wordRight()
+					}
 					break
 				}
 			}
@@ -732,6 +903,9 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 		cmd = m.blinkCmd()
 	}
 
+	if string(m.value) != oldValue {
+		m.diagnostic = ""
+	}
 	m.handleOverflow()
 	return m, cmd
 }
@@ -743,31 +917,171 @@ func (m Model) View() string {
 		return m.placeholderView()
 	}
 
-	styleText := m.TextStyle.Inline(true).Render
+	styled := m.styles()
+	if m.LineCount() > 1 {
+		return m.multiLineView(styled)
+	}
 
 	value := m.value[m.offset:m.offsetRight]
 	pos := max(0, m.pos-m.offset)
-	v := styleText(m.echoTransform(string(value[:pos])))
-
-	if pos < len(value) {
-		v += m.cursorView(m.echoTransform(string(value[pos]))) // cursor and text under it
-		v += styleText(m.echoTransform(string(value[pos+1:]))) // text after cursor
-	} else {
-		v += m.cursorView(" ")
-	}
+	v := m.lineView(styled, m.offset, m.offsetRight)
 
 	// If a max width and background color were set fill the empty spaces with
 	// the background color.
-	valWidth := rw.StringWidth(string(value))
+	valWidth := rw.StringWidth(string(value)) + rw.StringWidth(m.suggestionText())
 	if m.Width > 0 && valWidth <= m.Width {
 		padding := max(0, m.Width-valWidth)
 		if valWidth+padding <= m.Width && pos < len(value) {
 			padding++
 		}
-		v += styleText(strings.Repeat(" ", padding))
+		v += m.TextStyle.Inline(true).Render(strings.Repeat(" ", padding))
 	}
 
-	return m.PromptStyle.Render(m.Prompt) + v
+	v = m.PromptStyle.Render(m.Prompt) + v
+	if m.diagnostic != "" {
+		v += "\n" + m.diagnosticView(m.offset, m.offsetRight, rw.StringWidth(m.Prompt))
+	}
+	return v
+}
+
+// multiLineView renders a value of several lines, each with its line number
+// in a gutter. Continuation lines are indented to line up with the first.
+func (m Model) multiLineView(styled *styleCache) string {
+	lines := strings.Split(string(m.value), "\n")
+	digits := len(fmt.Sprint(len(lines)))
+	indent := strings.Repeat(" ", rw.StringWidth(m.Prompt))
+
+	var b strings.Builder
+	start := 0
+	for i, line := range lines {
+		end := start + len([]rune(line))
+		if i == 0 {
+			b.WriteString(m.PromptStyle.Render(m.Prompt))
+		} else {
+			b.WriteString("\n" + indent)
+		}
+		gutter := fmt.Sprintf("%*d │ ", digits, i+1)
+		b.WriteString(m.GutterStyle.Inline(true).Render(gutter))
+		b.WriteString(m.lineView(styled, start, end))
+
+		if m.diagnostic != "" && m.diagnosticPos >= start && m.diagnosticPos <= end {
+			b.WriteString("\n" + m.diagnosticView(start, end, len(indent)+rw.StringWidth(gutter)))
+		}
+		start = end + 1
+	}
+	return b.String()
+}
+
+// lineView renders the runes of the value in [from, to) along with the
+// cursor, if it's in that range.
+func (m Model) lineView(styled *styleCache, from, to int) string {
+	if m.pos < from || m.pos > to {
+		return m.styledView(styled, from, to)
+	}
+	v := m.styledView(styled, from, m.pos)
+	if m.pos < to {
+		v += m.cursorView(m.echoTransform(string(m.value[m.pos])), m.runeStyle(styled, m.pos)) // cursor and text under it
+		v += m.styledView(styled, m.pos+1, to)                                                 // text after cursor
+	} else if rest := m.suggestionView(); rest != "" {
+		v += rest
+	} else {
+		v += m.cursorView(" ", m.TextStyle)
+	}
+	return v
+}
+
+// suggestionText returns the part of the rest of the suggestion shown: up
+// to the end of its line, and within Width. It's empty if the input isn't
+// focused.
+func (m Model) suggestionText() string {
+	rest, _, _ := strings.Cut(m.Suggestion(), "\n")
+	if !m.focus || m.EchoMode != EchoNormal {
+		return ""
+	}
+	if m.Width > 0 {
+		rest = rw.Truncate(rest, max(0, m.Width-rw.StringWidth(string(m.value[m.offset:m.offsetRight]))), "")
+	}
+	return rest
+}
+
+// suggestionView renders the part of the suggestion shown, with the cursor
+// on its first character.
+func (m Model) suggestionView() string {
+	runes := []rune(m.suggestionText())
+	if len(runes) == 0 {
+		return ""
+	}
+	style := m.SuggestionStyle.Inline(true)
+	return m.cursorView(string(runes[0]), style) + style.Render(string(runes[1:]))
+}
+
+// diagnosticView renders the diagnostic message with a caret under the
+// position it refers to, within the runes [from, to) shown at column indent.
+func (m Model) diagnosticView(from, to, indent int) string {
+	pos := clamp(m.diagnosticPos, from, to)
+	col := indent + rw.StringWidth(m.echoTransform(string(m.value[from:pos])))
+	return m.DiagnosticStyle.Inline(true).Render(strings.Repeat(" ", col) + "^ " + m.diagnostic)
+}
+
+// styles returns the per-rune styles of the value from StyleFunc, or nil if
+// the value should be rendered with TextStyle alone.
+func (m Model) styles() *styleCache {
+	if m.StyleFunc == nil || m.EchoMode != EchoNormal {
+		return nil
+	}
+	cache := m.styleCache
+	if cache == nil {
+		cache = &styleCache{}
+	}
+	if cache.styles == nil || cache.value != string(m.value) {
+		cache.value = string(m.value)
+		cache.styles = m.StyleFunc(m.value)
+		if cache.styles == nil {
+			cache.styles = []lipgloss.Style{}
+		}
+
+		// Note where the style changes so runs of runes can be rendered
+		// together
+		cache.breaks = make([]bool, len(m.value)+1)
+		for i := range cache.breaks {
+			switch {
+			case i == 0 || i == len(m.value):
+				cache.breaks[i] = true
+			case i < len(cache.styles):
+				cache.breaks[i] = cache.styles[i].Render("x") != cache.styles[i-1].Render("x")
+			default:
+				cache.breaks[i] = i == len(cache.styles)
+			}
+		}
+	}
+	return cache
+}
+
+// runeStyle returns the style of the rune at index i of the value.
+func (m Model) runeStyle(styled *styleCache, i int) lipgloss.Style {
+	if styled != nil && i < len(styled.styles) {
+		return styled.styles[i]
+	}
+	return m.TextStyle
+}
+
+// styledView renders the runes of the value in [from, to), grouping runs of
+// runes with the same style.
+func (m Model) styledView(styled *styleCache, from, to int) string {
+	if styled == nil {
+		return m.TextStyle.Inline(true).Render(m.echoTransform(string(m.value[from:to])))
+	}
+
+	var b strings.Builder
+	for start := from; start < to; {
+		end := start + 1
+		for end < to && !styled.breaks[end] {
+			end++
+		}
+		b.WriteString(m.runeStyle(styled, start).Inline(true).Render(string(m.value[start:end])))
+		start = end
+	}
+	return b.String()
 }
 
 // placeholderView returns the prompt and placeholder view, if any.
@@ -780,9 +1094,9 @@ func (m Model) placeholderView() string {
 
 	// Cursor
 	if m.blink {
-		v += m.cursorView(style(p[:1]))
+		v += m.cursorView(style(p[:1]), m.TextStyle)
 	} else {
-		v += m.cursorView(p[:1])
+		v += m.cursorView(p[:1], m.TextStyle)
 	}
 
 	// The rest of the placeholder text
@@ -791,10 +1105,11 @@ func (m Model) placeholderView() string {
 	return m.PromptStyle.Render(m.Prompt) + v
 }
 
-// cursorView styles the cursor.
-func (m Model) cursorView(v string) string {
+// cursorView styles the cursor. style is how the text under the cursor is
+// rendered while the cursor is hidden.
+func (m Model) cursorView(v string, style lipgloss.Style) string {
 	if m.blink {
-		return m.TextStyle.Render(v)
+		return style.Render(v)
 	}
 	return m.CursorStyle.Inline(true).Reverse(true).Render(v)
 }
@@ -0,0 +1,229 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// focused returns a focused model with a value, and the cursor at pos or at
+// the end if pos is -1.
+func focused(value string, pos int) Model {
+	m := New()
+	m.Focus(false)
+	m.SetValue(value)
+	if pos >= 0 {
+		m.SetCursor(pos)
+	}
+	return m
+}
+
+var (
+	right    = tea.KeyMsg{Type: tea.KeyRight}
+	altRight = tea.KeyMsg{Type: tea.KeyRight, Alt: true}
+	altF     = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'f'}, Alt: true}
+	end      = tea.KeyMsg{Type: tea.KeyEnd}
+	ctrlE    = tea.KeyMsg{Type: tea.KeyCtrlE}
+)
+
+func TestSuggestion(t *testing.T) {
+	tests := []struct {
+		value, suggestion string
+		pos               int
+		keys              []tea.KeyMsg
+		want              string
+		cur               int
+	}{
+		// Right and End accept all of it
+		{"git s", "git status", -1, []tea.KeyMsg{right}, "git status", 10},
+		{"git s", "git status", -1, []tea.KeyMsg{end}, "git status", 10},
+		{"git s", "git status", -1, []tea.KeyMsg{ctrlE}, "git status", 10},
+		{"echo ü", "echo über alles", -1, []tea.KeyMsg{right}, "echo über alles", 15},
+		// Alt+Right and Alt+F a word at a time, with the spaces before it
+		{"git c", "git commit -m  fix", -1, []tea.KeyMsg{altRight}, "git commit", 10},
+		{"git c", "git commit -m  fix", -1, []tea.KeyMsg{altF}, "git commit", 10},
+		{"git c", "git commit -m  fix", -1, []tea.KeyMsg{altF, altRight}, "git commit -m", 13},
+		{"git c", "git commit -m  fix", -1, []tea.KeyMsg{altF, altF, altF}, "git commit -m  fix", 18},
+		{"git c", "git commit -m  fix", -1, []tea.KeyMsg{altF, right}, "git commit -m  fix", 18},
+		// Multi-line suggestions are accepted whole
+		{"for", "for i in 1\ndo echo\ndone", -1, []tea.KeyMsg{right}, "for i in 1\ndo echo\ndone", 23},
+		// With the cursor before the end the keys only move it
+		{"git s", "git status", 2, []tea.KeyMsg{right}, "git s", 3},
+		{"git s", "git status", 0, []tea.KeyMsg{altRight}, "git s", 3},
+		{"git s", "git status", 1, []tea.KeyMsg{end}, "git s", 5},
+		// and so they do when there's nothing to accept
+		{"git s", "git status", -1, []tea.KeyMsg{right, right}, "git status", 10},
+		{"git x", "git status", -1, []tea.KeyMsg{right}, "git x", 5},
+		{"git x", "git status", -1, []tea.KeyMsg{altF}, "git x", 5},
+		{"", "git status", -1, []tea.KeyMsg{right}, "", 0},
+	}
+	for _, tt := range tests {
+		m := focused(tt.value, tt.pos)
+		m.SetSuggestion(tt.suggestion)
+		for _, key := range tt.keys {
+			m, _ = m.Update(key)
+		}
+		if m.Value() != tt.want || m.Cursor() != tt.cur {
+			t.Errorf("%q suggesting %q at %d after %v = %q, %d; want %q, %d",
+				tt.value, tt.suggestion, tt.pos, tt.keys, m.Value(), m.Cursor(), tt.want, tt.cur)
+		}
+	}
+}
+
+func TestSuggestionShown(t *testing.T) {
+	tests := []struct {
+		value, suggestion string
+		pos               int
+		want              string
+	}{
+		{"git s", "git status", -1, "tatus"},
+		{"git status", "git status", -1, ""},
+		{"git s", "git status", 3, ""},
+		{"git x", "git status", -1, ""},
+		{"", "git status", -1, ""},
+	}
+	for _, tt := range tests {
+		m := focused(tt.value, tt.pos)
+		m.SetSuggestion(tt.suggestion)
+		if got := m.Suggestion(); got != tt.want {
+			t.Errorf("Suggestion of %q for %q at %d = %q, want %q", tt.suggestion, tt.value, tt.pos, got, tt.want)
+		}
+	}
+}
+
+// classStyles styles letters in upper case and digits as '#', so that the
+// view shows the style each rune was rendered with.
+func classStyles(value []rune) []lipgloss.Style {
+	letter := lipgloss.NewStyle().Transform(strings.ToUpper)
+	digit := lipgloss.NewStyle().Transform(func(s string) string {
+		return strings.Repeat("#", len(s))
+	})
+	styles := make([]lipgloss.Style, len(value))
+	for i, c := range value {
+		if unicode.IsDigit(c) {
+			styles[i] = digit
+		} else {
+			styles[i] = letter
+		}
+	}
+	return styles
+}
+
+func TestStyleScroll(t *testing.T) {
+	m := focused("abc123def456", -1)
+	m.Width = 6
+	m.StyleFunc = classStyles
+	m.SetCursorMode(CursorHide)
+	m.SetCursor(len(m.value))
+
+	// Moving left from the end scrolls once the cursor passes the start of
+	// what's shown, and the runes keep their styles wherever they are
+	tests := []struct {
+		left   int
+		offset int
+		want   string
+	}{
+		{0, 6, "DEF###"},
+		{6, 6, "DEF###"},
+		{7, 5, "#DEF###"},
+		{9, 3, "###DEF#"},
+		{12, 0, "ABC###D"},
+	}
+	left := 0
+	for _, tt := range tests {
+		for ; left < tt.left; left++ {
+			m, _ = m.Update(tea.KeyMsg{Type: tea.KeyLeft})
+		}
+		if m.offset != tt.offset {
+			t.Errorf("offset %d left of the end = %d, want %d", tt.left, m.offset, tt.offset)
+		}
+		if got := strings.TrimRight(m.View(), " "); got != tt.want {
+			t.Errorf("View %d left of the end = %q, want %q", tt.left, got, tt.want)
+		}
+	}
+}
+
+func TestCursorUpDown(t *testing.T) {
+	const value = "for i in 1 2\ndo echo $i\ndone"
+	tests := []struct {
+		pos  int
+		keys string // u for CursorUp, d for CursorDown
+		want int
+		ok   bool // what the last key returned
+	}{
+		{4, "d", 17, true},    // the same column
+		{11, "d", 23, true},   // the end of a shorter line
+		{17, "dd", 28, false}, // nowhere below the last line
+		{27, "u", 16, true},
+		{27, "uu", 3, true},
+		{4, "u", 4, false}, // nor above the first
+		{4, "du", 4, true},
+		{13, "u", 0, true}, // from the start of a line
+	}
+	for _, tt := range tests {
+		m := focused(value, tt.pos)
+		var ok bool
+		for _, k := range tt.keys {
+			if k == 'u' {
+				ok = m.CursorUp()
+			} else {
+				ok = m.CursorDown()
+			}
+		}
+		if m.Cursor() != tt.want || ok != tt.ok {
+			t.Errorf("%q from %d = %d, %t; want %d, %t", tt.keys, tt.pos, m.Cursor(), ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestInsertNewline(t *testing.T) {
+	m := focused("echo ab", 6)
+	m.InsertNewline()
+	if m.Value() != "echo a\nb" || m.Cursor() != 7 || m.LineCount() != 2 {
+		t.Errorf("InsertNewline = %q at %d, want %q at 7", m.Value(), m.Cursor(), "echo a\nb")
+	}
+
+	// Alt+Enter breaks the line too
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter, Alt: true})
+	if m.Value() != "echo a\n\nb" || m.Cursor() != 8 {
+		t.Errorf("Alt+Enter = %q at %d, want %q at 8", m.Value(), m.Cursor(), "echo a\n\nb")
+	}
+
+	// but not past the limit of characters
+	m = focused("abc", -1)
+	m.CharLimit = 3
+	m.InsertNewline()
+	if m.Value() != "abc" {
+		t.Errorf("InsertNewline past the limit = %q, want %q", m.Value(), "abc")
+	}
+}
+
+func TestGutter(t *testing.T) {
+	m := focused("for i in 1\ndo echo $i\ndone", -1)
+	m.Prompt = "~ "
+	m.SetCursorMode(CursorHide)
+	want := "~ 1 │ for i in 1\n" +
+		"  2 │ do echo $i\n" +
+		"  3 │ done "
+	if got := m.View(); got != want {
+		t.Errorf("View =\n%s\nwant\n%s", got, want)
+	}
+
+	// The gutter is as wide as the last line number, and diagnostics point
+	// past it
+	m.SetValue(strings.Repeat("a\n", 9) + "b )")
+	m.SetDiagnostic(20, "syntax error")
+	lines := strings.Split(m.View(), "\n")
+	if got, want := lines[0], "~  1 │ a"; got != want {
+		t.Errorf("first line = %q, want %q", got, want)
+	}
+	if got, want := lines[9], "  10 │ b ) "; got != want {
+		t.Errorf("last line = %q, want %q", got, want)
+	}
+	if got, want := lines[10], "         ^ syntax error"; got != want {
+		t.Errorf("diagnostic = %q, want %q", got, want)
+	}
+}
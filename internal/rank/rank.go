@@ -0,0 +1,208 @@
+// Package rank boosts completions by how the commands typed were used
+// before: how often and how recently, in which directory, and after which
+// command.
+package rank
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devenjarvis/sushi/internal/frecency"
+	"github.com/devenjarvis/sushi/internal/hint"
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// maxWords is how many words of a command are counted, from its name, so
+// that arguments like messages and paths don't make too many entries.
+const maxWords = 4
+
+// maxHistory is how many of the last lines of history are learned from.
+const maxHistory = 2000
+
+// Weights of the boost for each kind of use, and the most a candidate
+// can be boosted by, so that it can't rank above better matches of another
+// kind
+const (
+	wordWeight = 3
+	dirWeight  = 4
+	nextWeight = 5
+	maxBoost   = 40
+)
+
+// Stats holds how the words of commands were used. The words are kept
+// with those before them in their command, such as "git push" for push,
+// so that they're boosted where they were used.
+type Stats struct {
+	// words ranks the words of the commands run, dirs those run in each
+	// directory, next those run after each command and lines the whole
+	// lines run, for suggestions
+	words *frecency.Store
+	dirs  *frecency.Store
+	next  *frecency.Store
+	lines *frecency.Store
+
+	mu sync.Mutex
+	// last is the command run last, as the context for next
+	last string
+	// runs counts the lines run, and ran holds when each was run last by
+	// that count, to tell the latest of those ranking the same
+	runs int
+	ran  map[string]int
+}
+
+// Load returns stats keeping the words run in each directory in the file
+// at path, which history doesn't tell. The file doesn't have to exist yet.
+func Load(path string) (*Stats, error) {
+	dirs, err := frecency.Load(path)
+	return &Stats{words: frecency.New(), dirs: dirs, next: frecency.New(), lines: frecency.New(), ran: make(map[string]int)}, err
+}
+
+// Run is a line of history, with when it was run, or a zero Time for the
+// lines kept before history had times.
+type Run struct {
+	Line string
+	Time time.Time
+}
+
+// Learn counts the words of the lines of history, oldest first. They're
+// counted apart, then added to those of the lines run since, so that
+// running Learn in the background doesn't lose them.
+func (s *Stats) Learn(history []Run) {
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	learned := &Stats{words: frecency.New(), dirs: frecency.New(), next: frecency.New(), lines: frecency.New(), ran: make(map[string]int)}
+	for _, run := range history {
+		learned.Record("", run.Line, run.Time)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.words.Merge(learned.words)
+	s.next.Merge(learned.next)
+	s.lines.Merge(learned.lines)
+
+	// The lines run since come after those of history
+	for line, n := range s.ran {
+		s.ran[line] = n + learned.runs
+	}
+	for line, n := range learned.ran {
+		if _, ok := s.ran[line]; !ok {
+			s.ran[line] = n
+		}
+	}
+	s.runs += learned.runs
+	if s.last == "" {
+		s.last = learned.last
+	}
+}
+
+// Record counts the words of a line run in dir at t, or in no directory
+// known if dir is empty.
+func (s *Stats) Record(dir, line string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if line = strings.TrimSpace(line); line != "" {
+		s.lines.Add(line, t)
+		s.runs++
+		s.ran[line] = s.runs
+	}
+	for _, words := range syntax.Commands(line) {
+		for _, key := range keys(words) {
+			s.words.Add(key, t)
+			if dir != "" {
+				s.dirs.Add(dir+"\t"+key, t)
+			}
+			if s.last != "" {
+				s.next.Add(s.last+"\t"+key, t)
+			}
+		}
+		s.last = commandContext(words)
+	}
+}
+
+// keys returns the keys of the words of a command: each word with those
+// before it, up to the first one that isn't literal text.
+func keys(words []string) []string {
+	var keys []string
+	for i, word := range words[:min(len(words), maxWords)] {
+		if word == "" {
+			break
+		}
+		keys = append(keys, strings.Join(words[:i+1], " "))
+	}
+	return keys
+}
+
+// commandContext returns what's kept of a command as the context of the
+// one after it: its name and subcommand, such as "git commit".
+func commandContext(words []string) string {
+	if len(words) > 1 && words[1] != "" && !strings.HasPrefix(words[1], "-") {
+		return words[0] + " " + words[1]
+	}
+	return words[0]
+}
+
+// Save writes the words run in each directory to the file.
+func (s *Stats) Save() error {
+	return s.dirs.Save()
+}
+
+// Boost returns how much a candidate is boosted in the line completed.
+func (s *Stats) Boost(line hint.Line, c hint.Candidate) int {
+	value := c.Value
+	if value == "" {
+		value = c.Text
+	}
+	words := append(append([]string(nil), line.Args...), value)
+	ks := keys(words)
+	if len(ks) < len(words) {
+		// Not counted
+		return 0
+	}
+	key := ks[len(ks)-1]
+
+	s.mu.Lock()
+	last := s.last
+	s.mu.Unlock()
+	boost := weight(s.words.Score(key), wordWeight) + weight(s.dirs.Score(line.Dir+"\t"+key), dirWeight)
+	if last != "" {
+		boost += weight(s.next.Score(last+"\t"+key), nextWeight)
+	}
+	return min(boost, maxBoost)
+}
+
+// Suggest returns the line run before that best completes prefix: the one
+// run most often and recently, or the latest of those ranking the same.
+func (s *Stats) Suggest(prefix string) string {
+	if strings.TrimSpace(prefix) == "" {
+		return ""
+	}
+	ranked := s.lines.Ranked(func(line string) bool {
+		return len(line) > len(prefix) && strings.HasPrefix(line, prefix)
+	})
+	if len(ranked) == 0 {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	best := ranked[0]
+	for _, r := range ranked[1:] {
+		if r.Score < best.Score {
+			break
+		}
+		if s.ran[r.Key] > s.ran[best.Key] {
+			best = r
+		}
+	}
+	return best.Key
+}
+
+// weight returns the boost for a frecency score, which grows slower the
+// more a word was used.
+func weight(score float64, w int) int {
+	return int(float64(w) * math.Log2(1+score))
+}
@@ -0,0 +1,83 @@
+package rank
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newStats(t *testing.T) *Stats {
+	t.Helper()
+	s, err := Load(filepath.Join(t.TempDir(), "context"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestLearn(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		history []Run
+		want    string
+	}{
+		{
+			// Run more often, but days ago
+			name: "recent",
+			history: []Run{
+				{"git stash", now.Add(-72 * time.Hour)},
+				{"git stash", now.Add(-72 * time.Hour)},
+				{"git stash", now.Add(-71 * time.Hour)},
+				{"git status", now.Add(-time.Minute)},
+			},
+			want: "git status",
+		},
+		{
+			// Kept before history had times, so only how often counts
+			name: "untimed",
+			history: []Run{
+				{"git stash", time.Time{}},
+				{"git status", time.Time{}},
+				{"git stash", time.Time{}},
+			},
+			want: "git stash",
+		},
+		{
+			// Taken to be older than those with times
+			name: "untimed older",
+			history: []Run{
+				{"git stash", time.Time{}},
+				{"git status", now.Add(-48 * time.Hour)},
+			},
+			want: "git status",
+		},
+	}
+	for _, tt := range tests {
+		s := newStats(t)
+		s.Learn(tt.history)
+		if got := s.Suggest("git sta"); got != tt.want {
+			t.Errorf("%s: Suggest = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLearnAfterRecord(t *testing.T) {
+	s := newStats(t)
+	now := time.Now()
+	s.Record("", "make test", now)
+	s.Learn([]Run{{"make build", now.Add(-time.Minute)}, {"go vet", now.Add(-time.Minute)}})
+
+	// The line run since history is still the latest, and the command
+	// before the next
+	if got := s.Suggest("make "); got != "make test" {
+		t.Errorf("Suggest = %q, want make test", got)
+	}
+	if s.last != "make test" {
+		t.Errorf("last = %q, want make test", s.last)
+	}
+	s.Record("", "go build", now)
+	if s.next.Score("make test\tgo") == 0 {
+		t.Errorf("go isn't counted as run after make test")
+	}
+}
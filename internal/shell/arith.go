@@ -0,0 +1,479 @@
+package shell
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// arith evaluates an arithmetic expression, as in $((...)), whose
+// expansions have already been done. Variables are read and assigned as
+// integers.
+func (r *Runner) arith(expr string) (int64, error) {
+	return r.arithDepth(expr, 0)
+}
+
+// maxArithDepth limits how deeply variables holding expressions are
+// evaluated, so x=x doesn't recurse forever.
+const maxArithDepth = 64
+
+func (r *Runner) arithDepth(expr string, depth int) (int64, error) {
+	if depth > maxArithDepth {
+		return 0, fmt.Errorf("%s: expression recursion level exceeded", expr)
+	}
+	p := &arithParser{r: r, src: expr, depth: depth, eval: true}
+	p.next()
+	if p.tok == "" {
+		return 0, nil
+	}
+
+	n := p.value(p.comma())
+	if p.err == nil && p.tok != "" {
+		p.fail("syntax error in expression")
+	}
+	if p.err != nil {
+		return 0, p.err
+	}
+	return n, nil
+}
+
+// operand is the value of a subexpression. name is set when it's a plain
+// variable or an array element, which can be assigned to.
+type operand struct {
+	n     int64
+	name  string
+	index *int64
+}
+
+type arithParser struct {
+	r     *Runner
+	src   string
+	pos   int // position after the current token
+	tok   string
+	depth int
+	err   error
+
+	// eval is cleared while parsing a subexpression that short-circuit
+	// evaluation skips, so it has no side effects
+	eval bool
+}
+
+var arithOps = []string{
+	"<<=", ">>=", "**", "++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+=", "-=", "*=", "/=", "%=", "&=", "^=", "|=",
+	"+", "-", "*", "/", "%", "<", ">", "=", "!", "~", "&", "^", "|", "?", ":", ",", "(", ")", "[", "]",
+}
+
+// next moves to the next token, which is "" at the end of the expression.
+func (p *arithParser) next() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		p.tok = ""
+		return
+	}
+
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case isDigit(c) || isNameByte(c):
+		for p.pos < len(p.src) && (isNameByte(p.src[p.pos]) || isDigit(p.src[p.pos]) || p.src[p.pos] == '#' || p.src[p.pos] == '@') {
+			p.pos++
+		}
+	default:
+		for _, op := range arithOps {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.pos += len(op)
+				break
+			}
+		}
+		if p.pos == start {
+			p.pos++
+		}
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+// fail records a syntax error at the current token.
+func (p *arithParser) fail(msg string) {
+	token := p.tok
+	if token == "" {
+		token = "end of expression"
+	}
+	p.evalError(fmt.Sprintf("%s (error token is \"%s\")", msg, token))
+}
+
+// evalError records an error in evaluating the expression.
+func (p *arithParser) evalError(msg string) {
+	if p.err == nil {
+		p.err = fmt.Errorf("%s: %s", strings.TrimSpace(p.src), msg)
+	}
+}
+
+// value returns the integer value of an operand, reading its variable.
+func (p *arithParser) value(v operand) int64 {
+	if v.name == "" || !p.eval || p.err != nil {
+		return v.n
+	}
+	s, ok := p.r.getVar(v.name)
+	if v.index != nil {
+		var err error
+		if s, ok, err = p.r.element(v.name, strconv.FormatInt(*v.index, 10)); err != nil {
+			p.err = err
+			return 0
+		}
+	}
+	if !ok && p.r.opts["nounset"] {
+		p.err = fmt.Errorf("%s: unbound variable", v.name)
+		return 0
+	}
+	if strings.TrimSpace(s) == "" {
+		return 0
+	}
+	n, err := p.r.arithDepth(s, p.depth+1)
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	return n
+}
+
+// assign sets the variable of an operand.
+func (p *arithParser) assign(v operand, n int64) operand {
+	if v.name == "" {
+		p.fail("attempted assignment to non-variable")
+		return operand{}
+	}
+	if p.eval && p.err == nil {
+		if v.index == nil {
+			p.r.setVar(v.name, strconv.FormatInt(n, 10))
+		} else if err := p.r.setElement(v.name, strconv.FormatInt(*v.index, 10), strconv.FormatInt(n, 10), false); err != nil {
+			p.err = err
+		}
+	}
+	return operand{n: n}
+}
+
+func (p *arithParser) comma() operand {
+	v := p.assignment()
+	for p.err == nil && p.tok == "," {
+		p.next()
+		v = p.assignment()
+	}
+	return v
+}
+
+func (p *arithParser) assignment() operand {
+	v := p.ternary()
+	if p.err != nil {
+		return v
+	}
+	switch op := p.tok; op {
+	case "=", "+=", "-=", "*=", "/=", "%=", "<<=", ">>=", "&=", "^=", "|=":
+		if v.name == "" {
+			p.fail("attempted assignment to non-variable")
+			return v
+		}
+		p.next()
+		rhs := p.value(p.assignment())
+		if op == "=" {
+			return p.assign(v, rhs)
+		}
+		return p.assign(v, p.binop(strings.TrimSuffix(op, "="), p.value(v), rhs))
+	}
+	return v
+}
+
+func (p *arithParser) ternary() operand {
+	v := p.binary(0)
+	if p.err != nil || p.tok != "?" {
+		return v
+	}
+	p.next()
+
+	cond := p.value(v) != 0
+	eval := p.eval
+
+	p.eval = eval && cond
+	x := p.value(p.assignment())
+	if p.tok != ":" {
+		p.fail("':' expected for conditional expression")
+		return v
+	}
+	p.next()
+	p.eval = eval && !cond
+	y := p.value(p.ternary())
+	p.eval = eval
+
+	if cond {
+		return operand{n: x}
+	}
+	return operand{n: y}
+}
+
+// Binary operators from lowest to highest precedence. All are left
+// associative.
+var arithLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *arithParser) binary(level int) operand {
+	if level == len(arithLevels) {
+		return p.power()
+	}
+
+	v := p.binary(level + 1)
+	for p.err == nil && contains(arithLevels[level], p.tok) {
+		op := p.tok
+		p.next()
+		x := p.value(v)
+
+		// && and || don't evaluate their right side when the left decides
+		eval := p.eval
+		if op == "&&" && x == 0 || op == "||" && x != 0 {
+			p.eval = false
+		}
+		y := p.value(p.binary(level + 1))
+		p.eval = eval
+
+		v = operand{n: p.binop(op, x, y)}
+	}
+	return v
+}
+
+func (p *arithParser) power() operand {
+	v := p.unary()
+	if p.err != nil || p.tok != "**" {
+		return v
+	}
+	p.next()
+	x := p.value(v)
+	y := p.value(p.power()) // right associative
+	return operand{n: p.binop("**", x, y)}
+}
+
+func (p *arithParser) unary() operand {
+	switch op := p.tok; op {
+	case "+", "-", "!", "~":
+		p.next()
+		x := p.value(p.unary())
+		switch op {
+		case "-":
+			x = -x
+		case "!":
+			x = boolInt(x == 0)
+		case "~":
+			x = ^x
+		}
+		return operand{n: x}
+	case "++", "--":
+		p.next()
+		v := p.unary()
+		if v.name == "" {
+			p.fail("attempted assignment to non-variable")
+			return v
+		}
+		delta := int64(1)
+		if op == "--" {
+			delta = -1
+		}
+		return p.assign(v, p.value(v)+delta)
+	}
+	return p.postfix()
+}
+
+func (p *arithParser) postfix() operand {
+	v := p.primary()
+	if p.err == nil && v.name != "" && (p.tok == "++" || p.tok == "--") {
+		delta := int64(1)
+		if p.tok == "--" {
+			delta = -1
+		}
+		p.next()
+		old := p.value(v)
+		p.assign(v, old+delta)
+		return operand{n: old}
+	}
+	return v
+}
+
+func (p *arithParser) primary() operand {
+	tok := p.tok
+	switch {
+	case tok == "(":
+		p.next()
+		v := p.comma()
+		if p.err == nil && p.tok != ")" {
+			p.fail("missing ')'")
+		}
+		p.next()
+		return operand{n: p.value(v)}
+	case tok != "" && isDigit(tok[0]):
+		n, err := parseArithNumber(tok)
+		if err != nil {
+			p.fail(err.Error())
+		}
+		p.next()
+		return operand{n: n}
+	case tok != "" && isNameByte(tok[0]):
+		if !isName(tok) {
+			p.fail("syntax error in expression")
+		}
+		p.next()
+		if p.tok != "[" {
+			return operand{name: tok}
+		}
+		p.next()
+		index := p.value(p.comma())
+		if p.err == nil && p.tok != "]" {
+			p.fail("missing ']'")
+		}
+		p.next()
+		return operand{name: tok, index: &index}
+	}
+	p.fail("syntax error: operand expected")
+	return operand{}
+}
+
+func (p *arithParser) binop(op string, x, y int64) int64 {
+	switch op {
+	case "||":
+		return boolInt(x != 0 || y != 0)
+	case "&&":
+		return boolInt(x != 0 && y != 0)
+	case "|":
+		return x | y
+	case "^":
+		return x ^ y
+	case "&":
+		return x & y
+	case "==":
+		return boolInt(x == y)
+	case "!=":
+		return boolInt(x != y)
+	case "<":
+		return boolInt(x < y)
+	case "<=":
+		return boolInt(x <= y)
+	case ">":
+		return boolInt(x > y)
+	case ">=":
+		return boolInt(x >= y)
+	case "<<":
+		return x << uint64(y&63)
+	case ">>":
+		return x >> uint64(y&63)
+	case "+":
+		return x + y
+	case "-":
+		return x - y
+	case "*":
+		return x * y
+	case "/", "%":
+		if y == 0 {
+			if p.eval {
+				p.evalError("division by 0")
+			}
+			return 0
+		}
+		if op == "/" {
+			return x / y
+		}
+		return x % y
+	case "**":
+		if y < 0 {
+			if p.eval {
+				p.evalError("exponent less than 0")
+			}
+			return 0
+		}
+		n := int64(1)
+		for ; y > 0; y-- {
+			n *= x
+		}
+		return n
+	}
+	return 0
+}
+
+// parseArithNumber parses an integer constant: decimal, octal with a
+// leading 0, hexadecimal with 0x, or base#digits for bases 2 to 64.
+func parseArithNumber(s string) (int64, error) {
+	base := int64(10)
+	digits := s
+	if b, rest, ok := strings.Cut(s, "#"); ok {
+		n, err := strconv.ParseInt(b, 10, 64)
+		if err != nil || n < 2 || n > 64 {
+			return 0, fmt.Errorf("invalid arithmetic base")
+		}
+		base, digits = n, rest
+	} else if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		base, digits = 16, s[2:]
+	} else if len(s) > 1 && s[0] == '0' {
+		base, digits = 8, s[1:]
+	}
+	if digits == "" {
+		return 0, fmt.Errorf("invalid number")
+	}
+
+	var n int64
+	for i := 0; i < len(digits); i++ {
+		var d int64
+		switch c := digits[i]; {
+		case isDigit(c):
+			d = int64(c - '0')
+		case c >= 'a' && c <= 'z':
+			d = int64(c-'a') + 10
+		case c >= 'A' && c <= 'Z':
+			// Letters are case insensitive up to base 36
+			d = int64(c-'A') + 10
+			if base > 36 {
+				d += 26
+			}
+		case c == '@':
+			d = 62
+		case c == '_':
+			d = 63
+		default:
+			return 0, fmt.Errorf("invalid number")
+		}
+		if d >= base {
+			return 0, fmt.Errorf("value too great for base")
+		}
+		n = n*base + d
+	}
+	return n, nil
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
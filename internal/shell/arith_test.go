@@ -0,0 +1,92 @@
+package shell
+
+import "testing"
+
+func TestArith(t *testing.T) {
+	tests := []struct {
+		expr string
+		want int64
+	}{
+		{"", 0},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"7 / 2", 3},
+		{"-7 / 2", -3},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", 4},
+		{"0x10 + 010 + 2#101 + 16#ff", 16 + 8 + 5 + 255},
+		{"1 << 4 | 1", 17},
+		{"6 & 3 ^ 1", 3},
+		{"~0", -1},
+		{"!0 + !5", 1},
+		{"3 > 2 && 2 >= 3 || 1 == 1", 1},
+		{"1 != 1", 0},
+		{"x + 1", 6},
+		{"x * y", 15},
+		{"unset + 1", 1},
+		{"empty + 1", 1},
+		{"expr * 2", 12},
+		{"x > 1 ? 10 : 20", 10},
+		{"0 ? 1 : 0 ? 2 : 3", 3},
+		{"1, 2, 3", 3},
+	}
+	for _, tt := range tests {
+		r := New(t.TempDir())
+		r.SetVar("x", "5")
+		r.SetVar("y", "3")
+		r.SetVar("empty", "")
+		r.SetVar("expr", "x + 1")
+		got, err := r.arith(tt.expr)
+		if err != nil || got != tt.want {
+			t.Errorf("arith(%q) = %d, %v; want %d", tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+func TestArithAssign(t *testing.T) {
+	tests := []struct {
+		expr string
+		want int64
+		x    string
+	}{
+		{"x = 2", 2, "2"},
+		{"x += 2", 7, "7"},
+		{"x -= 2", 3, "3"},
+		{"x *= 2", 10, "10"},
+		{"x /= 2", 2, "2"},
+		{"x %= 2", 1, "1"},
+		{"x <<= 1", 10, "10"},
+		{"x |= 2", 7, "7"},
+		{"x++", 5, "6"},
+		{"++x", 6, "6"},
+		{"x--", 5, "4"},
+		{"--x", 4, "4"},
+		{"y = x = 1", 1, "1"},
+		{"0 && (x = 1)", 0, "5"},
+		{"1 || (x = 1)", 1, "5"},
+		{"1 ? x : (x = 1)", 5, "5"},
+	}
+	for _, tt := range tests {
+		r := New(t.TempDir())
+		r.SetVar("x", "5")
+		got, err := r.arith(tt.expr)
+		if err != nil || got != tt.want {
+			t.Errorf("arith(%q) = %d, %v; want %d", tt.expr, got, err, tt.want)
+		}
+		if x, _ := r.Var("x"); x != tt.x {
+			t.Errorf("arith(%q) left x = %q, want %q", tt.expr, x, tt.x)
+		}
+	}
+}
+
+func TestArithError(t *testing.T) {
+	for _, expr := range []string{"1 / 0", "1 % 0", "1 +", "(1", "1 2", "2 ** -1", "3 = 1", "08", "x = x", "1 ? 2"} {
+		r := New(t.TempDir())
+		r.SetVar("x", "x")
+		if got, err := r.arith(expr); err == nil {
+			t.Errorf("arith(%q) = %d, want an error", expr, got)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package shell
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// braceItem is a rune of unquoted literal text in a word, which may take
+// part in brace expansion, or any other part of the word.
+type braceItem struct {
+	r    rune
+	part syntax.WordPart
+}
+
+func (it braceItem) is(r rune) bool {
+	return it.part == nil && it.r == r
+}
+
+// braces performs brace expansion on the parts of a word, returning the
+// parts of each resulting word. Braces only take effect in unquoted literal
+// text, but the alternatives may contain expansions, as in {$a,b}.
+func braces(parts []syntax.WordPart) [][]syntax.WordPart {
+	hasBrace := false
+	for _, part := range parts {
+		if lit, ok := part.(*syntax.Lit); ok && !lit.Quoted && strings.ContainsRune(lit.Value, '{') {
+			hasBrace = true
+			break
+		}
+	}
+	if !hasBrace {
+		return [][]syntax.WordPart{parts}
+	}
+
+	var items []braceItem
+	for _, part := range parts {
+		if lit, ok := part.(*syntax.Lit); ok && !lit.Quoted {
+			for _, r := range lit.Value {
+				items = append(items, braceItem{r: r})
+			}
+			continue
+		}
+		items = append(items, braceItem{part: part})
+	}
+
+	var words [][]syntax.WordPart
+	for _, word := range braceExpand(items) {
+		words = append(words, braceParts(word))
+	}
+	return words
+}
+
+// braceExpand expands the first brace expression in items, and recursively
+// the ones in its alternatives and the items after it.
+func braceExpand(items []braceItem) [][]braceItem {
+	for i := range items {
+		if !items[i].is('{') {
+			continue
+		}
+
+		// Find the matching close brace and the commas at this level
+		depth, end := 0, -1
+		var commas []int
+	scan:
+		for j := i + 1; j < len(items); j++ {
+			switch {
+			case items[j].is('{'):
+				depth++
+			case items[j].is('}'):
+				if depth == 0 {
+					end = j
+					break scan
+				}
+				depth--
+			case items[j].is(',') && depth == 0:
+				commas = append(commas, j)
+			}
+		}
+		if end < 0 {
+			continue
+		}
+
+		var alts [][]braceItem
+		if len(commas) > 0 {
+			start := i + 1
+			for _, comma := range append(commas, end) {
+				alts = append(alts, items[start:comma])
+				start = comma + 1
+			}
+		} else if alts = braceSeq(items[i+1 : end]); alts == nil {
+			// Not an expression, like {} or {a}; look for one inside
+			continue
+		}
+
+		var words [][]braceItem
+		suffixes := braceExpand(items[end+1:])
+		for _, alt := range alts {
+			for _, expanded := range braceExpand(alt) {
+				for _, suffix := range suffixes {
+					word := append(append(append([]braceItem(nil), items[:i]...), expanded...), suffix...)
+					words = append(words, word)
+				}
+			}
+		}
+		return words
+	}
+	return [][]braceItem{items}
+}
+
+// braceSeq expands a sequence expression such as 1..10, a..e or 01..10..2,
+// or returns nil if items isn't one.
+func braceSeq(items []braceItem) [][]braceItem {
+	var b strings.Builder
+	for _, it := range items {
+		if it.part != nil {
+			return nil
+		}
+		b.WriteRune(it.r)
+	}
+	bounds := strings.Split(b.String(), "..")
+	if len(bounds) != 2 && len(bounds) != 3 {
+		return nil
+	}
+
+	step := 1
+	if len(bounds) == 3 {
+		n, err := strconv.Atoi(bounds[2])
+		if err != nil {
+			return nil
+		}
+		step = max(abs(n), 1)
+	}
+
+	var seq []string
+	from, err1 := strconv.Atoi(bounds[0])
+	to, err2 := strconv.Atoi(bounds[1])
+	switch {
+	case err1 == nil && err2 == nil:
+		// Zero-pad to the widest bound if either has a leading zero
+		width := 0
+		if hasLeadingZero(bounds[0]) || hasLeadingZero(bounds[1]) {
+			width = max(len(bounds[0]), len(bounds[1]))
+		}
+		for _, n := range intSeq(from, to, step) {
+			seq = append(seq, padInt(n, width))
+		}
+	case isSeqChar(bounds[0]) && isSeqChar(bounds[1]):
+		for _, n := range intSeq(int(bounds[0][0]), int(bounds[1][0]), step) {
+			seq = append(seq, string(rune(n)))
+		}
+	default:
+		return nil
+	}
+
+	alts := make([][]braceItem, len(seq))
+	for i, s := range seq {
+		for _, r := range s {
+			alts[i] = append(alts[i], braceItem{r: r})
+		}
+	}
+	return alts
+}
+
+// intSeq counts from from to to inclusive, in either direction.
+func intSeq(from, to, step int) []int {
+	var seq []int
+	if from <= to {
+		for n := from; n <= to; n += step {
+			seq = append(seq, n)
+		}
+	} else {
+		for n := from; n >= to; n -= step {
+			seq = append(seq, n)
+		}
+	}
+	return seq
+}
+
+func hasLeadingZero(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0'
+}
+
+func padInt(n, width int) string {
+	s := strconv.Itoa(abs(n))
+	if n < 0 {
+		width--
+	}
+	if len(s) < width {
+		s = strings.Repeat("0", width-len(s)) + s
+	}
+	if n < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+func isSeqChar(s string) bool {
+	return len(s) == 1 && (s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z')
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// braceParts turns items back into word parts, joining runs of runes into
+// literals.
+func braceParts(items []braceItem) []syntax.WordPart {
+	var parts []syntax.WordPart
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			parts = append(parts, &syntax.Lit{Value: lit.String()})
+			lit.Reset()
+		}
+	}
+	for _, it := range items {
+		if it.part != nil {
+			flush()
+			parts = append(parts, it.part)
+			continue
+		}
+		lit.WriteRune(it.r)
+	}
+	flush()
+	return parts
+}
@@ -0,0 +1,41 @@
+package shell
+
+import "testing"
+
+func TestBraceExpansion(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`echo {a,b,c}`, "a b c"},
+		{`echo x{a,b}y`, "xay xby"},
+		{`echo {a,b}{1,2}`, "a1 a2 b1 b2"},
+		{`echo {a,{b,c}}d`, "ad bd cd"},
+		{`echo {a,}x`, "ax x"},
+		{`echo src/{api,web,cli}/`, "src/api/ src/web/ src/cli/"},
+		{`echo {1..5}`, "1 2 3 4 5"},
+		{`echo {5..1}`, "5 4 3 2 1"},
+		{`echo {1..10..3}`, "1 4 7 10"},
+		{`echo {10..1..-3}`, "10 7 4 1"},
+		{`echo {-2..2}`, "-2 -1 0 1 2"},
+		{`echo {01..10}`, "01 02 03 04 05 06 07 08 09 10"},
+		{`echo {-01..1}`, "-01 000 001"},
+		{`echo {a..e}`, "a b c d e"},
+		{`echo {e..a..2}`, "e c a"},
+		{`echo {1..3}{a,b}`, "1a 1b 2a 2b 3a 3b"},
+
+		// Not expanded
+		{`echo {a}`, "{a}"},
+		{`echo {}`, "{}"},
+		{`echo {a..1}`, "{a..1}"},
+		{`echo {1..2..}`, "{1..2..}"},
+		{`echo "{a,b}" '{a,b}' \{a,b}`, "{a,b} {a,b} {a,b}"},
+		{`echo {a,b`, "{a,b"},
+		{`echo a,b}`, "a,b}"},
+	}
+	for _, tt := range tests {
+		if got, _ := run(t, t.TempDir(), tt.src); got != tt.want+"\n" {
+			t.Errorf("Run(%q) = %q, want %q", tt.src, got, tt.want+"\n")
+		}
+	}
+}
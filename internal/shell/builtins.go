@@ -0,0 +1,417 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// builtinFunc runs a builtin command and returns its exit status.
+type builtinFunc func(ctx context.Context, r *Runner, args []string) int
+
+var builtins map[string]builtinFunc
+
+func init() {
+	builtins = map[string]builtinFunc{
+		"cd":       builtinCd,
+		"pushd":    builtinPushd,
+		"popd":     builtinPopd,
+		"dirs":     builtinDirs,
+		"pwd":      builtinPwd,
+		"z":        builtinZ,
+		"type":     builtinType,
+		"which":    builtinWhich,
+		"command":  builtinCommand,
+		"builtin":  builtinBuiltin,
+		"hash":     builtinHash,
+		"exit":     builtinExit,
+		"export":   builtinExport,
+		"declare":  builtinDeclare,
+		"typeset":  builtinDeclare,
+		"unset":    builtinUnset,
+		"set":      builtinSet,
+		"trap":     builtinTrap,
+		"jobs":     builtinJobs,
+		"wait":     builtinWait,
+		"shopt":    builtinShopt,
+		"read":     builtinRead,
+		"break":    builtinBreak,
+		"continue": builtinBreak,
+		"true":     func(context.Context, *Runner, []string) int { return 0 },
+		":":        func(context.Context, *Runner, []string) int { return 0 },
+		"false":    func(context.Context, *Runner, []string) int { return 1 },
+	}
+}
+
+// IsBuiltin reports whether name is a builtin command.
+func IsBuiltin(name string) bool {
+	_, ok := builtins[name]
+	return ok
+}
+
+// Builtins returns the names of the builtin commands, sorted.
+func Builtins() []string {
+	var names []string
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func builtinExit(ctx context.Context, r *Runner, args []string) int {
+	code := r.status
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			r.errorf("exit: %s: numeric argument required", args[1])
+			n = 2
+		}
+		code = n & 0xff
+	}
+	// Warn once about running jobs, unless exit is repeated right away
+	if r.Interactive && r.runningJobs() > 0 && !r.exitWarnedLast && !r.exitWarned {
+		r.errorf("exit: there are running jobs; exit again to end them")
+		r.exitWarned = true
+		return 1
+	}
+	r.exiting = true
+	r.exitCode = code
+	return code
+}
+
+func builtinExport(ctx context.Context, r *Runner, args []string) int {
+	if len(args) == 1 {
+		for _, kv := range r.environ() {
+			name, value, _ := strings.Cut(kv, "=")
+			fmt.Fprintf(r.Stdout, "export %s=%s\n", name, strconv.Quote(value))
+		}
+		return 0
+	}
+
+	status := 0
+	for _, arg := range args[1:] {
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !isName(name) {
+			r.errorf("export: '%s': not a valid identifier", arg)
+			status = 1
+			continue
+		}
+		v, ok := r.vars[name]
+		if !ok {
+			v = &Variable{}
+			r.vars[name] = v
+		}
+		v.Exported = true
+		if hasValue {
+			r.setVar(name, value)
+		}
+	}
+	return status
+}
+
+func builtinUnset(ctx context.Context, r *Runner, args []string) int {
+	status := 0
+	for _, arg := range args[1:] {
+		if arg == "-v" {
+			continue
+		}
+		name, index, hasIndex := cutIndex(arg)
+		if !isName(name) {
+			r.errorf("unset: '%s': not a valid identifier", arg)
+			status = 1
+			continue
+		}
+		if !hasIndex {
+			delete(r.vars, name)
+		} else if err := r.unsetElement(name, index); err != nil {
+			r.errorf("unset: %v", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// builtinDeclare implements declare and typeset when they aren't parsed as
+// a declaration, as when the command name comes from an expansion, so
+// arrays can only be given elements one at a time.
+func builtinDeclare(ctx context.Context, r *Runner, args []string) int {
+	d := &declaration{r: r, cmd: args[0]}
+	for _, arg := range args[1:] {
+		d.arg(arg)
+	}
+	return d.finish()
+}
+
+// declClause runs a declaration, whose assignments are parsed like the ones
+// before a command so they can assign whole arrays.
+func (r *Runner) declClause(ctx context.Context, decl *syntax.DeclClause) {
+	d := &declaration{r: r, cmd: decl.Variant}
+	for _, as := range decl.Args {
+		if !as.Naked {
+			d.assign(ctx, as)
+			continue
+		}
+		args, err := r.fields(ctx, as.Value)
+		if err != nil {
+			r.expandError(err)
+			return
+		}
+		for _, arg := range args {
+			d.arg(arg)
+		}
+	}
+	r.status = d.finish()
+}
+
+// declaration holds the options and progress of declare.
+type declaration struct {
+	r   *Runner
+	cmd string
+
+	array, assoc, export, unexport, print bool
+
+	// named is set once options have ended, with the first name or --
+	named  bool
+	shown  bool
+	status int
+}
+
+// arg handles an option, a name or a name=value argument.
+func (d *declaration) arg(arg string) {
+	if !d.named && arg == "--" {
+		d.named = true
+		return
+	}
+	if !d.named && len(arg) > 1 && (arg[0] == '-' || arg[0] == '+') {
+		for _, c := range arg[1:] {
+			switch c {
+			case 'a':
+				d.array = true
+			case 'A':
+				d.assoc = true
+			case 'x':
+				d.export = arg[0] == '-'
+				d.unexport = arg[0] == '+'
+			case 'p':
+				d.print = true
+			case 'g':
+				// Every variable is global
+			default:
+				d.r.errorf("%s: %s: invalid option", d.cmd, arg)
+				d.status = 2
+				return
+			}
+		}
+		return
+	}
+	d.named = true
+
+	name, value, hasValue := strings.Cut(arg, "=")
+	add := false
+	if hasValue && strings.HasSuffix(name, "+") {
+		name, add = strings.TrimSuffix(name, "+"), true
+	}
+	name, index, hasIndex := cutIndex(name)
+	if d.print {
+		d.show(name)
+		return
+	}
+	if !d.declare(name) {
+		return
+	}
+
+	var err error
+	switch {
+	case hasIndex:
+		err = d.r.setElement(name, index, value, add)
+	case hasValue && add:
+		old, _ := d.r.getVar(name)
+		d.r.setVar(name, old+value)
+	case hasValue:
+		d.r.setVar(name, value)
+	}
+	if err != nil {
+		d.r.errorf("%s: %v", d.cmd, err)
+		d.status = 1
+	}
+}
+
+// assign handles a parsed assignment.
+func (d *declaration) assign(ctx context.Context, as *syntax.Assign) {
+	d.named = true
+	if !d.declare(as.Name) {
+		return
+	}
+	if err := d.r.assign(ctx, as); err != nil {
+		d.r.errorf("%s: %v", d.cmd, err)
+		d.status = 1
+	}
+}
+
+// declare gives a variable the attributes of the declaration, creating it
+// if it's to be an array or exported.
+func (d *declaration) declare(name string) bool {
+	if !isName(name) {
+		d.r.errorf("%s: '%s': not a valid identifier", d.cmd, name)
+		d.status = 1
+		return false
+	}
+
+	v, ok := d.r.vars[name]
+	if !ok {
+		if !d.array && !d.assoc && !d.export {
+			return true
+		}
+		v = &Variable{}
+		d.r.vars[name] = v
+	}
+
+	switch {
+	case d.assoc && v.Indexed != nil:
+		d.r.errorf("%s: %s: cannot convert indexed to associative array", d.cmd, name)
+		d.status = 1
+		return false
+	case d.array && v.Assoc != nil:
+		d.r.errorf("%s: %s: cannot convert associative to indexed array", d.cmd, name)
+		d.status = 1
+		return false
+	case d.assoc && v.Assoc == nil:
+		v.Assoc = make(map[string]string)
+		if ok {
+			v.Assoc["0"] = v.Value
+		}
+		v.Value = ""
+	case d.array && v.Indexed == nil:
+		v.Indexed = make(map[int]string)
+		if ok {
+			v.Indexed[0] = v.Value
+		}
+		v.Value = ""
+	}
+
+	if d.export {
+		v.Exported = true
+	}
+	if d.unexport {
+		v.Exported = false
+	}
+	return true
+}
+
+// finish lists the variables when no names were given, and returns the
+// exit status.
+func (d *declaration) finish() int {
+	if d.named || d.status != 0 {
+		if d.print && !d.shown && d.status == 0 {
+			d.status = 1
+		}
+		return d.status
+	}
+
+	var names []string
+	for name, v := range d.r.vars {
+		if d.array && v.Indexed == nil || d.assoc && v.Assoc == nil || d.export && !v.Exported {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		d.show(name)
+	}
+	return 0
+}
+
+// show prints a variable as the declare command that would recreate it.
+func (d *declaration) show(name string) {
+	v, ok := d.r.vars[name]
+	if !ok {
+		d.r.errorf("%s: %s: not found", d.cmd, name)
+		d.status = 1
+		return
+	}
+	d.shown = true
+
+	flags := ""
+	switch {
+	case v.Indexed != nil:
+		flags += "a"
+	case v.Assoc != nil:
+		flags += "A"
+	}
+	if v.Exported {
+		flags += "x"
+	}
+	if flags == "" {
+		flags = "-"
+	}
+
+	if !v.isArray() {
+		fmt.Fprintf(d.r.Stdout, "declare -%s %s=%s\n", flags, name, strconv.Quote(v.Value))
+		return
+	}
+	var elems []string
+	values := v.elements()
+	for i, key := range v.keys() {
+		elems = append(elems, fmt.Sprintf("[%s]=%s", key, strconv.Quote(values[i])))
+	}
+	fmt.Fprintf(d.r.Stdout, "declare -%s %s=(%s)\n", flags, name, strings.Join(elems, " "))
+}
+
+// builtinBreak implements both break and continue.
+func builtinBreak(ctx context.Context, r *Runner, args []string) int {
+	n := 1
+	if len(args) > 1 {
+		var err error
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+			r.errorf("%s: %s: loop count out of range", args[0], args[1])
+			return 1
+		}
+	}
+	if r.loopDepth == 0 {
+		r.errorf("%s: only meaningful in a loop", args[0])
+		return 0
+	}
+	n = min(n, r.loopDepth)
+	if args[0] == "break" {
+		r.breakN = n
+	} else {
+		r.contN = n
+	}
+	return 0
+}
+
+// cutIndex splits an array element reference such as name[index].
+func cutIndex(s string) (name, index string, ok bool) {
+	if i := strings.IndexByte(s, '['); i > 0 && strings.HasSuffix(s, "]") {
+		return s[:i], s[i+1 : len(s)-1], true
+	}
+	return s, "", false
+}
+
+// quote quotes s for the shell if it has any special characters.
+func quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_-+=./,:@%", c)) {
+			return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+		}
+	}
+	return s
+}
+
+func isName(s string) bool {
+	for i, c := range s {
+		if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return s != ""
+}
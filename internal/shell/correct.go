@@ -0,0 +1,242 @@
+package shell
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+	"github.com/lithammer/fuzzysearch/fuzzy"
+)
+
+// maxFixes is the most fixes suggested for a word.
+const maxFixes = 3
+
+// Correction is a fix suggested for a word of the input last run, when the
+// command or directory it names wasn't found.
+type Correction struct {
+	// Pos and End are the rune offsets of the word in the input
+	Pos, End int
+
+	// Fixes are what the word could be replaced with, closest first, quoted
+	// if need be
+	Fixes []string
+}
+
+// corrections collects the corrections suggested while running an input,
+// including in the subshells it starts.
+type corrections struct {
+	mu   sync.Mutex
+	list []Correction
+}
+
+// Corrections returns the corrections suggested while running the last
+// input.
+func (r *Runner) Corrections() []Correction {
+	if r.fixes == nil {
+		return nil
+	}
+	r.fixes.mu.Lock()
+	defer r.fixes.mu.Unlock()
+	return append([]Correction(nil), r.fixes.list...)
+}
+
+// correct suggests fixes for argument i of the command being run. Only
+// arguments written as plain words can be corrected, as the fix replaces
+// the word in the input.
+func (r *Runner) correct(i int, fixes []string) {
+	if r.fixes == nil || r.inTrap || len(fixes) == 0 || i >= len(r.words) {
+		return
+	}
+	word := r.words[i]
+	if len(word.Parts) != 1 {
+		return
+	}
+	if lit, ok := word.Parts[0].(*syntax.Lit); !ok || lit.Quoted {
+		return
+	}
+
+	c := Correction{Pos: word.Pos, End: word.End}
+	for _, fix := range fixes {
+		c.Fixes = append(c.Fixes, quote(fix))
+	}
+	r.fixes.mu.Lock()
+	defer r.fixes.mu.Unlock()
+	r.fixes.list = append(r.fixes.list, c)
+}
+
+// closest returns the names closest to word, by edit distance, or that it
+// fuzzy matches, the closest first. Among names as close, those with the
+// same letters as word come first, as the typo is likely a swap.
+func closest(word string, names []string) []string {
+	type candidate struct {
+		name    string
+		dist    int
+		anagram bool
+	}
+	limit := max(2, len(word)/3)
+	lower := strings.ToLower(word)
+	letters := sortedRunes(lower)
+
+	var candidates []candidate
+	for _, name := range names {
+		if name == word {
+			continue
+		}
+		dist := editDistance(lower, strings.ToLower(name))
+		if dist > limit {
+			// Abbreviations are further away, but still worth suggesting
+			if !fuzzy.MatchFold(word, name) {
+				continue
+			}
+			dist = limit + 1 + len(name) - len(word)
+		}
+		candidates = append(candidates, candidate{name, dist, sortedRunes(strings.ToLower(name)) == letters})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		switch {
+		case a.dist != b.dist:
+			return a.dist < b.dist
+		case a.anagram != b.anagram:
+			return a.anagram
+		}
+		return a.name < b.name
+	})
+
+	var closest []string
+	for _, c := range candidates[:min(len(candidates), maxFixes)] {
+		closest = append(closest, c.name)
+	}
+	return closest
+}
+
+// editDistance returns the number of insertions, deletions, substitutions
+// and swaps of adjacent characters that turn a into b.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// d[i][j] is the distance between s[:i] and t[:j]
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func sortedRunes(s string) string {
+	runes := []rune(s)
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return string(runes)
+}
+
+// commandNames returns the names a command that wasn't found is corrected
+// to: the builtins and the commands in PATH, from Commands if they're known.
+// The shell has no aliases or functions to suggest.
+func (r *Runner) commandNames() []string {
+	if r.Commands != nil {
+		if names := r.Commands(); names != nil {
+			return names
+		}
+	}
+	names := Builtins()
+	seen := make(map[string]bool)
+	path, _ := r.getVar("PATH")
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		entries, err := os.ReadDir(r.absPath(dir))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !seen[name] && isExecutable(filepath.Join(r.absPath(dir), name)) == nil {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// notFoundHandler runs the command named by SUSHI_COMMAND_NOT_FOUND, if set,
+// for a command that wasn't found, with the command and its arguments. It
+// reports whether it ran.
+func (r *Runner) notFoundHandler(ctx context.Context, args, env []string) bool {
+	handler, _ := r.getVar("SUSHI_COMMAND_NOT_FOUND")
+	if handler == "" || r.inHandler {
+		return false
+	}
+	if _, err := r.lookPath(handler); err != nil {
+		return false
+	}
+	r.inHandler = true
+	defer func() { r.inHandler = false }()
+	r.exec(ctx, append([]string{handler}, args...), env)
+	return true
+}
+
+// dirFixes suggests directories for one that doesn't exist, replacing the
+// first element of the path that's missing with the names closest to it
+// of the directories beside it.
+func (r *Runner) dirFixes(dir string) []string {
+	elems := strings.Split(dir, "/")
+	for i, elem := range elems {
+		if elem == "" || elem == "." || elem == ".." {
+			continue
+		}
+		if _, err := r.resolveDir(strings.Join(elems[:i+1], "/"), false); err == nil {
+			continue
+		}
+
+		parent := strings.Join(elems[:i], "/")
+		switch {
+		case i == 0:
+			parent = "."
+		case parent == "":
+			parent = "/"
+		}
+		entries, err := os.ReadDir(r.absPath(parent))
+		if err != nil {
+			return nil
+		}
+		var names []string
+		for _, entry := range entries {
+			if info, err := os.Stat(filepath.Join(r.absPath(parent), entry.Name())); err == nil && info.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+
+		var fixes []string
+		for _, name := range closest(elem, names) {
+			fixed := append([]string(nil), elems...)
+			fixed[i] = name
+			path := strings.Join(fixed, "/")
+			if _, err := r.resolveDir(path, false); err == nil {
+				fixes = append(fixes, path)
+			}
+		}
+		return fixes
+	}
+	return nil
+}
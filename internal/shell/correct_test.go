@@ -0,0 +1,148 @@
+package shell
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+func TestCdCorrections(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []Correction
+	}{
+		{`cd rael`, []Correction{{Pos: 3, End: 7, Fixes: []string{"real"}}}},
+		{`cd real/sbu`, []Correction{{Pos: 3, End: 11, Fixes: []string{"real/sub"}}}},
+		{`cd ./rel/sub`, []Correction{{Pos: 3, End: 12, Fixes: []string{"./real/sub"}}}},
+		{`mkdir ab; cd xb`, []Correction{{Pos: 13, End: 15, Fixes: []string{"ab", "b", "a"}}}},
+		// Only words typed plainly are replaced
+		{`cd 'rael'`, nil},
+		{`x=rael; cd $x`, nil},
+		{`cd real`, nil},
+		{`cd zzzzzz`, nil},
+	}
+	for _, tt := range tests {
+		_, r := run(t, dirTree(t), tt.src)
+		if got := r.Corrections(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Run(%q) corrections = %+v, want %+v", tt.src, got, tt.want)
+		}
+	}
+}
+
+// binDir returns a directory holding the executables named, and a file
+// that isn't executable.
+func binDir(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\necho "+name+" \"$@\"\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "gert"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestClosest(t *testing.T) {
+	names := []string{"grep", "git", "gitk", "make", "mkdir", "docker-compose", "cd", "pwd"}
+	tests := []struct {
+		word string
+		want []string
+	}{
+		// Swapped letters come before other fixes as close
+		{"gerp", []string{"grep"}},
+		{"gti", []string{"git", "gitk"}},
+		{"mkae", []string{"make"}},
+		{"mkdri", []string{"mkdir"}},
+		// Abbreviations are suggested after closer names
+		{"dcomp", []string{"docker-compose"}},
+		{"git", []string{"gitk"}},
+		{"xyzzy", nil},
+	}
+	for _, tt := range tests {
+		if got := closest(tt.word, names); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("closest(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestCommandCorrections(t *testing.T) {
+	bin := binDir(t, "grep", "git", "make")
+	tests := []struct {
+		src  string
+		want []Correction
+	}{
+		{`gerp x`, []Correction{{Pos: 0, End: 4, Fixes: []string{"grep"}}}},
+		{`echo a | gti`, []Correction{{Pos: 9, End: 12, Fixes: []string{"git"}}}},
+		// Builtins too, but only files that can be run
+		{`pwdd`, []Correction{{Pos: 0, End: 4, Fixes: []string{"pwd", "popd"}}}},
+		{`gerx`, []Correction{{Pos: 0, End: 4, Fixes: []string{"grep"}}}},
+		{`'gerp'`, nil},
+		{`grep -q x /dev/null`, nil},
+	}
+	for _, tt := range tests {
+		f, err := syntax.Parse(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stdout, stderr buffer
+		r := New(t.TempDir())
+		r.Stdout, r.Stderr = &stdout, &stderr
+		r.setVar("PATH", bin)
+		r.Run(context.Background(), f)
+		if got := r.Corrections(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Run(%q) corrections = %+v, want %+v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCommandCorrectionsKnown(t *testing.T) {
+	f, err := syntax.Parse(`gerp`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderr buffer
+	r := New(t.TempDir())
+	r.Stderr = &stderr
+	r.setVar("PATH", binDir(t, "grep"))
+	// The commands known already are suggested, without reading PATH
+	r.Commands = func() []string { return []string{"gerpx"} }
+	r.Run(context.Background(), f)
+	want := []Correction{{Pos: 0, End: 4, Fixes: []string{"gerpx"}}}
+	if got := r.Corrections(); !reflect.DeepEqual(got, want) {
+		t.Errorf("corrections = %+v, want %+v", got, want)
+	}
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	bin := binDir(t, "handler")
+	tests := []struct {
+		src    string
+		want   string
+		status int
+	}{
+		{`SUSHI_COMMAND_NOT_FOUND=handler; gerp a b`, "handler gerp a b\n", 0},
+		{`SUSHI_COMMAND_NOT_FOUND=missing; gerp`, "", 127},
+		{`gerp`, "", 127},
+	}
+	for _, tt := range tests {
+		f, err := syntax.Parse(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stdout, stderr buffer
+		r := New(t.TempDir())
+		r.Stdout, r.Stderr = &stdout, &stderr
+		r.setVar("PATH", bin)
+		r.Run(context.Background(), f)
+		if got := stdout.String(); got != tt.want || r.Status() != tt.status {
+			t.Errorf("Run(%q) = %q, status %d; want %q, status %d", tt.src, got, r.Status(), tt.want, tt.status)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func builtinCd(ctx context.Context, r *Runner, args []string) int {
+	last := len(args) - 1
+	physical, args, ok := r.dirFlags("cd", args[1:])
+	if !ok {
+		return 2
+	}
+
+	var dir string
+	print := false
+	switch {
+	case len(args) > 1:
+		r.errorf("cd: too many arguments")
+		return 1
+	case len(args) == 0:
+		home, _ := r.getVar("HOME")
+		if home == "" {
+			r.errorf("cd: HOME not set")
+			return 1
+		}
+		dir = home
+	case args[0] == "-":
+		oldpwd, _ := r.getVar("OLDPWD")
+		if oldpwd == "" {
+			r.errorf("cd: OLDPWD not set")
+			return 1
+		}
+		dir, print = oldpwd, true
+	default:
+		dir = args[0]
+	}
+
+	path, found, err := r.findDir(dir, physical)
+	if err != nil {
+		r.errorf("cd: %s: %v", dir, err)
+		if len(args) == 1 && args[0] != "-" && errors.Is(err, fs.ErrNotExist) {
+			r.correct(last, r.dirFixes(dir))
+		}
+		return 1
+	}
+	r.setDir(path)
+	if print || found {
+		fmt.Fprintln(r.Stdout, path)
+	}
+	return 0
+}
+
+// autoCd changes to the directory named by a command that wasn't found, if
+// autocd is set in an interactive shell. It reports whether it did.
+func (r *Runner) autoCd(ctx context.Context, args []string) bool {
+	if len(args) != 1 || !r.Interactive || !r.opts["autocd"] {
+		return false
+	}
+	if _, err := r.resolveDir(args[0], false); err != nil {
+		return false
+	}
+	r.status = builtinCd(ctx, r, []string{"cd", "--", args[0]})
+	return true
+}
+
+func builtinPwd(ctx context.Context, r *Runner, args []string) int {
+	physical, args, ok := r.dirFlags("pwd", args[1:])
+	if !ok {
+		return 2
+	}
+	dir := r.Dir
+	if physical {
+		path, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			r.errorf("pwd: %v", errors.Unwrap(err))
+			return 1
+		}
+		dir = path
+	}
+	fmt.Fprintln(r.Stdout, dir)
+	return 0
+}
+
+// dirFlags parses the -L and -P options of cd, pushd and pwd, returning whether
+// symbolic links should be resolved and the arguments after the options.
+func (r *Runner) dirFlags(name string, args []string) (bool, []string, bool) {
+	physical := false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' && !isStackIndex(args[0]) {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 'L':
+				physical = false
+			case 'P':
+				physical = true
+			default:
+				r.errorf("%s: -%c: invalid option", name, c)
+				return false, nil, false
+			}
+		}
+	}
+	return physical, args, true
+}
+
+// findDir returns the directory a cd to dir goes to, and whether it was
+// found through CDPATH. Relative directories are looked up in the entries
+// of CDPATH first, unless they start with . or ..
+//
+// The path is logical, with .. removing the last element, unless physical
+// is set and it has symbolic links resolved.
+func (r *Runner) findDir(dir string, physical bool) (string, bool, error) {
+	first, _, _ := strings.Cut(dir, "/")
+	if cdpath, _ := r.getVar("CDPATH"); cdpath != "" && !filepath.IsAbs(dir) && first != "." && first != ".." {
+		for _, entry := range filepath.SplitList(cdpath) {
+			if path, err := r.resolveDir(filepath.Join(entry, dir), physical); err == nil {
+				// Only a directory found through another entry than the
+				// current directory is shown
+				return path, entry != "" && entry != ".", nil
+			}
+		}
+	}
+	path, err := r.resolveDir(dir, physical)
+	return path, false, err
+}
+
+// resolveDir returns the absolute path of a directory, checking it exists.
+func (r *Runner) resolveDir(dir string, physical bool) (string, error) {
+	path := r.absPath(dir)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Unwrap(err)
+	}
+	if !info.IsDir() {
+		return "", errors.New("not a directory")
+	}
+	if physical {
+		// Links are resolved before .. so it goes to the parent of the target
+		if !filepath.IsAbs(dir) {
+			dir = r.Dir + string(filepath.Separator) + dir
+		}
+		return filepath.EvalSymlinks(dir)
+	}
+	return path, nil
+}
+
+// setDir changes the working directory, keeping PWD and OLDPWD up to date
+// and recording the visit for z.
+func (r *Runner) setDir(dir string) {
+	r.setVar("OLDPWD", r.Dir)
+	r.Dir = dir
+	r.setVar("PWD", dir)
+	if r.Dirs != nil {
+		r.Dirs.Add(dir, time.Now())
+	}
+}
+
+// isStackIndex reports whether arg is a +N or -N index into the directory
+// stack.
+func isStackIndex(arg string) bool {
+	if len(arg) < 2 || arg[0] != '+' && arg[0] != '-' {
+		return false
+	}
+	_, err := strconv.Atoi(arg[1:])
+	return err == nil
+}
+
+// stackIndex returns the position in the directory stack, as listed by
+// dirs, of an index counting from the left with +N or the right with -N.
+func (r *Runner) stackIndex(name, arg string) (int, bool) {
+	n, _ := strconv.Atoi(arg[1:])
+	size := len(r.dirStack) + 1
+	if arg[0] == '-' {
+		n = size - 1 - n
+	}
+	if n < 0 || n >= size {
+		r.errorf("%s: %s: directory stack index out of range", name, arg)
+		return 0, false
+	}
+	return n, true
+}
+
+// dirs returns the directory stack with the working directory first.
+func (r *Runner) dirs() []string {
+	return append([]string{r.Dir}, r.dirStack...)
+}
+
+// setDirs changes to the first directory of a stack listed like dirs, and
+// keeps the rest.
+func (r *Runner) setDirs(dirs []string) {
+	if dirs[0] != r.Dir {
+		r.setDir(dirs[0])
+	}
+	r.dirStack = dirs[1:]
+}
+
+func builtinPushd(ctx context.Context, r *Runner, args []string) int {
+	physical, args, ok := r.dirFlags("pushd", args[1:])
+	if !ok {
+		return 2
+	}
+
+	dirs := r.dirs()
+	switch {
+	case len(args) > 1:
+		r.errorf("pushd: too many arguments")
+		return 1
+	case len(args) == 0:
+		// Swap the top two directories
+		if len(dirs) < 2 {
+			r.errorf("pushd: no other directory")
+			return 1
+		}
+		if _, err := r.resolveDir(dirs[1], false); err != nil {
+			r.errorf("pushd: %s: %v", dirs[1], err)
+			return 1
+		}
+		dirs[0], dirs[1] = dirs[1], dirs[0]
+		r.setDirs(dirs)
+	case isStackIndex(args[0]):
+		// Rotate the stack to bring an entry to the top
+		n, ok := r.stackIndex("pushd", args[0])
+		if !ok {
+			return 1
+		}
+		r.setDirs(append(dirs[n:], dirs[:n]...))
+	default:
+		path, _, err := r.findDir(args[0], physical)
+		if err != nil {
+			r.errorf("pushd: %s: %v", args[0], err)
+			return 1
+		}
+		r.setDirs(append([]string{path}, dirs...))
+	}
+	r.printDirs(false, false, false)
+	return 0
+}
+
+func builtinPopd(ctx context.Context, r *Runner, args []string) int {
+	args = args[1:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(r.dirStack) == 0 {
+		r.errorf("popd: directory stack empty")
+		return 1
+	}
+
+	n := 0
+	switch {
+	case len(args) > 1:
+		r.errorf("popd: too many arguments")
+		return 1
+	case len(args) == 1 && isStackIndex(args[0]):
+		var ok bool
+		if n, ok = r.stackIndex("popd", args[0]); !ok {
+			return 1
+		}
+	case len(args) == 1:
+		r.errorf("popd: %s: invalid argument", args[0])
+		return 2
+	}
+
+	dirs := r.dirs()
+	if n == 0 {
+		if _, err := r.resolveDir(dirs[1], false); err != nil {
+			r.errorf("popd: %s: %v", dirs[1], err)
+			return 1
+		}
+	}
+	r.setDirs(append(dirs[:n], dirs[n+1:]...))
+	r.printDirs(false, false, false)
+	return 0
+}
+
+func builtinDirs(ctx context.Context, r *Runner, args []string) int {
+	long, lines, numbered, clear := false, false, false, false
+	for _, arg := range args[1:] {
+		if isStackIndex(arg) {
+			n, ok := r.stackIndex("dirs", arg)
+			if !ok {
+				return 1
+			}
+			fmt.Fprintln(r.Stdout, r.showDir(r.dirs()[n], long))
+			return 0
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			r.errorf("dirs: %s: invalid argument", arg)
+			return 2
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 'c':
+				clear = true
+			case 'l':
+				long = true
+			case 'p':
+				lines = true
+			case 'v':
+				lines, numbered = true, true
+			default:
+				r.errorf("dirs: -%c: invalid option", c)
+				return 2
+			}
+		}
+	}
+	if clear {
+		// Clearing the stack prints nothing
+		r.dirStack = nil
+		return 0
+	}
+	r.printDirs(long, lines, numbered)
+	return 0
+}
+
+// printDirs prints the directory stack on one line, or one directory per
+// line, optionally with its index. Unless long, the home directory is
+// shown as ~.
+func (r *Runner) printDirs(long, lines, numbered bool) {
+	dirs := r.dirs()
+	for i, dir := range dirs {
+		dir = r.showDir(dir, long)
+		switch {
+		case numbered:
+			fmt.Fprintf(r.Stdout, "%2d  %s\n", i, dir)
+		case lines:
+			fmt.Fprintln(r.Stdout, dir)
+		case i < len(dirs)-1:
+			fmt.Fprint(r.Stdout, dir, " ")
+		default:
+			fmt.Fprintln(r.Stdout, dir)
+		}
+	}
+}
+
+func (r *Runner) showDir(dir string, long bool) string {
+	home, _ := r.getVar("HOME")
+	if long || home == "" || home == "/" {
+		return dir
+	}
+	if dir == home {
+		return "~"
+	}
+	if rest, ok := strings.CutPrefix(dir, home+"/"); ok {
+		return "~/" + rest
+	}
+	return dir
+}
@@ -0,0 +1,135 @@
+package shell
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// dirTree returns a directory holding a, b, real/sub and link, a symbolic
+// link to real, with any links in its own path resolved.
+func dirTree(t *testing.T) string {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "real/sub"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("real", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCdDirs(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		// cd - goes back to OLDPWD, and prints it
+		{`cd a; cd ../b; echo $OLDPWD; cd -; pwd`, "D/a\nD/a\nD/a\n"},
+		{`cd a; cd -; echo $OLDPWD`, "D\nD/a\n"},
+		{`unset OLDPWD; cd -; echo $?`, "1\n"},
+		{`HOME=$PWD/b; cd; pwd`, "D/b\n"},
+		{`cd missing; echo $?; pwd`, "1\nD\n"},
+		{`cd a b; echo $?`, "1\n"},
+		// Directories found through CDPATH are printed, unless through the
+		// current directory, and ./ and ../ skip it
+		{`CDPATH=$PWD/real; cd sub; pwd`, "D/real/sub\nD/real/sub\n"},
+		{`CDPATH=:$PWD/real; cd a; pwd`, "D/a\n"},
+		{`CDPATH=$PWD/real:; cd a; pwd`, "D/a\n"},
+		{`CDPATH=$PWD/real; cd ./sub; echo $?`, "1\n"},
+		{`mkdir real/a; CDPATH=$PWD/real; cd a; pwd`, "D/real/a\nD/real/a\n"},
+		// Paths are logical unless -P, with .. removing the last element
+		{`cd link/sub; pwd; pwd -P; echo $PWD`, "D/link/sub\nD/real/sub\nD/link/sub\n"},
+		{`cd link/sub; cd ..; pwd`, "D/link\n"},
+		{`cd link/sub/..; pwd`, "D/link\n"},
+		{`cd -P link/sub; pwd`, "D/real/sub\n"},
+		{`cd -P link/sub/..; pwd`, "D/real\n"},
+		{`cd -P -L link; pwd`, "D/link\n"},
+		{`cd -x a; echo $?`, "2\n"},
+	}
+	for _, tt := range tests {
+		dir := dirTree(t)
+		got, _ := run(t, dir, tt.src)
+		if got = strings.ReplaceAll(got, dir, "D"); got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestDirStack(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`pushd a; pushd ../b; pwd`, "D/a D\nD/b D/a D\nD/b\n"},
+		{`pushd a >/dev/null; pushd ../b >/dev/null; dirs -v`, " 0  D/b\n 1  D/a\n 2  D\n"},
+		{`pushd a >/dev/null; dirs -p`, "D/a\nD\n"},
+		{`pushd a >/dev/null; popd; pwd; popd; echo $?`, "D\nD\n1\n"},
+		// With no directory pushd swaps the top two, and +N rotates the
+		// stack to bring one to the top
+		{`pushd a >/dev/null; pushd; pwd`, "D D/a\nD\n"},
+		{`pushd a >/dev/null; pushd ../b >/dev/null; pushd +2; pwd`, "D D/b D/a\nD\n"},
+		{`pushd a >/dev/null; pushd ../b >/dev/null; pushd -0; pwd`, "D D/b D/a\nD\n"},
+		{`pushd a >/dev/null; pushd ../b >/dev/null; popd +1; pwd`, "D/b D\nD/b\n"},
+		{`pushd a >/dev/null; pushd ../b >/dev/null; dirs +1; dirs -1`, "D/a\nD/a\n"},
+		{`pushd a >/dev/null; pushd +3; echo $?`, "1\n"},
+		{`pushd a >/dev/null; dirs -c; dirs; popd; echo $?`, "D/a\n1\n"},
+		{`pushd; echo $?`, "1\n"},
+		// The home directory is shown as ~, unless -l
+		{`HOME=$PWD; pushd a >/dev/null; dirs; dirs -l`, "~/a ~\nD/a D\n"},
+	}
+	for _, tt := range tests {
+		dir := dirTree(t)
+		got, _ := run(t, dir, tt.src)
+		if got = strings.ReplaceAll(got, dir, "D"); got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestAutoCd(t *testing.T) {
+	tests := []struct {
+		src         string
+		interactive bool
+		want        string
+	}{
+		// On by default
+		{`real/sub`, true, "D/real/sub"},
+		{`./link`, true, "D/link"},
+		{`real/sub/..`, true, "D/real"},
+		// Only a directory alone, with autocd set, in an interactive shell
+		{`shopt -u autocd; real/sub`, true, "D"},
+		{`real/sub`, false, "D"},
+		{`real/sub x`, true, "D"},
+		{`missing`, true, "D"},
+	}
+	for _, tt := range tests {
+		dir := dirTree(t)
+		f, err := syntax.Parse(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stdout, stderr buffer
+		r := New(dir)
+		r.Interactive = tt.interactive
+		r.Stdout, r.Stderr = &stdout, &stderr
+		r.Run(context.Background(), f)
+
+		if want := strings.Replace(tt.want, "D", dir, 1); r.Dir != want {
+			t.Errorf("Run(%q) went to %q, want %q", tt.src, r.Dir, want)
+		}
+		if r.Dir == dir && r.Status() != 127 {
+			t.Errorf("Run(%q) status %d, want 127 for a command not found", tt.src, r.Status())
+		}
+	}
+}
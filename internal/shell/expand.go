@@ -0,0 +1,456 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// segment is a piece of an expanded word.
+type segment struct {
+	text string
+
+	// quoted text isn't subject to globbing
+	quoted bool
+
+	// split is set for the result of an unquoted expansion, which is subject
+	// to field splitting
+	split bool
+}
+
+// expansion accumulates the fields that a word expands to. A word normally
+// expands to one field, but "$@" can produce several.
+type expansion struct {
+	fields [][]segment
+}
+
+func (x *expansion) add(seg segment) {
+	if len(x.fields) == 0 {
+		x.fields = append(x.fields, nil)
+	}
+	last := len(x.fields) - 1
+	x.fields[last] = append(x.fields[last], seg)
+}
+
+// breakField starts a new field.
+func (x *expansion) breakField() {
+	x.fields = append(x.fields, nil)
+}
+
+// fields expands words into a list of arguments, performing brace
+// expansion, field splitting and globbing.
+func (r *Runner) fields(ctx context.Context, words ...*syntax.Word) ([]string, error) {
+	var args []string
+	for _, word := range words {
+		for _, parts := range braces(word.Parts) {
+			x, err := r.expand(ctx, parts)
+			if err != nil {
+				return nil, err
+			}
+			for _, field := range x.fields {
+				for _, split := range r.split(field) {
+					matches, err := r.globField(split)
+					if err != nil {
+						return nil, err
+					}
+					args = append(args, matches...)
+				}
+			}
+		}
+	}
+	return args, nil
+}
+
+// literal expands a word to a single string without field splitting or
+// globbing.
+func (r *Runner) literal(ctx context.Context, word *syntax.Word) (string, error) {
+	x, err := r.expand(ctx, word.Parts)
+	if err != nil {
+		return "", err
+	}
+	var fields []string
+	for _, field := range x.fields {
+		fields = append(fields, join(field))
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// assignValue expands the value of an assignment.
+func (r *Runner) assignValue(ctx context.Context, word *syntax.Word) (string, error) {
+	return r.literal(ctx, word)
+}
+
+// pattern expands a word into a pattern for matching, with quoted
+// characters escaped.
+func (r *Runner) pattern(ctx context.Context, word *syntax.Word) (string, error) {
+	x, err := r.expand(ctx, word.Parts)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, field := range x.fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		for _, seg := range field {
+			if seg.quoted {
+				b.WriteString(escapePattern(seg.text))
+			} else {
+				b.WriteString(seg.text)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+func join(field []segment) string {
+	var b strings.Builder
+	for _, seg := range field {
+		b.WriteString(seg.text)
+	}
+	return b.String()
+}
+
+// expand performs tilde, parameter, arithmetic and command expansion on word
+// parts.
+func (r *Runner) expand(ctx context.Context, parts []syntax.WordPart) (*expansion, error) {
+	x := &expansion{}
+	if len(parts) > 0 {
+		if lit, ok := parts[0].(*syntax.Lit); ok && !lit.Quoted {
+			if home, rest, ok := r.tilde(lit.Value); ok {
+				x.add(segment{text: home, quoted: true})
+				if rest != "" {
+					x.add(segment{text: rest})
+				}
+				parts = parts[1:]
+			}
+		}
+	}
+	if err := r.expandParts(ctx, x, parts, false); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// tilde expands the ~ or ~user prefix of a literal, returning the home
+// directory and the rest of the literal.
+func (r *Runner) tilde(value string) (string, string, bool) {
+	if !strings.HasPrefix(value, "~") {
+		return "", "", false
+	}
+	name, rest := value, ""
+	if i := strings.IndexByte(value, '/'); i >= 0 {
+		name, rest = value[:i], value[i:]
+	}
+
+	if name == "~" {
+		home, _ := r.getVar("HOME")
+		return home, rest, true
+	}
+	if u, err := user.Lookup(name[1:]); err == nil {
+		return u.HomeDir, rest, true
+	}
+	return "", "", false
+}
+
+func (r *Runner) expandParts(ctx context.Context, x *expansion, parts []syntax.WordPart, quoted bool) error {
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			x.add(segment{text: p.Value, quoted: quoted || p.Quoted})
+		case *syntax.SglQuoted:
+			x.add(segment{text: p.Value, quoted: true})
+		case *syntax.DblQuoted:
+			// Make sure "" still produces an empty field, while "$@" produces
+			// none when there are no positional parameters
+			if !hasAtParam(p.Parts) {
+				x.add(segment{quoted: true})
+			}
+			if err := r.expandParts(ctx, x, p.Parts, true); err != nil {
+				return err
+			}
+		case *syntax.ParamExp:
+			if err := r.paramExp(ctx, x, p, quoted); err != nil {
+				return err
+			}
+		case *syntax.CmdSubst:
+			out := r.cmdSubst(ctx, p)
+			x.add(segment{text: out, quoted: quoted, split: !quoted})
+		case *syntax.ProcSubst:
+			path, err := r.procSubst(ctx, p)
+			if err != nil {
+				return err
+			}
+			x.add(segment{text: path, quoted: true})
+		case *syntax.ArithExp:
+			expr := &expansion{}
+			if err := r.expandParts(ctx, expr, p.Parts, true); err != nil {
+				return err
+			}
+			var b strings.Builder
+			for _, field := range expr.fields {
+				b.WriteString(join(field))
+			}
+			n, err := r.arith(b.String())
+			if err != nil {
+				return err
+			}
+			x.add(segment{text: strconv.FormatInt(n, 10), quoted: quoted, split: !quoted})
+		}
+	}
+	return nil
+}
+
+// hasAtParam reports whether parts contain an expansion like $@ or
+// ${name[@]}, which may expand to no fields at all.
+func hasAtParam(parts []syntax.WordPart) bool {
+	for _, part := range parts {
+		p, ok := part.(*syntax.ParamExp)
+		if !ok || p.Length || p.Op != "" && p.Op != ":" && !strings.HasPrefix(p.Op, "/") && !strings.HasPrefix(p.Op, "#") && !strings.HasPrefix(p.Op, "%") {
+			continue
+		}
+		if p.Index == nil && p.Name == "@" {
+			return true
+		}
+		if len(p.Index) == 1 {
+			if lit, ok := p.Index[0].(*syntax.Lit); ok && lit.Value == "@" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cmdSubst runs the commands of a command substitution in a subshell and
+// returns their output.
+func (r *Runner) cmdSubst(ctx context.Context, cs *syntax.CmdSubst) string {
+	var out bytes.Buffer
+	sub := r.subshell()
+	sub.Stdout = &out
+	sub.stmts(ctx, cs.Stmts)
+	r.status = sub.exitTrap(ctx)
+	r.substs++
+	return strings.TrimRight(out.String(), "\n")
+}
+
+// procSubst starts the commands of a process substitution and returns a
+// path under /dev/fd that connects to them. The number is the one the pipe
+// gets in the commands the shell starts, which receive the shell's
+// process substitutions as extra files from fd 3 on.
+func (r *Runner) procSubst(ctx context.Context, ps *syntax.ProcSubst) (string, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+
+	// The pipes of other process substitutions of the command aren't passed
+	// on, which the shell closes when it's done apart from these commands
+	sub := r.subshell()
+	sub.procSubsts = nil
+	mine, theirs := pr, pw
+	var done chan struct{}
+	if ps.Op == "<" {
+		sub.Stdin = nil
+		sub.Stdout = pw
+	} else {
+		mine, theirs = pw, pr
+		sub.Stdin = pr
+		done = make(chan struct{})
+	}
+
+	go func() {
+		sub.stmts(ctx, ps.Stmts)
+		theirs.Close()
+		if done != nil {
+			close(done)
+		}
+	}()
+
+	r.procSubsts = append(r.procSubsts, procSubst{file: mine, done: done})
+	return fmt.Sprintf("/dev/fd/%d", 2+len(r.procSubsts)), nil
+}
+
+// ifs returns the field separators.
+func (r *Runner) ifs() string {
+	if ifs, ok := r.getVar("IFS"); ok {
+		return ifs
+	}
+	return " \t\n"
+}
+
+// split performs field splitting on the results of unquoted expansions.
+func (r *Runner) split(field []segment) [][]segment {
+	ifs := r.ifs()
+
+	var fields [][]segment
+	var cur []segment
+	started := false     // whether cur holds a field, even an empty one
+	wsDelimited := false // whether IFS whitespace ended the last field
+
+	for _, seg := range field {
+		if !seg.split {
+			cur = append(cur, segment{text: seg.text, quoted: seg.quoted})
+			started = true
+			wsDelimited = false
+			continue
+		}
+
+		var text strings.Builder
+		for _, c := range seg.text {
+			if !strings.ContainsRune(ifs, c) {
+				text.WriteRune(c)
+				started = true
+				wsDelimited = false
+				continue
+			}
+
+			if text.Len() > 0 {
+				cur = append(cur, segment{text: text.String(), quoted: seg.quoted})
+				text.Reset()
+			}
+			if strings.ContainsRune(" \t\n", c) {
+				// IFS whitespace only ends a field that has started
+				if started {
+					fields = append(fields, cur)
+					cur, started = nil, false
+					wsDelimited = true
+				}
+			} else {
+				// Other separators always delimit, so two in a row make an
+				// empty field, but they absorb the whitespace before them
+				if started || !wsDelimited {
+					fields = append(fields, cur)
+				}
+				cur, started = nil, false
+				wsDelimited = false
+			}
+		}
+		if text.Len() > 0 {
+			cur = append(cur, segment{text: text.String(), quoted: seg.quoted})
+		}
+	}
+
+	if started {
+		fields = append(fields, cur)
+	}
+	return fields
+}
+
+// globField expands a field as a glob pattern if it contains unquoted
+// pattern characters, returning the matching paths. If there are none, the
+// result is the field itself, nothing with nullglob or an error with
+// failglob.
+func (r *Runner) globField(field []segment) ([]string, error) {
+	var pattern strings.Builder
+	hasPattern := false
+	for _, seg := range field {
+		if seg.quoted {
+			pattern.WriteString(escapePattern(seg.text))
+		} else {
+			pattern.WriteString(seg.text)
+			if hasMeta(seg.text) {
+				hasPattern = true
+			}
+		}
+	}
+
+	if hasPattern && !r.opts["noglob"] {
+		matches := r.glob(pattern.String())
+		switch {
+		case len(matches) > 0:
+			return matches, nil
+		case r.opts["failglob"]:
+			return nil, noMatchError(join(field))
+		case r.opts["nullglob"]:
+			return nil, nil
+		}
+	}
+	return []string{join(field)}, nil
+}
+
+// noMatchError is the error for a pattern without matches with failglob
+// set. Unlike other errors in expansions it doesn't make a shell exit.
+type noMatchError string
+
+func (e noMatchError) Error() string {
+	return "no match: " + string(e)
+}
+
+// glob returns the paths matching pattern, relative to the working directory
+// unless the pattern is absolute. Hidden files only match a pattern component
+// that starts with a literal dot, unless dotglob is set, and nocaseglob makes
+// matching ignore case.
+func (r *Runner) glob(pattern string) []string {
+	components := strings.Split(pattern, "/")
+
+	// Each match is kept as the path to show and the path on disk
+	type path struct{ shown, real string }
+	matches := []path{{shown: "", real: r.Dir}}
+	if components[0] == "" {
+		matches = []path{{shown: "/", real: "/"}}
+		components = components[1:]
+	}
+
+	for i, comp := range components {
+		last := i == len(components)-1
+		if comp == "" {
+			// Repeated or trailing slash
+			if last {
+				for j := range matches {
+					matches[j].shown += "/"
+				}
+			}
+			continue
+		}
+
+		var next []path
+		for _, m := range matches {
+			sep := "/"
+			if m.shown == "" || strings.HasSuffix(m.shown, "/") {
+				sep = ""
+			}
+
+			if !hasMeta(comp) {
+				name := unescapePattern(comp)
+				real := filepath.Join(m.real, name)
+				if last && !exists(real) {
+					continue
+				}
+				next = append(next, path{shown: m.shown + sep + name, real: real})
+				continue
+			}
+
+			names, err := readDirNames(m.real)
+			if err != nil {
+				continue
+			}
+			for _, name := range names {
+				if strings.HasPrefix(name, ".") && !strings.HasPrefix(comp, ".") && !r.opts["dotglob"] {
+					continue
+				}
+				if !matchFold(comp, name, r.opts["nocaseglob"]) {
+					continue
+				}
+				real := filepath.Join(m.real, name)
+				if !last && !isDir(real) {
+					continue
+				}
+				next = append(next, path{shown: m.shown + sep + name, real: real})
+			}
+		}
+		matches = next
+	}
+
+	var result []string
+	for _, m := range matches {
+		result = append(result, m.shown)
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		// Braces expand before the other expansions, one word at a time
+		{`a=1; printf '[%s]' {$a,b}`, "[1][b]"},
+		{`n=3; printf '[%s]' {1..$n}`, "[{1..3}]"},
+		{`a='x,y'; printf '[%s]' {$a}`, "[{x,y}]"},
+		{`printf '[%s]' {a,b}$((1+1))`, "[a2][b2]"},
+
+		// Fields are split on IFS after expanding, unless quoted
+		{`a='1  2'; printf '[%s]' $a "$a"`, "[1][2][1  2]"},
+		{`a=' 1 '; printf '[%s]' x$a"y"`, "[x][1][y]"},
+		{`IFS=:; a=1:2::3; printf '[%s]' $a`, "[1][2][][3]"},
+		{`IFS=; a='1 2'; printf '[%s]' $a`, "[1 2]"},
+		{`printf '[%s]' $(echo 1 2) "$(echo 1 2)"`, "[1][2][1 2]"},
+		{`printf '[%s]' $((2*3))$((1))`, "[61]"},
+
+		// Empty unquoted expansions are removed, quoted ones kept
+		{`a=; printf '[%s]' $a "$a" x`, "[][x]"},
+		{`printf '[%s]' $unset ''`, "[]"},
+
+		// Positional parameters
+		{`set -- a 'b c'; printf '[%s]' "$@"`, "[a][b c]"},
+		{`set -- a 'b c'; printf '[%s]' $@`, "[a][b][c]"},
+		{`set -- a 'b c'; printf '[%s]' "$*"`, "[a b c]"},
+		{`set -- a 'b c'; printf '[%s]' "x$@y"`, "[xa][b cy]"},
+		{`set --; printf '[%s]' "$@" x`, "[x]"},
+		{`set -- a b; printf '[%s]' $# $1`, "[2][a]"},
+
+		// Quoting
+		{`printf '[%s]' "a\$b" 'a\$b' a\$b "\"" "a\b"`, `[a$b][a\$b][a$b]["][a\b]`},
+		{`a=b; printf '[%s]' "'$a'" '"$a"'`, `['b']["$a"]`},
+	}
+	for _, tt := range tests {
+		if got, _ := run(t, t.TempDir(), tt.src); got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestTilde(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	os.Mkdir(filepath.Join(dir, "sub"), 0o755)
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`printf '[%s]' ~ ~/sub`, "[" + dir + "][" + dir + "/sub]"},
+		{`printf '[%s]' "~" '~' \~ a~`, "[~][~][~][a~]"},
+		{`a=~/x; printf '[%s]' $a`, "[" + dir + "/x]"},
+		{`printf '[%s]' ~nosuchuser_`, "[~nosuchuser_]"},
+	}
+	for _, tt := range tests {
+		if got, _ := run(t, dir, tt.src); got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// hashEntry is a command remembered in the hash table, with the number of
+// times it was run from there.
+type hashEntry struct {
+	path string
+	hits int
+}
+
+// hashed returns the hash table entry for a command name. The table is
+// emptied when PATH changes.
+func (r *Runner) hashed(name string) (*hashEntry, bool) {
+	path, _ := r.getVar("PATH")
+	if r.hash == nil || path != r.hashPath {
+		r.hash = make(map[string]*hashEntry)
+		r.hashPath = path
+	}
+	e, ok := r.hash[name]
+	return e, ok
+}
+
+func builtinHash(ctx context.Context, r *Runner, args []string) int {
+	r.hashed("") // Forget the table if PATH changed
+
+	var reset, remove, show, long bool
+	var setPath string
+	args = args[1:]
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i := 1; i < len(arg); i++ {
+			switch c := arg[i]; c {
+			case 'r':
+				r.hash = make(map[string]*hashEntry)
+				reset = true
+			case 'd':
+				remove = true
+			case 't':
+				show = true
+			case 'l':
+				long = true
+			case 'p':
+				setPath = arg[i+1:]
+				if setPath == "" {
+					if len(args) == 0 {
+						r.errorf("hash: -p: option requires an argument")
+						return 2
+					}
+					setPath, args = args[0], args[1:]
+				}
+				i = len(arg)
+			default:
+				r.errorf("hash: -%c: invalid option", c)
+				return 2
+			}
+		}
+	}
+
+	if len(args) == 0 {
+		if setPath == "" && !reset && !remove && !show {
+			r.printHash(long)
+		}
+		return 0
+	}
+
+	status := 0
+	for _, name := range args {
+		e, ok := r.hash[name]
+		switch {
+		case setPath != "":
+			r.hash[name] = &hashEntry{path: setPath}
+		case remove:
+			if !ok {
+				r.errorf("hash: %s: not found", name)
+				status = 1
+				continue
+			}
+			delete(r.hash, name)
+		case show:
+			if !ok {
+				r.errorf("hash: %s: not found", name)
+				status = 1
+				continue
+			}
+			if len(args) > 1 {
+				fmt.Fprintf(r.Stdout, "%s\t%s\n", name, e.path)
+			} else {
+				fmt.Fprintln(r.Stdout, e.path)
+			}
+		case IsBuiltin(name):
+			// Builtins aren't looked up in PATH
+		default:
+			paths := r.searchPath(name, false)
+			if len(paths) == 0 {
+				r.errorf("hash: %s: not found", name)
+				status = 1
+				continue
+			}
+			r.hash[name] = &hashEntry{path: paths[0].path}
+		}
+	}
+	return status
+}
+
+// printHash lists the hash table, or the commands that would fill it again
+// if long is set.
+func (r *Runner) printHash(long bool) {
+	if len(r.hash) == 0 {
+		if !long {
+			fmt.Fprintln(r.Stdout, "hash: hash table empty")
+		}
+		return
+	}
+	var names []string
+	for name := range r.hash {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if !long {
+		fmt.Fprintln(r.Stdout, "hits\tcommand")
+	}
+	for _, name := range names {
+		e := r.hash[name]
+		if long {
+			fmt.Fprintf(r.Stdout, "builtin hash -p %s %s\n", quote(e.path), quote(name))
+		} else {
+			fmt.Fprintf(r.Stdout, "%4d\t%s\n", e.hits, e.path)
+		}
+	}
+}
+
+// commandKind is what a command name resolves to.
+type commandKind struct {
+	kind string // "keyword", "builtin", "hashed" or "file"
+	path string
+}
+
+// resolve returns what a command name resolves to, in the order the shell
+// looks: the keywords, the builtins and then the executables in PATH, which
+// are all listed if all is set. The shell has no aliases or functions, so
+// a name is never one. With path set, PATH is searched even for keywords
+// and builtins, and the hash table isn't used.
+func (r *Runner) resolve(name string, all, path bool) []commandKind {
+	var kinds []commandKind
+	if !path {
+		if syntax.IsKeyword(name) {
+			kinds = append(kinds, commandKind{kind: "keyword"})
+		}
+		if IsBuiltin(name) {
+			kinds = append(kinds, commandKind{kind: "builtin"})
+		}
+		if len(kinds) > 0 && !all {
+			return kinds
+		}
+	}
+
+	if strings.ContainsRune(name, '/') {
+		if isExecutable(r.absPath(name)) == nil {
+			kinds = append(kinds, commandKind{kind: "file", path: name})
+		}
+		return kinds
+	}
+	if e, ok := r.hashed(name); ok && !path && !all {
+		return append(kinds, commandKind{kind: "hashed", path: e.path})
+	}
+	for _, m := range r.searchPath(name, all) {
+		kinds = append(kinds, commandKind{kind: "file", path: m.path})
+	}
+	return kinds
+}
+
+// builtinType describes what command names resolve to. The shell has no
+// aliases or functions, so type never reports a name as one: -t never
+// prints "alias" or "function", and -f, which skips functions in bash, is
+// accepted but changes nothing.
+func builtinType(ctx context.Context, r *Runner, args []string) int {
+	var all, kindOnly, pathOnly, forcePath bool
+	args = args[1:]
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 'a':
+				all = true
+			case 't':
+				kindOnly = true
+			case 'p':
+				pathOnly = true
+			case 'P':
+				pathOnly, forcePath = true, true
+			case 'f':
+				// There are no functions to skip
+			default:
+				r.errorf("type: -%c: invalid option", c)
+				return 2
+			}
+		}
+	}
+
+	status := 0
+	for _, name := range args {
+		kinds := r.resolve(name, all, forcePath)
+		if len(kinds) == 0 {
+			if !kindOnly && !pathOnly {
+				r.errorf("type: %s: not found", name)
+			}
+			status = 1
+			continue
+		}
+		for _, k := range kinds {
+			switch {
+			case kindOnly && k.kind == "hashed":
+				fmt.Fprintln(r.Stdout, "file")
+			case kindOnly:
+				fmt.Fprintln(r.Stdout, k.kind)
+			case pathOnly:
+				if k.path != "" {
+					fmt.Fprintln(r.Stdout, k.path)
+				}
+			case k.kind == "keyword":
+				fmt.Fprintf(r.Stdout, "%s is a shell keyword\n", name)
+			case k.kind == "builtin":
+				fmt.Fprintf(r.Stdout, "%s is a shell builtin\n", name)
+			case k.kind == "hashed":
+				fmt.Fprintf(r.Stdout, "%s is hashed (%s)\n", name, k.path)
+			default:
+				fmt.Fprintf(r.Stdout, "%s is %s\n", name, k.path)
+			}
+		}
+	}
+	return status
+}
+
+func builtinWhich(ctx context.Context, r *Runner, args []string) int {
+	all := false
+	args = args[1:]
+	if len(args) > 0 && args[0] == "-a" {
+		all, args = true, args[1:]
+	}
+
+	status := 0
+	for _, name := range args {
+		kinds := r.resolve(name, all, false)
+		if len(kinds) == 0 {
+			status = 1
+			continue
+		}
+		for _, k := range kinds {
+			switch k.kind {
+			case "keyword":
+				fmt.Fprintf(r.Stdout, "%s: shell keyword\n", name)
+			case "builtin":
+				fmt.Fprintf(r.Stdout, "%s: shell builtin\n", name)
+			default:
+				fmt.Fprintln(r.Stdout, k.path)
+			}
+		}
+	}
+	return status
+}
+
+func builtinCommand(ctx context.Context, r *Runner, args []string) int {
+	describe, verbose := false, false
+	args = args[1:]
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 'v':
+				describe = true
+			case 'V':
+				verbose = true
+			case 'p':
+				// PATH is always searched as it is
+			default:
+				r.errorf("command: -%c: invalid option", c)
+				return 2
+			}
+		}
+	}
+	if len(args) == 0 {
+		return 0
+	}
+
+	switch {
+	case verbose:
+		return builtinType(ctx, r, append([]string{"type"}, args...))
+	case describe:
+		status := 0
+		for _, name := range args {
+			kinds := r.resolve(name, false, false)
+			switch {
+			case len(kinds) == 0:
+				status = 1
+			case kinds[0].path != "":
+				fmt.Fprintln(r.Stdout, kinds[0].path)
+			default:
+				fmt.Fprintln(r.Stdout, name)
+			}
+		}
+		return status
+	}
+
+	r.simple(ctx, args, nil)
+	return r.status
+}
+
+func builtinBuiltin(ctx context.Context, r *Runner, args []string) int {
+	if len(args) < 2 {
+		return 0
+	}
+	fn, ok := builtins[args[1]]
+	if !ok {
+		r.errorf("builtin: %s: not a shell builtin", args[1])
+		return 1
+	}
+	return fn(ctx, r, args[1:])
+}
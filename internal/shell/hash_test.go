@@ -0,0 +1,93 @@
+package shell
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+func TestTypeCommand(t *testing.T) {
+	bin1, bin2 := binDir(t, "sushitool", "z"), binDir(t, "sushitool")
+	tests := []struct {
+		src    string
+		want   string
+		status int
+	}{
+		{`type cd if sushitool`, "cd is a shell builtin\nif is a shell keyword\nsushitool is B1/sushitool\n", 0},
+		{`type -a sushitool`, "sushitool is B1/sushitool\nsushitool is B2/sushitool\n", 0},
+		{`type -a z`, "z is a shell builtin\nz is B1/z\n", 0},
+		{`type -t cd if sushitool`, "builtin\nkeyword\nfile\n", 0},
+		{`type -f -t cd`, "builtin\n", 0},
+		{`type -p sushitool cd`, "B1/sushitool\n", 0},
+		{`type -P z`, "B1/z\n", 0},
+		{`type -ap sushitool`, "B1/sushitool\nB2/sushitool\n", 0},
+		{`type missing`, "", 1},
+		{`type -t missing`, "", 1},
+		{`type -x cd`, "", 2},
+		{`command -v sushitool cd if`, "B1/sushitool\ncd\nif\n", 0},
+		{`command -v missing`, "", 1},
+		{`command -V cd`, "cd is a shell builtin\n", 0},
+		{`command sushitool a`, "sushitool a\n", 0},
+		{`command cd B2; pwd`, "B2\n", 0},
+		{`builtin cd B1; builtin pwd`, "B1\n", 0},
+		{`builtin sushitool`, "", 1},
+		{`which -a sushitool cd`, "B1/sushitool\nB2/sushitool\ncd: shell builtin\n", 0},
+	}
+	for _, tt := range tests {
+		src := strings.NewReplacer("B1", bin1, "B2", bin2).Replace(tt.src)
+		got, status := runPath(t, src, bin1+":"+bin2)
+		got = strings.NewReplacer(bin1, "B1", bin2, "B2").Replace(got)
+		if got != tt.want || status != tt.status {
+			t.Errorf("Run(%q) = %q, status %d; want %q, status %d", tt.src, got, status, tt.want, tt.status)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	bin1, bin2 := binDir(t, "sushitool"), binDir(t, "sushitool", "other")
+	tests := []struct {
+		src    string
+		want   string
+		status int
+	}{
+		{`hash`, "hash: hash table empty\n", 0},
+		{`hash sushitool; hash`, "hits\tcommand\n   0\tB1/sushitool\n", 0},
+		// Running a command remembers where it was found
+		{`sushitool; sushitool; hash`, "sushitool\nsushitool\nhits\tcommand\n   2\tB1/sushitool\n", 0},
+		{`sushitool >/dev/null; type sushitool`, "sushitool is hashed (B1/sushitool)\n", 0},
+		{`hash -p B2/sushitool sushitool; sushitool`, "sushitool\n", 0},
+		{`hash sushitool other; hash -t sushitool; hash -t sushitool other`, "B1/sushitool\nsushitool\tB1/sushitool\nother\tB2/other\n", 0},
+		{`hash sushitool; hash -l`, "builtin hash -p B1/sushitool sushitool\n", 0},
+		{`hash sushitool other; hash -d sushitool; hash -t sushitool`, "", 1},
+		{`hash sushitool; hash -r; hash`, "hash: hash table empty\n", 0},
+		// Changing PATH forgets the table
+		{`hash sushitool; PATH=B2; hash`, "hash: hash table empty\n", 0},
+		{`hash cd; hash`, "hash: hash table empty\n", 0},
+		{`hash missing`, "", 1},
+	}
+	for _, tt := range tests {
+		src := strings.NewReplacer("B1", bin1, "B2", bin2).Replace(tt.src)
+		got, status := runPath(t, src, bin1+":"+bin2)
+		got = strings.NewReplacer(bin1, "B1", bin2, "B2").Replace(got)
+		if got != tt.want || status != tt.status {
+			t.Errorf("Run(%q) = %q, status %d; want %q, status %d", tt.src, got, status, tt.want, tt.status)
+		}
+	}
+}
+
+// runPath runs src with PATH set to path, returning its output and status.
+func runPath(t *testing.T, src, path string) (string, int) {
+	t.Helper()
+	f, err := syntax.Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr buffer
+	r := New(t.TempDir())
+	r.Stdout, r.Stderr = &stdout, &stderr
+	r.setVar("PATH", path)
+	r.Run(context.Background(), f)
+	return stdout.String(), r.Status()
+}
@@ -0,0 +1,206 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// hangUpWait is how long the shell waits for its jobs to end after sending
+// them SIGHUP.
+const hangUpWait = time.Second
+
+// job is a command run in the background with &.
+type job struct {
+	id   int
+	text string
+
+	// cancel stops the job's commands, sending the processes it has started
+	// the signal given as the cause
+	cancel context.CancelCauseFunc
+
+	// done is closed once the job has finished, with its exit status set
+	done   chan struct{}
+	status int
+}
+
+func (j *job) running() bool {
+	select {
+	case <-j.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// signalError is the cause given when a job's context is cancelled to send
+// a signal to its processes.
+type signalError struct {
+	sig syscall.Signal
+}
+
+func (e signalError) Error() string {
+	return "signal " + signalName(e.sig)
+}
+
+// SignalCause returns the cause to cancel the context commands run with,
+// for the processes running to get sig rather than being killed.
+func SignalCause(sig os.Signal) error {
+	s, _ := sig.(syscall.Signal)
+	return signalError{s}
+}
+
+// cancelSignal returns the signal that commands run with ctx should get
+// when it's cancelled.
+func cancelSignal(ctx context.Context) syscall.Signal {
+	var sigErr signalError
+	if errors.As(context.Cause(ctx), &sigErr) {
+		return sigErr.sig
+	}
+	return syscall.SIGKILL
+}
+
+// background starts a command as a job.
+func (r *Runner) background(ctx context.Context, s *syntax.Stmt) {
+	fg := *s
+	fg.Background = false
+
+	// Jobs outlive the input that started them, so they aren't stopped with
+	// it, only by their own cancel
+	jctx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	j := &job{id: 1, cancel: cancel, done: make(chan struct{})}
+	if len(r.jobs) > 0 {
+		j.id = r.jobs[len(r.jobs)-1].id + 1
+	}
+	if s.End <= len([]rune(r.src)) {
+		j.text = string([]rune(r.src)[s.Pos:s.End])
+		j.text = strings.TrimSpace(strings.TrimSuffix(j.text, "&"))
+	}
+	r.jobs = append(r.jobs, j)
+
+	bg := r.subshell()
+	bg.Stdin = nil
+	go func() {
+		bg.stmt(jctx, &fg)
+		j.status = bg.status
+		close(j.done)
+		cancel(nil)
+	}()
+	r.status = 0
+}
+
+// runningJobs returns the number of jobs that haven't finished.
+func (r *Runner) runningJobs() int {
+	n := 0
+	for _, j := range r.jobs {
+		if j.running() {
+			n++
+		}
+	}
+	return n
+}
+
+// hangUp sends SIGHUP to the jobs still running, as the shell is exiting.
+// The signals are sent as the jobs' contexts are cancelled, so it waits a
+// little for the jobs to end before the shell does.
+func (r *Runner) hangUp() {
+	for _, j := range r.jobs {
+		if j.running() {
+			j.cancel(signalError{syscall.SIGHUP})
+		}
+	}
+	timeout := time.After(hangUpWait)
+	for _, j := range r.jobs {
+		select {
+		case <-j.done:
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// findJob returns the job for a job spec such as %1, or the last job for
+// %% and %+.
+func (r *Runner) findJob(spec string) (*job, error) {
+	if len(r.jobs) > 0 && (spec == "%%" || spec == "%+" || spec == "%") {
+		return r.jobs[len(r.jobs)-1], nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(spec, "%"))
+	if err == nil {
+		for _, j := range r.jobs {
+			if j.id == n {
+				return j, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s: no such job", spec)
+}
+
+// removeDone forgets the jobs that have finished.
+func (r *Runner) removeDone() {
+	jobs := r.jobs[:0]
+	for _, j := range r.jobs {
+		if j.running() {
+			jobs = append(jobs, j)
+		}
+	}
+	r.jobs = jobs
+}
+
+func builtinJobs(ctx context.Context, r *Runner, args []string) int {
+	for i, j := range r.jobs {
+		current := " "
+		if i == len(r.jobs)-1 {
+			current = "+"
+		} else if i == len(r.jobs)-2 {
+			current = "-"
+		}
+		state := "Running"
+		if !j.running() {
+			state = "Done"
+			if j.status != 0 {
+				state = fmt.Sprintf("Exit %d", j.status)
+			}
+		}
+		fmt.Fprintf(r.Stdout, "[%d]%s  %-22s  %s &\n", j.id, current, state, j.text)
+	}
+	r.removeDone()
+	return 0
+}
+
+func builtinWait(ctx context.Context, r *Runner, args []string) int {
+	jobs := r.jobs
+	if len(args) > 1 {
+		jobs = nil
+		for _, spec := range args[1:] {
+			j, err := r.findJob(spec)
+			if err != nil {
+				r.errorf("wait: %v", err)
+				return 127
+			}
+			jobs = append(jobs, j)
+		}
+	}
+
+	status := 0
+	for _, j := range jobs {
+		select {
+		case <-j.done:
+			status = j.status
+		case <-ctx.Done():
+			return 128 + int(syscall.SIGINT)
+		}
+	}
+	if len(args) == 1 {
+		status = 0
+	}
+	r.removeDone()
+	return status
+}
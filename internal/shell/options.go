@@ -0,0 +1,226 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// shellOption is an option toggled with set, by its letter or with set -o,
+// or with shopt for the ones that belong to it.
+type shellOption struct {
+	name  string
+	flag  byte // 0 if the option has no letter
+	shopt bool
+}
+
+var shellOptions = []shellOption{
+	{name: "errexit", flag: 'e'},
+	{name: "noclobber", flag: 'C'},
+	{name: "noglob", flag: 'f'},
+	{name: "nounset", flag: 'u'},
+	{name: "pipefail"},
+	{name: "xtrace", flag: 'x'},
+
+	{name: "autocd", shopt: true},
+	{name: "dotglob", shopt: true},
+	{name: "failglob", shopt: true},
+	{name: "nocaseglob", shopt: true},
+	{name: "nullglob", shopt: true},
+}
+
+// option returns the shell option with a name, and whether it exists and
+// belongs to shopt rather than set.
+func option(name string, shopt bool) (shellOption, bool) {
+	for _, opt := range shellOptions {
+		if opt.name == name && opt.shopt == shopt {
+			return opt, true
+		}
+	}
+	return shellOption{}, false
+}
+
+// optionFlag returns the shell option with a letter.
+func optionFlag(flag rune) (shellOption, bool) {
+	for _, opt := range shellOptions {
+		if opt.flag != 0 && rune(opt.flag) == flag {
+			return opt, true
+		}
+	}
+	return shellOption{}, false
+}
+
+// flags returns the letters of the options that are on, for $-.
+func (r *Runner) flags() string {
+	var b strings.Builder
+	for _, opt := range shellOptions {
+		if opt.flag != 0 && r.opts[opt.name] {
+			b.WriteByte(opt.flag)
+		}
+	}
+	if r.Interactive {
+		b.WriteByte('i')
+	}
+	return b.String()
+}
+
+func builtinSet(ctx context.Context, r *Runner, args []string) int {
+	if len(args) == 1 {
+		var names []string
+		for name, v := range r.vars {
+			if !v.isArray() {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(r.Stdout, "%s=%s\n", name, quote(r.vars[name].Value))
+		}
+		return 0
+	}
+
+	args = args[1:]
+	for len(args) > 0 {
+		arg := args[0]
+		if arg == "--" || arg == "-" {
+			r.params = args[1:]
+			return 0
+		}
+		if len(arg) < 2 || arg[0] != '-' && arg[0] != '+' {
+			break
+		}
+		args = args[1:]
+		on := arg[0] == '-'
+
+		for _, c := range arg[1:] {
+			if c != 'o' {
+				opt, ok := optionFlag(c)
+				if !ok {
+					r.errorf("set: %c%c: invalid option", arg[0], c)
+					return 2
+				}
+				r.opts[opt.name] = on
+				continue
+			}
+
+			if len(args) == 0 || strings.HasPrefix(args[0], "-") || strings.HasPrefix(args[0], "+") {
+				r.listOptions(false, !on)
+				continue
+			}
+			opt, ok := option(args[0], false)
+			if !ok {
+				r.errorf("set: %s: invalid option name", args[0])
+				return 1
+			}
+			r.opts[opt.name] = on
+			args = args[1:]
+		}
+	}
+
+	if len(args) > 0 {
+		r.params = args
+	}
+	return 0
+}
+
+func builtinShopt(ctx context.Context, r *Runner, args []string) int {
+	set, unset, print, quiet, useSet := false, false, false, false, false
+	args = args[1:]
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		for _, c := range args[0][1:] {
+			switch c {
+			case 's':
+				set = true
+			case 'u':
+				unset = true
+			case 'p':
+				print = true
+			case 'q':
+				quiet = true
+			case 'o':
+				useSet = true
+			default:
+				r.errorf("shopt: -%c: invalid option", c)
+				return 2
+			}
+		}
+		args = args[1:]
+	}
+	if set && unset {
+		r.errorf("shopt: cannot set and unset shell options simultaneously")
+		return 1
+	}
+
+	if len(args) == 0 {
+		if set || unset {
+			// List the options that are on or off
+			for _, opt := range shellOptions {
+				if opt.shopt == !useSet && r.opts[opt.name] == set && !quiet {
+					r.printOption(opt, print)
+				}
+			}
+			return 0
+		}
+		if !quiet {
+			r.listOptions(!useSet, print)
+		}
+		return 0
+	}
+
+	status := 0
+	for _, name := range args {
+		opt, ok := option(name, !useSet)
+		if !ok {
+			r.errorf("shopt: %s: invalid shell option name", name)
+			status = 1
+			continue
+		}
+		switch {
+		case set || unset:
+			r.opts[opt.name] = set
+		case !r.opts[opt.name]:
+			status = 1
+			fallthrough
+		default:
+			if !quiet {
+				r.printOption(opt, print)
+			}
+		}
+	}
+	return status
+}
+
+// listOptions prints the options of set or shopt, as a table or as the
+// commands that would restore them.
+func (r *Runner) listOptions(shopt, commands bool) {
+	for _, opt := range shellOptions {
+		if opt.shopt == shopt {
+			r.printOption(opt, commands)
+		}
+	}
+}
+
+func (r *Runner) printOption(opt shellOption, command bool) {
+	on := r.opts[opt.name]
+	switch {
+	case !command:
+		state := "off"
+		if on {
+			state = "on"
+		}
+		fmt.Fprintf(r.Stdout, "%-15s\t%s\n", opt.name, state)
+	case opt.shopt:
+		flag := "-u"
+		if on {
+			flag = "-s"
+		}
+		fmt.Fprintf(r.Stdout, "shopt %s %s\n", flag, opt.name)
+	default:
+		flag := "+o"
+		if on {
+			flag = "-o"
+		}
+		fmt.Fprintf(r.Stdout, "set %s %s\n", flag, opt.name)
+	}
+}
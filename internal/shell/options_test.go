@@ -0,0 +1,164 @@
+package shell
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+func TestErrexit(t *testing.T) {
+	tests := []struct {
+		src    string
+		want   string
+		status int
+	}{
+		{`set -e; false; echo no`, "", 1},
+		{`set -e; cat missing 2>/dev/null; echo no`, "", 1},
+		{`set -e; (false; echo no); echo no`, "", 1},
+		{`set +e; false; echo yes`, "yes\n", 0},
+		// Failures that are tested don't exit
+		{`set -e; false && echo no; echo yes`, "yes\n", 0},
+		{`set -e; false || echo yes`, "yes\n", 0},
+		{`set -e; if false; then echo no; fi; echo yes`, "yes\n", 0},
+		{`set -e; while false; do echo no; done; echo yes`, "yes\n", 0},
+		{`set -e; ! true; echo yes`, "yes\n", 0},
+		// Only the last command of a pipeline counts, without pipefail
+		{`set -e; false | true; echo yes`, "yes\n", 0},
+		{`set -e; true | false; echo no`, "", 1},
+	}
+	for _, tt := range tests {
+		got, r := run(t, t.TempDir(), tt.src)
+		if got != tt.want || r.Status() != tt.status {
+			t.Errorf("Run(%q) = %q, status %d; want %q, status %d", tt.src, got, r.Status(), tt.want, tt.status)
+		}
+	}
+}
+
+func TestErrexitInteractive(t *testing.T) {
+	f, err := syntax.Parse(`set -e; false; echo no`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout buffer
+	r := New(t.TempDir())
+	r.Interactive = true
+	r.Stdout = &stdout
+	// The rest of the input is skipped, but the shell goes on
+	if err := r.Run(context.Background(), f); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if stdout.Len() > 0 || r.Status() != 1 {
+		t.Errorf("Run = %q, status %d; want nothing, status 1", stdout.String(), r.Status())
+	}
+}
+
+func TestNounset(t *testing.T) {
+	tests := []struct {
+		src    string
+		want   string
+		status int
+	}{
+		{`echo x$unset`, "x\n", 0},
+		{`set -u; echo $unset; echo no`, "", 1},
+		{`set -u; echo ${unset}; echo no`, "", 1},
+		{`set -u; echo $((unset + 1)); echo no`, "", 1},
+		{`set -u; echo ${unset-default} ${unset:-other}`, "default other\n", 0},
+		{`set -u; empty=; echo x$empty`, "x\n", 0},
+		{`set -u; echo "$@" ok`, "ok\n", 0},
+		{`set -u; set +u; echo x$unset`, "x\n", 0},
+	}
+	for _, tt := range tests {
+		got, r := run(t, t.TempDir(), tt.src)
+		if got != tt.want || r.Status() != tt.status {
+			t.Errorf("Run(%q) = %q, status %d; want %q, status %d", tt.src, got, r.Status(), tt.want, tt.status)
+		}
+	}
+}
+
+func TestXtrace(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`echo a`, ""},
+		{`set -x; a=1; echo $a "b c"`, "+ a=1\n+ echo 1 'b c'\n"},
+		{`set -x; b=2 env >/dev/null`, "+ b=2 env\n"},
+		{`set -x; set +x; echo a`, "+ set +x\n"},
+		{`PS4='> '; set -x; x=$(echo s)`, "> echo s\n> x=s\n"},
+	}
+	for _, tt := range tests {
+		f, err := syntax.Parse(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stdout, stderr, trace buffer
+		r := New(t.TempDir())
+		r.Stdout, r.Stderr, r.Trace = &stdout, &stderr, &trace
+		r.Run(context.Background(), f)
+		if got := trace.String(); got != tt.want {
+			t.Errorf("Run(%q) traced %q, want %q", tt.src, got, tt.want)
+		}
+		if stderr.Len() > 0 {
+			t.Errorf("Run(%q) wrote %q to stderr with a trace writer", tt.src, stderr.String())
+		}
+	}
+}
+
+func TestPipefail(t *testing.T) {
+	tests := []struct {
+		src    string
+		want   string
+		status int
+	}{
+		{`false | true; echo $?`, "0\n", 0},
+		{`set -o pipefail; false | true; echo $?`, "1\n", 0},
+		{`set -o pipefail; true | true; echo $?`, "0\n", 0},
+		// The status of the last command to fail
+		{`set -o pipefail; (exit 3) | (exit 2) | true; echo $?`, "2\n", 0},
+		{`set -o pipefail; set +o pipefail; false | true; echo $?`, "0\n", 0},
+		{`set -eo pipefail; false | true; echo no`, "", 1},
+	}
+	for _, tt := range tests {
+		got, r := run(t, t.TempDir(), tt.src)
+		if got != tt.want || r.Status() != tt.status {
+			t.Errorf("Run(%q) = %q, status %d; want %q, status %d", tt.src, got, r.Status(), tt.want, tt.status)
+		}
+	}
+}
+
+func TestGlobOptions(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "B.go", ".hidden.go"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		src    string
+		want   string
+		status int
+	}{
+		{`echo *.md`, "*.md\n", 0},
+		{`shopt -s nullglob; echo x *.md`, "x\n", 0},
+		{`shopt -s nullglob; shopt -u nullglob; echo *.md`, "*.md\n", 0},
+		{"shopt -s failglob; echo *.md\necho $?", "1\n", 0},
+		{`echo *.go`, "B.go a.go\n", 0},
+		{`shopt -s dotglob; echo *.go`, ".hidden.go B.go a.go\n", 0},
+		{`echo [ab].go`, "a.go\n", 0},
+		{`shopt -s nocaseglob; echo [ab].go`, "B.go a.go\n", 0},
+		{`set -f; echo *.go`, "*.go\n", 0},
+		{`set -o noglob; set +o noglob; echo a.*`, "a.go\n", 0},
+		{`shopt -q nullglob; echo $?; shopt -s nullglob; shopt -q nullglob; echo $?`, "1\n0\n", 0},
+		{`shopt -s nosuch; echo $?`, "1\n", 0},
+	}
+	for _, tt := range tests {
+		got, r := run(t, dir, tt.src)
+		if got != tt.want || r.Status() != tt.status {
+			t.Errorf("Run(%q) = %q, status %d; want %q, status %d", tt.src, got, r.Status(), tt.want, tt.status)
+		}
+	}
+}
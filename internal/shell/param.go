@@ -0,0 +1,407 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// paramValue is the value of a parameter expansion before it's added to
+// the expansion of a word: a single string, or a list of strings for $@, $*
+// and the ${name[@]} and ${name[*]} forms of arrays.
+type paramValue struct {
+	values []string
+	set    bool
+	list   bool
+
+	// star is set for lists that are joined into one field when quoted
+	star bool
+}
+
+// paramExp expands a parameter expansion into x.
+func (r *Runner) paramExp(ctx context.Context, x *expansion, p *syntax.ParamExp, quoted bool) error {
+	var index *string
+	if p.Index != nil {
+		s, err := r.expandString(ctx, p.Index)
+		if err != nil {
+			return err
+		}
+		index = &s
+	}
+
+	name := p.Name
+	var pv paramValue
+	switch {
+	case p.Indirect && index != nil && (*index == "@" || *index == "*"):
+		// ${!name[@]} gives the indexes of an array
+		if v, ok := r.vars[name]; ok {
+			pv.values = v.keys()
+		}
+		pv.set, pv.list, pv.star = len(pv.values) > 0, true, *index == "*"
+	case p.Indirect:
+		ref, err := r.lookup(name, index)
+		if err != nil {
+			return err
+		}
+		if len(ref.values) == 0 || ref.values[0] == "" {
+			return fmt.Errorf("%s: invalid indirect expansion", name)
+		}
+		refName, refIndex, hasIndex := cutIndex(ref.values[0])
+		name, index = refName, nil
+		if hasIndex {
+			index = &refIndex
+		}
+		if pv, err = r.lookup(name, index); err != nil {
+			return err
+		}
+	default:
+		var err error
+		if pv, err = r.lookup(name, index); err != nil {
+			return err
+		}
+	}
+
+	if !pv.set && !pv.list && r.opts["nounset"] && !defaultOp(p.Op) {
+		return fmt.Errorf("%s: unbound variable", name)
+	}
+
+	if p.Length {
+		n := len(pv.values)
+		if !pv.list {
+			n = len([]rune(pv.values[0]))
+		}
+		x.add(segment{text: strconv.Itoa(n), quoted: quoted, split: !quoted})
+		return nil
+	}
+
+	switch p.Op {
+	case "":
+	case ":-", "-", ":=", "=", ":?", "?", ":+", "+":
+		empty := !pv.set
+		if strings.HasPrefix(p.Op, ":") && !empty {
+			empty = len(pv.values) == 0 || len(pv.values) == 1 && pv.values[0] == ""
+		}
+		switch strings.TrimPrefix(p.Op, ":") {
+		case "-":
+			if empty {
+				return r.paramArg(ctx, x, p.Arg, quoted)
+			}
+		case "+":
+			if !empty {
+				return r.paramArg(ctx, x, p.Arg, quoted)
+			}
+			pv = paramValue{values: []string{""}}
+		case "=":
+			if empty {
+				value, err := r.expandString(ctx, p.Arg)
+				if err != nil {
+					return err
+				}
+				switch {
+				case pv.list || !isName(name):
+					return fmt.Errorf("$%s: cannot assign in this way", name)
+				case index != nil:
+					if err := r.setElement(name, *index, value, false); err != nil {
+						return err
+					}
+				default:
+					r.setVar(name, value)
+				}
+				pv = paramValue{values: []string{value}, set: true}
+			}
+		case "?":
+			if empty {
+				msg, err := r.expandString(ctx, p.Arg)
+				if err != nil {
+					return err
+				}
+				if msg == "" {
+					msg = "parameter null or not set"
+					if p.Op == "?" {
+						msg = "parameter not set"
+					}
+				}
+				return fmt.Errorf("%s: %s", name, msg)
+			}
+		}
+	case ":":
+		var err error
+		if pv, err = r.substring(ctx, pv, p, name); err != nil {
+			return err
+		}
+	default:
+		pattern, err := r.pattern(ctx, &syntax.Word{Parts: p.Arg})
+		if err != nil {
+			return err
+		}
+		var repl string
+		if p.HasRepl {
+			if repl, err = r.expandString(ctx, p.Repl); err != nil {
+				return err
+			}
+		}
+		values := make([]string, len(pv.values))
+		for i, value := range pv.values {
+			values[i] = transform(p.Op, value, pattern, repl)
+		}
+		pv.values = values
+	}
+
+	r.addParam(x, pv, quoted)
+	return nil
+}
+
+// defaultOp reports whether a parameter expansion operator acts on unset
+// parameters.
+func defaultOp(op string) bool {
+	switch strings.TrimPrefix(op, ":") {
+	case "-", "=", "?", "+":
+		return true
+	}
+	return false
+}
+
+// lookup returns the value of a parameter or of an element of an array.
+// The index @ or * gives a list of all the elements.
+func (r *Runner) lookup(name string, index *string) (paramValue, error) {
+	switch {
+	case index == nil && (name == "@" || name == "*"):
+		return paramValue{values: r.params, set: len(r.params) > 0, list: true, star: name == "*"}, nil
+	case index == nil:
+		value, ok := r.param(name)
+		return paramValue{values: []string{value}, set: ok}, nil
+	case *index == "@" || *index == "*":
+		var values []string
+		if v, ok := r.vars[name]; ok {
+			values = v.elements()
+		}
+		return paramValue{values: values, set: len(values) > 0, list: true, star: *index == "*"}, nil
+	}
+	value, ok, err := r.element(name, *index)
+	return paramValue{values: []string{value}, set: ok}, err
+}
+
+// paramArg expands the word of an expansion such as ${name:-word}, whose
+// unquoted parts are split like the rest of the unquoted expansion.
+func (r *Runner) paramArg(ctx context.Context, x *expansion, parts []syntax.WordPart, quoted bool) error {
+	arg := &expansion{}
+	if err := r.expandParts(ctx, arg, parts, quoted); err != nil {
+		return err
+	}
+	for i, field := range arg.fields {
+		if i > 0 {
+			x.breakField()
+		}
+		for _, seg := range field {
+			if !seg.quoted {
+				seg.split = true
+			}
+			x.add(seg)
+		}
+	}
+	return nil
+}
+
+// addParam adds the value of a parameter expansion to x. Quoted, the
+// elements of a list are separate fields, or joined by the first character
+// of IFS for $* and ${name[*]}. Unquoted, each is split into fields.
+func (r *Runner) addParam(x *expansion, pv paramValue, quoted bool) {
+	if !pv.list {
+		x.add(segment{text: pv.values[0], quoted: quoted, split: !quoted})
+		return
+	}
+	if quoted && pv.star {
+		sep := ""
+		if ifs := r.ifs(); ifs != "" {
+			sep = string([]rune(ifs)[0])
+		}
+		x.add(segment{text: strings.Join(pv.values, sep), quoted: true})
+		return
+	}
+	for i, value := range pv.values {
+		if i > 0 {
+			x.breakField()
+		}
+		x.add(segment{text: value, quoted: quoted, split: !quoted})
+	}
+}
+
+// expandString expands word parts as if they were double quoted.
+func (r *Runner) expandString(ctx context.Context, parts []syntax.WordPart) (string, error) {
+	x := &expansion{}
+	if err := r.expandParts(ctx, x, parts, true); err != nil {
+		return "", err
+	}
+	var fields []string
+	for _, field := range x.fields {
+		fields = append(fields, join(field))
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// substring performs ${name:offset} and ${name:offset:length}, on the
+// characters of a string or the elements of a list. Negative offsets count
+// back from the end, and a negative length gives an end counted back too.
+func (r *Runner) substring(ctx context.Context, pv paramValue, p *syntax.ParamExp, name string) (paramValue, error) {
+	expr, err := r.expandString(ctx, p.Arg)
+	if err != nil {
+		return pv, err
+	}
+	offset, err := r.arith(expr)
+	if err != nil {
+		return pv, err
+	}
+
+	// The positional parameters start with $0 at offset 0
+	values := pv.values
+	if pv.list && (name == "@" || name == "*") && p.Index == nil {
+		values = append([]string{r.Name}, values...)
+	}
+	n := int64(len(values))
+	var runes []rune
+	if !pv.list {
+		runes = []rune(values[0])
+		n = int64(len(runes))
+	}
+
+	if offset < 0 {
+		offset += n
+	}
+	if offset < 0 || offset > n {
+		if pv.list {
+			return paramValue{list: true, star: pv.star}, nil
+		}
+		return paramValue{values: []string{""}}, nil
+	}
+	end := n
+	if p.HasRepl {
+		expr, err := r.expandString(ctx, p.Repl)
+		if err != nil {
+			return pv, err
+		}
+		length, err := r.arith(expr)
+		if err != nil {
+			return pv, err
+		}
+		if length < 0 {
+			if pv.list {
+				return pv, fmt.Errorf("%s: substring expression < 0", expr)
+			}
+			end = n + length
+			if end < offset {
+				return pv, fmt.Errorf("%s: substring expression < 0", expr)
+			}
+		} else {
+			end = min(offset+length, n)
+		}
+	}
+
+	if pv.list {
+		return paramValue{values: values[offset:end], set: pv.set, list: true, star: pv.star}, nil
+	}
+	return paramValue{values: []string{string(runes[offset:end])}, set: pv.set}, nil
+}
+
+// transform applies a pattern operator of a parameter expansion to a value:
+// removing a prefix or suffix, replacing matches or changing case.
+func transform(op, value, pattern, repl string) string {
+	runes := []rune(value)
+	switch op {
+	case "#", "##":
+		// Shortest or longest matching prefix
+		for i := range len(runes) + 1 {
+			n := i
+			if op == "##" {
+				n = len(runes) - i
+			}
+			if match(pattern, string(runes[:n])) {
+				return string(runes[n:])
+			}
+		}
+	case "%", "%%":
+		// Shortest or longest matching suffix
+		for i := range len(runes) + 1 {
+			n := len(runes) - i
+			if op == "%%" {
+				n = i
+			}
+			if match(pattern, string(runes[n:])) {
+				return string(runes[:n])
+			}
+		}
+	case "/", "//", "/#", "/%":
+		return replace(op, runes, pattern, repl)
+	case "^", "^^", ",", ",,":
+		if pattern == "" {
+			pattern = "?"
+		}
+		for i, c := range runes {
+			if match(pattern, string(c)) {
+				if op[0] == '^' {
+					runes[i] = unicode.ToUpper(c)
+				} else {
+					runes[i] = unicode.ToLower(c)
+				}
+			}
+			if len(op) == 1 {
+				break
+			}
+		}
+		return string(runes)
+	}
+	return value
+}
+
+// replace replaces the longest match of pattern: the first one, every one
+// with //, or one anchored at the start with /# or the end with /%.
+func replace(op string, runes []rune, pattern, repl string) string {
+	if pattern == "" {
+		return string(runes)
+	}
+
+	// longest returns the length of the longest match at i, or -1
+	longest := func(i int) int {
+		for end := len(runes); end >= i; end-- {
+			if match(pattern, string(runes[i:end])) {
+				return end - i
+			}
+		}
+		return -1
+	}
+
+	switch op {
+	case "/#":
+		if n := longest(0); n >= 0 {
+			return repl + string(runes[n:])
+		}
+		return string(runes)
+	case "/%":
+		for i := range len(runes) + 1 {
+			if match(pattern, string(runes[i:])) {
+				return string(runes[:i]) + repl
+			}
+		}
+		return string(runes)
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		n := longest(i)
+		if n <= 0 {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		b.WriteString(repl)
+		i += n
+		if op == "/" {
+			b.WriteString(string(runes[i:]))
+			break
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package shell
+
+import "testing"
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		op, value, pattern, repl string
+		want                     string
+	}{
+		{"#", "a/b/c", "*/", "", "b/c"},
+		{"##", "a/b/c", "*/", "", "c"},
+		{"%", "f.tar.gz", ".*", "", "f.tar"},
+		{"%%", "f.tar.gz", ".*", "", "f"},
+		{"#", "abc", "x", "", "abc"},
+		{"%", "abc", "", "", "abc"},
+		{"/", "aXbXc", "X", "-", "a-bXc"},
+		{"//", "aXbXc", "X", "-", "a-b-c"},
+		{"//", "aXXb", "X*", "-", "a-"},
+		{"/#", "aba", "a", "x", "xba"},
+		{"/#", "bab", "a", "x", "bab"},
+		{"/%", "aba", "a", "x", "abx"},
+		{"//", "abc", "", "x", "abc"},
+		{"//", "a.b.c", ".", "", "abc"},
+		{"^", "hello", "", "", "Hello"},
+		{"^^", "hello", "", "", "HELLO"},
+		{"^^", "hello", "[lo]", "", "heLLO"},
+		{",", "HELLO", "", "", "hELLO"},
+		{",,", "HELLO", "", "", "hello"},
+	}
+	for _, tt := range tests {
+		if got := transform(tt.op, tt.value, tt.pattern, tt.repl); got != tt.want {
+			t.Errorf("transform(%q, %q, %q, %q) = %q, want %q", tt.op, tt.value, tt.pattern, tt.repl, got, tt.want)
+		}
+	}
+}
+
+func TestParamExp(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`a=hello; printf '[%s]' ${#a} ${a:1} ${a:1:3} ${a: -2} ${a:(-3):2} ${a:1:-1}`, "[5][ello][ell][lo][ll][ell]"},
+		{`a=hello; printf '[%s]' ${a:10} ${a:0:0} x`, "[x]"},
+		{`f=dir/file.tar.gz; printf '[%s]' ${f#*/} ${f%%.*} ${f##*.} ${f/file/name} ${f//./_}`, "[file.tar.gz][dir/file][gz][dir/name.tar.gz][dir/file_tar_gz]"},
+		{`a=abc; p='b*'; printf '[%s]' ${a%$p} "${a%"$p"}"`, "[a][abc]"},
+		{`a='x y'; printf '[%s]' ${a^^} "${a^}"`, "[X][Y][X y]"},
+
+		// Defaults and alternatives
+		{`e=; s=1; printf '[%s]' ${u-d} ${u:-d} ${e-d} ${e:-d} ${s:+alt} ${u+alt}`, "[d][d][d][alt]"},
+		{`printf '[%s]' ${u=x} $u ${e:=y} $e`, "[x][x][y][y]"},
+		{`e=; printf '[%s]' "${e-d}" "${e:-d}"`, "[][d]"},
+		{`(: ${u?gone}); echo $?`, "1\n"},
+
+		// Indexed arrays
+		{`arr=(a 'b c' d); printf '[%s]' "${arr[@]}"`, "[a][b c][d]"},
+		{`arr=(a 'b c' d); printf '[%s]' ${arr[@]}`, "[a][b][c][d]"},
+		{`arr=(a 'b c' d); printf '[%s]' "${arr[*]}"`, "[a b c d]"},
+		{`arr=(a b c); printf '[%s]' $arr ${arr[1]} ${arr[-1]} ${#arr[@]} ${#arr[1]}`, "[a][b][c][3][1]"},
+		{`arr=(a b c d); printf '[%s]' "${arr[@]:1:2}"`, "[b][c]"},
+		{`arr=(a b); arr+=(c); arr[5]=f; printf '[%s]' "${arr[@]}" "${!arr[@]}"`, "[a][b][c][f][0][1][2][5]"},
+		{`arr=(a b c); unset 'arr[1]'; printf '[%s]' "${arr[@]}" ${#arr[@]}`, "[a][c][2]"},
+		{`arr=(x.go y.go); printf '[%s]' "${arr[@]%.go}"`, "[x][y]"},
+		{`i=1; arr=(a b c); printf '[%s]' ${arr[i+1]}`, "[c]"},
+		{`arr=(); printf '[%s]' "${arr[@]}" x`, "[x]"},
+
+		// Associative arrays
+		{`declare -A m; m[one]=1; m[two]=2; printf '[%s]' ${m[one]} ${m[two]} ${#m[@]}`, "[1][2][2]"},
+		{`declare -A m=([k]='v w'); printf '[%s]' "${m[k]}" "${!m[@]}"`, "[v w][k]"},
+
+		// Indirection
+		{`a=b; b=c; printf '[%s]' ${!a}`, "[c]"},
+		{`arr=(x y); r='arr[1]'; printf '[%s]' ${!r}`, "[y]"},
+	}
+	for _, tt := range tests {
+		if got, _ := run(t, t.TempDir(), tt.src); got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package shell
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Compiled patterns, as the same ones tend to be matched over and over in
+// loops and globs.
+var (
+	patternCache = make(map[patternKey]*regexp.Regexp)
+	patternMtx   sync.Mutex
+)
+
+type patternKey struct {
+	pattern string
+	fold    bool
+}
+
+// match reports whether s matches the shell pattern, which may use *, ? and
+// bracket expressions, with \ escaping the next character.
+func match(pattern, s string) bool {
+	return matchFold(pattern, s, false)
+}
+
+// matchFold is like match, but ignores case if fold is set.
+func matchFold(pattern, s string, fold bool) bool {
+	re := compilePattern(pattern, fold)
+	return re != nil && re.MatchString(s)
+}
+
+func compilePattern(pattern string, fold bool) *regexp.Regexp {
+	patternMtx.Lock()
+	defer patternMtx.Unlock()
+
+	key := patternKey{pattern, fold}
+	if re, ok := patternCache[key]; ok {
+		return re
+	}
+	expr := "^" + patternRegexp(pattern) + "$"
+	if fold {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		re = nil
+	}
+	patternCache[key] = re
+	return re
+}
+
+// patternRegexp translates a shell pattern into regular expression syntax.
+func patternRegexp(pattern string) string {
+	var b strings.Builder
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			b.WriteString("(?s:.*)")
+		case '?':
+			b.WriteString("(?s:.)")
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(runes[i])))
+			} else {
+				b.WriteString(`\\`)
+			}
+		case '[':
+			if class, n := bracketExpr(runes[i:]); n > 0 {
+				b.WriteString(class)
+				i += n - 1
+			} else {
+				b.WriteString(`\[`)
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// bracketExpr translates the bracket expression at the start of runes,
+// returning it and the number of runes it used, or 0 if it isn't closed.
+func bracketExpr(runes []rune) (string, int) {
+	var b strings.Builder
+	b.WriteByte('[')
+	i := 1
+	if i < len(runes) && (runes[i] == '!' || runes[i] == '^') {
+		b.WriteByte('^')
+		i++
+	}
+	first := true
+	for ; i < len(runes); i++ {
+		c := runes[i]
+		if c == ']' && !first {
+			b.WriteByte(']')
+			return b.String(), i + 1
+		}
+		first = false
+		switch {
+		case c == '[' && i+1 < len(runes) && runes[i+1] == ':':
+			// Character class such as [:alpha:]
+			end := strings.Index(string(runes[i:]), ":]")
+			if end < 0 {
+				return "", 0
+			}
+			b.WriteString(string(runes[i : i+end+2]))
+			i += len([]rune(string(runes[i:])[:end+2])) - 1
+		case c == '\\' && i+1 < len(runes):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case c == '-':
+			b.WriteByte('-')
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return "", 0
+}
+
+// hasMeta reports whether pattern contains unescaped pattern characters.
+func hasMeta(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+// escapePattern escapes the pattern characters in s so it matches literally.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// unescapePattern removes the escapes from a pattern without metacharacters.
+func unescapePattern(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		b.WriteByte(pattern[i])
+	}
+	return b.String()
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	sort.Strings(names)
+	return names, err
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,295 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+)
+
+func builtinRead(ctx context.Context, r *Runner, args []string) int {
+	var prompt, array string
+	var timeout time.Duration
+	raw, secret := false, false
+
+	args = args[1:]
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i := 1; i < len(arg); i++ {
+			switch c := arg[i]; c {
+			case 'r':
+				raw = true
+			case 's':
+				secret = true
+			case 'a', 'p', 't':
+				// The value is the rest of the argument or the next one
+				value := arg[i+1:]
+				if value == "" {
+					if len(args) == 0 {
+						r.errorf("read: -%c: option requires an argument", c)
+						return 2
+					}
+					value, args = args[0], args[1:]
+				}
+				switch c {
+				case 'a':
+					array = value
+				case 'p':
+					prompt = value
+				case 't':
+					secs, err := strconv.ParseFloat(value, 64)
+					if err != nil || secs < 0 {
+						r.errorf("read: %s: invalid timeout specification", value)
+						return 1
+					}
+					timeout = time.Duration(secs * float64(time.Second))
+				}
+				i = len(arg)
+			default:
+				r.errorf("read: -%c: invalid option", c)
+				return 2
+			}
+		}
+	}
+
+	names := args
+	if array != "" {
+		names = append([]string{array}, names...)
+	}
+	for _, name := range names {
+		if !isName(name) {
+			r.errorf("read: `%s': not a valid identifier", name)
+			return 1
+		}
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	line, err := r.readLine(ctx, prompt, secret, raw)
+	status := 0
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		// Timing out is reported like bash, as if killed by SIGALRM
+		return 128 + int(syscall.SIGALRM)
+	case err == io.EOF:
+		// A last line without a newline is still assigned
+		status = 1
+	case err != nil:
+		if ctx.Err() == nil {
+			r.errorf("read: %v", err)
+		}
+		return 1
+	}
+
+	switch {
+	case array != "":
+		v := &Variable{Indexed: make(map[int]string)}
+		for i, field := range r.readFields(line, -1, raw) {
+			v.Indexed[i] = field
+		}
+		if old, ok := r.vars[array]; ok {
+			v.Exported = old.Exported
+		}
+		r.vars[array] = v
+	case len(names) == 0:
+		// REPLY gets the whole line, without any splitting
+		fields := r.readFields(line, 0, raw)
+		r.setVar("REPLY", fields[0])
+	default:
+		fields := r.readFields(line, len(names), raw)
+		for i, name := range names {
+			value := ""
+			if i < len(fields) {
+				value = fields[i]
+			}
+			r.setVar(name, value)
+		}
+	}
+	return status
+}
+
+// readLine reads a line of input for the read builtin, without the newline.
+// Unless raw, a line ending with a backslash continues on the next one.
+func (r *Runner) readLine(ctx context.Context, prompt string, secret, raw bool) (string, error) {
+	var b strings.Builder
+	for {
+		line, err := r.inputLine(ctx, prompt, secret)
+		if raw || err != nil || !continues(line) {
+			b.WriteString(line)
+			return b.String(), err
+		}
+		b.WriteString(strings.TrimSuffix(line, "\\"))
+		prompt = ""
+	}
+}
+
+// continues reports whether a line ends with an unescaped backslash.
+func continues(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, "\\"))
+	return n%2 == 1
+}
+
+// inputLine reads one line from Stdin, or through ReadLine if it's set and
+// the input hasn't been redirected. The prompt is only shown, and the input
+// only hidden, when reading from a terminal.
+func (r *Runner) inputLine(ctx context.Context, prompt string, secret bool) (string, error) {
+	if r.ReadLine != nil && r.Stdin == os.Stdin {
+		return r.ReadLine(ctx, prompt, secret)
+	}
+	if r.Stdin == nil {
+		return "", io.EOF
+	}
+
+	f, ok := r.Stdin.(*os.File)
+	tty := ok && term.IsTerminal(f.Fd())
+	if tty && prompt != "" {
+		io.WriteString(r.Stderr, prompt)
+	}
+
+	// A read that timed out is left running, and gives the next line that
+	// comes in to the next read of the same input
+	read := r.unread
+	r.unread = nil
+	if read == nil || read.in != r.Stdin {
+		read = &pendingRead{in: r.Stdin, done: make(chan readResult, 1)}
+		go func(in io.Reader) {
+			if tty && secret {
+				line, err := term.ReadPassword(f.Fd())
+				read.done <- readResult{string(line), err}
+				return
+			}
+			line, err := readBytes(in)
+			read.done <- readResult{line, err}
+		}(r.Stdin)
+	}
+
+	select {
+	case res := <-read.done:
+		return res.line, res.err
+	case <-ctx.Done():
+		r.unread = read
+		return "", context.Cause(ctx)
+	}
+}
+
+// pendingRead is a line being read from in, sent to done once it is.
+type pendingRead struct {
+	in   io.Reader
+	done chan readResult
+}
+
+type readResult struct {
+	line string
+	err  error
+}
+
+// readBytes reads up to a newline a byte at a time, so that no more input
+// than the line is taken from a shared reader.
+func readBytes(in io.Reader) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			if err == io.EOF && len(line) == 0 {
+				return "", io.EOF
+			}
+			return string(line), io.EOF
+		}
+	}
+}
+
+// readFields splits a line read by read into n fields at the characters of
+// IFS, with the last field holding the rest of the line. With n 0 the line
+// is kept whole, and with n -1 it's split into as many fields as it has.
+// Unless raw, a backslash escapes the character after it.
+func (r *Runner) readFields(line string, n int, raw bool) []string {
+	var chars []rune
+	var escaped []bool
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\\' && !raw {
+			i++
+			if i == len(runes) {
+				break
+			}
+			chars, escaped = append(chars, runes[i]), append(escaped, true)
+			continue
+		}
+		chars, escaped = append(chars, runes[i]), append(escaped, false)
+	}
+	if n == 0 {
+		return []string{string(chars)}
+	}
+
+	ifs := r.ifs()
+	isSep := func(i int) bool {
+		return !escaped[i] && strings.ContainsRune(ifs, chars[i])
+	}
+	isSpace := func(i int) bool {
+		return isSep(i) && strings.ContainsRune(" \t\n", chars[i])
+	}
+	skipSpace := func(i int) int {
+		for i < len(chars) && isSpace(i) {
+			i++
+		}
+		return i
+	}
+
+	// field returns the field starting at i and where the next one starts:
+	// a field ends at IFS whitespace, or at one other separator with the
+	// whitespace around it
+	field := func(i int) (string, int) {
+		start := i
+		for i < len(chars) && !isSep(i) {
+			i++
+		}
+		text := string(chars[start:i])
+		i = skipSpace(i)
+		if i < len(chars) && isSep(i) {
+			i = skipSpace(i + 1)
+		}
+		return text, i
+	}
+
+	var fields []string
+	i := skipSpace(0)
+	for i < len(chars) && (n < 0 || len(fields) < n-1) {
+		var text string
+		text, i = field(i)
+		fields = append(fields, text)
+	}
+	if i >= len(chars) || n < 0 {
+		return fields
+	}
+
+	// The rest goes to the last field, without the whitespace that ends it.
+	// If it's a single field and its separator, the separator goes too.
+	if text, next := field(i); next == len(chars) {
+		return append(fields, text)
+	}
+	end := len(chars)
+	for end > i && isSpace(end-1) {
+		end--
+	}
+	return append(fields, string(chars[i:end]))
+}
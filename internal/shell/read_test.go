@@ -0,0 +1,84 @@
+package shell
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`read a b c <<< 'one two three'; echo "[$a][$b][$c]"`, "[one][two][three]\n"},
+		// The last variable gets the rest of the line, and those after the
+		// fields run out are empty
+		{`read a b <<< '  one   two  three  '; echo "[$a][$b]"`, "[one][two  three]\n"},
+		{`read a b c <<< 'one'; echo "[$a][$b][$c]"`, "[one][][]\n"},
+		{`read a <<< '  x  '; echo "[$a]"`, "[x]\n"},
+		{`read <<< '  x  '; echo "[$REPLY]"`, "[  x  ]\n"},
+		{`read -a arr <<< 'p q  r'; echo "${#arr[@]} ${arr[2]}"`, "3 r\n"},
+		// Other characters of IFS than whitespace each end a field, even an
+		// empty one, with the whitespace around them
+		{`IFS=: read a b c <<< 'x::y:z'; echo "[$a][$b][$c]"`, "[x][][y:z]\n"},
+		{`IFS=': ' read a b <<< 'x : y'; echo "[$a][$b]"`, "[x][y]\n"},
+		{`IFS=: read a b <<< 'x:y:'; echo "[$a][$b]"`, "[x][y]\n"},
+		{`IFS=: read a b <<< 'x:y:z:'; echo "[$a][$b]"`, "[x][y:z:]\n"},
+		{`IFS= read a <<< '  x  '; echo "[$a]"`, "[  x  ]\n"},
+		// Backslashes escape, unless -r
+		{`read a b <<< 'a\ b c'; echo "[$a][$b]"`, "[a b][c]\n"},
+		{`read -r a b <<< 'a\ b c'; echo "[$a][$b]"`, "[a\\][b c]\n"},
+		{`read a <<< 'x\\y'; echo "[$a]"`, "[x\\y]\n"},
+		{`read -r a <<< 'x\\y'; echo "[$a]"`, "[x\\\\y]\n"},
+		{`printf 'a\\\nb\n' | { read a; echo "[$a]"; }`, "[ab]\n"},
+		{`printf 'a\\\nb\n' | { read -r a; echo "[$a]"; }`, "[a\\]\n"},
+		// A last line without a newline is read, but fails
+		{`printf last | { read a; echo "$? [$a]"; }`, "1 [last]\n"},
+		{`read a < /dev/null; echo "$? [$a]"`, "1 []\n"},
+		{`read 1a <<< x; echo $?`, "1\n"},
+	}
+	for _, tt := range tests {
+		if got, _ := run(t, t.TempDir(), tt.src); got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+
+	f, err := syntax.Parse(`read -t 0.05 a; echo "$? [$a]"; read -t 5 b; echo "$? [$b]"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout buffer
+	r := New(t.TempDir())
+	r.Stdin, r.Stdout = pr, &stdout
+	go func() {
+		// Only once the first read has timed out
+		time.Sleep(200 * time.Millisecond)
+		pw.WriteString("late\n")
+	}()
+
+	start := time.Now()
+	if err := r.Run(context.Background(), f); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	// The first read gives up as if killed by SIGALRM, leaving the line
+	// that comes in later to the next one
+	if got, want := stdout.String(), "142 []\n0 [late]\n"; got != want {
+		t.Errorf("Run = %q, want %q", got, want)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("Run took %v, want the second read done when the line came", d)
+	}
+}
@@ -0,0 +1,971 @@
+// Package shell runs programs parsed by the syntax package.
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/devenjarvis/sushi/internal/frecency"
+	"github.com/devenjarvis/sushi/internal/syntax"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrExit is returned by Run when the exit builtin was used.
+var ErrExit = errors.New("exit")
+
+// Runner executes programs and holds the state of the shell between them:
+// variables, the working directory and the last exit status.
+type Runner struct {
+	// Dir is the working directory. Commands never change the working
+	// directory of the sushi process itself.
+	Dir string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Trace receives the commands printed by set -x. If nil, they go to
+	// Stderr.
+	Trace io.Writer
+
+	// ReadLine, if set, reads the lines for the read builtin when its input
+	// is os.Stdin, showing the prompt and hiding what's typed if secret is
+	// set. It should return the error of ctx if it's done first.
+	ReadLine func(ctx context.Context, prompt string, secret bool) (string, error)
+
+	// Pick, if set, lets the user choose one of several choices for what
+	// was asked for with query, as z does when directories score closely.
+	// It returns an error if none was chosen.
+	Pick func(ctx context.Context, query string, choices []string) (string, error)
+
+	// Dirs, if set, records the directories changed to, which the z builtin
+	// jumps among.
+	Dirs *frecency.Store
+
+	// Commands, if set, returns the builtins and the commands in PATH as
+	// they were last found, which a command that wasn't found is corrected
+	// to. If it's nil or returns nil, PATH is read for them.
+	Commands func() []string
+
+	// Name is the name of the shell or script being run, $0.
+	Name string
+
+	// Interactive is set when commands come from the prompt. A failing
+	// command with errexit set then only stops the current input instead of
+	// exiting, and errors in expansions aren't fatal.
+	Interactive bool
+
+	vars   map[string]*Variable
+	params []string
+
+	// Directories saved by pushd, the most recent first
+	dirStack []string
+
+	// The words of the command being run, if each gave one argument, and
+	// the corrections suggested for them
+	words []*syntax.Word
+	fixes *corrections
+
+	// Set while the handler for commands not found runs
+	inHandler bool
+
+	// Paths of the commands found in PATH, remembered by the hash builtin,
+	// and the PATH they were found in
+	hash     map[string]*hashEntry
+	hashPath string
+
+	// Shell options set with set and shopt
+	opts map[string]bool
+
+	// Actions set with trap, by condition or signal name. An empty action
+	// ignores the signal.
+	traps  map[string]string
+	inTrap bool
+
+	// Signals received and not yet handled
+	sigMu   sync.Mutex
+	pending []os.Signal
+
+	// Source of the program being run, for the text of jobs
+	src string
+
+	// Jobs started with &, and whether exit has warned that some are still
+	// running, in this input or the one before
+	jobs           []*job
+	exitWarned     bool
+	exitWarnedLast bool
+
+	// Exit status of the last command
+	status int
+
+	// Number of command substitutions run, to tell whether a command
+	// without a name ran any
+	substs int
+
+	// Set once the exit builtin has run
+	exiting  bool
+	exitCode int
+
+	// Set when errexit stops the current input of an interactive shell
+	aborted bool
+
+	// Nonzero while running commands whose failure errexit ignores, such as
+	// the condition of an if
+	noErrExit int
+
+	// Loop control from break and continue
+	loopDepth int
+	breakN    int
+	contN     int
+
+	// Pipes to the process substitutions of the commands being run, which
+	// are passed on to the commands the shell starts
+	procSubsts []procSubst
+
+	// A read of a line that the read builtin gave up on when it timed out
+	unread *pendingRead
+}
+
+// procSubst is the shell's end of the pipe to a process substitution.
+type procSubst struct {
+	file *os.File
+
+	// done is closed once the commands reading from >(...) have finished,
+	// and nil for <(...)
+	done chan struct{}
+}
+
+// New returns a Runner in dir with variables initialized from the
+// environment.
+func New(dir string) *Runner {
+	r := &Runner{
+		Dir:    dir,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Name:   "sushi",
+		vars:   make(map[string]*Variable),
+		opts:   make(map[string]bool),
+		traps:  make(map[string]string),
+	}
+	// Naming a directory changes to it, in interactive shells
+	r.opts["autocd"] = true
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			r.vars[name] = &Variable{Value: value, Exported: true}
+		}
+	}
+	r.vars["PWD"] = &Variable{Value: dir, Exported: true}
+	return r
+}
+
+// Run executes the program f. It returns ErrExit if the shell should exit.
+func (r *Runner) Run(ctx context.Context, f *syntax.File) error {
+	r.src = f.Src
+	r.fixes = &corrections{}
+	r.exitWarnedLast, r.exitWarned = r.exitWarned, false
+	r.stmts(ctx, f.Stmts)
+	r.handleSignals(ctx)
+	r.aborted = false
+	if r.exiting {
+		return ErrExit
+	}
+	return nil
+}
+
+// SetParams sets the positional parameters, $1 onwards.
+func (r *Runner) SetParams(params []string) {
+	r.params = params
+}
+
+// Status returns the exit status of the last command run.
+func (r *Runner) Status() int {
+	return r.status
+}
+
+// ExitCode returns the status given to the exit builtin.
+func (r *Runner) ExitCode() int {
+	return r.exitCode
+}
+
+// subshell returns a copy of the runner whose changes don't affect r.
+func (r *Runner) subshell() *Runner {
+	sub := &Runner{
+		Dir:    r.Dir,
+		Stdin:  r.Stdin,
+		Stdout: r.Stdout,
+		Stderr: r.Stderr,
+		Trace:  r.Trace,
+		Name:   r.Name,
+
+		ReadLine: r.ReadLine,
+		Pick:     r.Pick,
+		Dirs:     r.Dirs,
+		Commands: r.Commands,
+
+		vars:   make(map[string]*Variable, len(r.vars)),
+		params: r.params,
+		opts:   make(map[string]bool, len(r.opts)),
+
+		dirStack: append([]string(nil), r.dirStack...),
+		fixes:    r.fixes,
+		hash:     make(map[string]*hashEntry, len(r.hash)),
+		hashPath: r.hashPath,
+		traps:    make(map[string]string),
+		src:      r.src,
+		status:   r.status,
+
+		noErrExit:  r.noErrExit,
+		procSubsts: append([]procSubst(nil), r.procSubsts...),
+	}
+	for name, v := range r.vars {
+		sub.vars[name] = v.clone()
+	}
+	for name, on := range r.opts {
+		sub.opts[name] = on
+	}
+	for name, e := range r.hash {
+		sub.hash[name] = &hashEntry{path: e.path, hits: e.hits}
+	}
+
+	// Traps are reset in subshells, except for ignored signals
+	for name, action := range r.traps {
+		if action == "" {
+			sub.traps[name] = action
+		}
+	}
+	return sub
+}
+
+func (r *Runner) errorf(format string, a ...any) {
+	fmt.Fprintf(r.Stderr, format+"\n", a...)
+}
+
+// stopped reports whether the current list of commands should stop running.
+func (r *Runner) stopped(ctx context.Context) bool {
+	return r.exiting || r.aborted || r.breakN > 0 || r.contN > 0 || ctx.Err() != nil
+}
+
+func (r *Runner) stmts(ctx context.Context, stmts []*syntax.Stmt) {
+	for _, s := range stmts {
+		r.handleSignals(ctx)
+		if r.stopped(ctx) {
+			return
+		}
+		r.stmt(ctx, s)
+	}
+}
+
+func (r *Runner) stmt(ctx context.Context, s *syntax.Stmt) {
+	if s.Background {
+		r.background(ctx, s)
+		return
+	}
+
+	defer r.closeProcSubsts(len(r.procSubsts))
+
+	restore, err := r.redirect(ctx, s.Redirs)
+	if err != nil {
+		r.errorf("%v", err)
+		r.status = 1
+		return
+	}
+	defer restore()
+
+	if s.Negated {
+		r.noErrExit++
+		r.cmd(ctx, s.Cmd)
+		r.noErrExit--
+		if r.status == 0 {
+			r.status = 1
+		} else {
+			r.status = 0
+		}
+		return
+	}
+
+	r.cmd(ctx, s.Cmd)
+	if r.status != 0 && r.noErrExit == 0 && exitsOnError(s.Cmd) {
+		r.runTrap(ctx, "ERR")
+		if r.opts["errexit"] {
+			r.errExit()
+		}
+	}
+}
+
+// exitsOnError reports whether errexit and the ERR trap apply to the
+// failure of a command.
+// Compound commands only fail because a command in them did, which errexit
+// has dealt with unless it was ignored there, as in a && list.
+func exitsOnError(cmd syntax.Command) bool {
+	switch cmd := cmd.(type) {
+	case *syntax.CallExpr, *syntax.Subshell, *syntax.DeclClause:
+		return true
+	case *syntax.BinaryCmd:
+		return cmd.Op == "|" || cmd.Op == "|&"
+	}
+	return false
+}
+
+// errExit stops the shell after a command failed with errexit set, or just
+// the current input if the shell is interactive.
+func (r *Runner) errExit() {
+	if r.Interactive {
+		r.aborted = true
+		return
+	}
+	r.exiting = true
+	r.exitCode = r.status
+}
+
+// expandError reports an error in expanding words, which makes a shell that
+// isn't interactive exit.
+func (r *Runner) expandError(err error) {
+	r.errorf("%v", err)
+	r.status = 1
+	var noMatch noMatchError
+	if !r.Interactive && !errors.As(err, &noMatch) {
+		r.exiting = true
+		r.exitCode = r.status
+	}
+}
+
+// closeProcSubsts closes the pipes to the process substitutions started
+// after the first n, once the command using them is done, and waits for
+// the ones it was writing to.
+func (r *Runner) closeProcSubsts(n int) {
+	if len(r.procSubsts) <= n {
+		return
+	}
+	for _, ps := range r.procSubsts[n:] {
+		ps.file.Close()
+	}
+	for _, ps := range r.procSubsts[n:] {
+		if ps.done != nil {
+			<-ps.done
+		}
+	}
+	r.procSubsts = r.procSubsts[:n]
+}
+
+func (r *Runner) cmd(ctx context.Context, cmd syntax.Command) {
+	switch cmd := cmd.(type) {
+	case *syntax.CallExpr:
+		r.call(ctx, cmd)
+	case *syntax.Subshell:
+		sub := r.subshell()
+		sub.stmts(ctx, cmd.Stmts)
+		r.status = sub.exitTrap(ctx)
+	case *syntax.Block:
+		r.stmts(ctx, cmd.Stmts)
+	case *syntax.DeclClause:
+		r.declClause(ctx, cmd)
+	case *syntax.BinaryCmd:
+		switch cmd.Op {
+		case "&&":
+			r.noErrExit++
+			r.stmt(ctx, cmd.X)
+			r.noErrExit--
+			if r.status == 0 && !r.stopped(ctx) {
+				r.stmt(ctx, cmd.Y)
+			}
+		case "||":
+			r.noErrExit++
+			r.stmt(ctx, cmd.X)
+			r.noErrExit--
+			if r.status != 0 && !r.stopped(ctx) {
+				r.stmt(ctx, cmd.Y)
+			}
+		default:
+			r.pipeline(ctx, cmd)
+		}
+	case *syntax.IfClause:
+		r.noErrExit++
+		r.stmts(ctx, cmd.Cond)
+		r.noErrExit--
+		if r.stopped(ctx) {
+			return
+		}
+		if r.status == 0 {
+			r.stmts(ctx, cmd.Then)
+		} else if cmd.Else != nil {
+			r.stmts(ctx, cmd.Else)
+		} else {
+			r.status = 0
+		}
+	case *syntax.WhileClause:
+		r.whileClause(ctx, cmd)
+	case *syntax.ForClause:
+		r.forClause(ctx, cmd)
+	case *syntax.CaseClause:
+		r.caseClause(ctx, cmd)
+	}
+}
+
+// loopDone handles break and continue at the end of a loop iteration and
+// reports whether the loop should stop.
+func (r *Runner) loopDone(ctx context.Context) bool {
+	if r.breakN > 0 {
+		r.breakN--
+		return true
+	}
+	if r.contN > 0 {
+		r.contN--
+		if r.contN > 0 {
+			// continue an outer loop
+			return true
+		}
+	}
+	return r.exiting || r.aborted || ctx.Err() != nil
+}
+
+func (r *Runner) whileClause(ctx context.Context, cmd *syntax.WhileClause) {
+	r.loopDepth++
+	defer func() { r.loopDepth-- }()
+
+	status := 0
+	for {
+		r.noErrExit++
+		r.stmts(ctx, cmd.Cond)
+		r.noErrExit--
+		if r.stopped(ctx) {
+			if r.loopDone(ctx) {
+				break
+			}
+			continue
+		}
+		if (r.status == 0) == cmd.Until {
+			break
+		}
+		r.stmts(ctx, cmd.Do)
+		status = r.status
+		if r.loopDone(ctx) {
+			break
+		}
+	}
+	r.status = status
+}
+
+func (r *Runner) forClause(ctx context.Context, cmd *syntax.ForClause) {
+	items := r.params
+	if cmd.HasIn {
+		var err error
+		if items, err = r.fields(ctx, cmd.Items...); err != nil {
+			r.expandError(err)
+			return
+		}
+	}
+
+	r.loopDepth++
+	defer func() { r.loopDepth-- }()
+
+	r.status = 0
+	for _, item := range items {
+		r.setVar(cmd.Name, item)
+		r.stmts(ctx, cmd.Do)
+		if r.loopDone(ctx) {
+			break
+		}
+	}
+}
+
+func (r *Runner) caseClause(ctx context.Context, cmd *syntax.CaseClause) {
+	subject, err := r.literal(ctx, cmd.Word)
+	if err != nil {
+		r.expandError(err)
+		return
+	}
+
+	r.status = 0
+	for _, item := range cmd.Items {
+		for _, word := range item.Patterns {
+			pattern, err := r.pattern(ctx, word)
+			if err != nil {
+				r.expandError(err)
+				return
+			}
+			if match(pattern, subject) {
+				r.stmts(ctx, item.Stmts)
+				return
+			}
+		}
+	}
+}
+
+func (r *Runner) call(ctx context.Context, call *syntax.CallExpr) {
+	substs := r.substs
+	args, err := r.fields(ctx, call.Args...)
+	if err != nil {
+		r.expandError(err)
+		return
+	}
+
+	if len(args) == 0 {
+		// The status is that of the last command substitution, if any
+		status := 0
+		for _, as := range call.Assigns {
+			if err := r.assign(ctx, as); err != nil {
+				r.expandError(err)
+				return
+			}
+		}
+		if r.substs != substs {
+			status = r.status
+		}
+		r.status = status
+		return
+	}
+
+	// Assignments before a command only set variables for it, so arrays
+	// are left out as they can't be exported
+	var assigns []string
+	for _, as := range call.Assigns {
+		if as.Array != nil || as.Index != nil {
+			continue
+		}
+		value, err := r.assignValue(ctx, as.Value)
+		if err != nil {
+			r.expandError(err)
+			return
+		}
+		if as.Append {
+			old, _ := r.getVar(as.Name)
+			value = old + value
+		}
+		assigns = append(assigns, as.Name+"="+value)
+	}
+	r.trace(assigns, args)
+
+	r.words = nil
+	if len(args) == len(call.Args) {
+		r.words = call.Args
+	}
+
+	r.simple(ctx, args, assigns)
+}
+
+// simple runs a builtin or an external command, with the assignments that
+// came before it.
+func (r *Runner) simple(ctx context.Context, args, assigns []string) {
+	if fn, ok := builtins[args[0]]; ok {
+		// Assignments only last for the duration of a builtin
+		saved := make(map[string]*Variable)
+		for _, as := range assigns {
+			name, value, _ := strings.Cut(as, "=")
+			if _, done := saved[name]; !done {
+				saved[name] = nil
+				if v, ok := r.vars[name]; ok {
+					saved[name] = v.clone()
+				}
+			}
+			r.setVar(name, value)
+		}
+		r.status = fn(ctx, r, args)
+		for name, v := range saved {
+			if v == nil {
+				delete(r.vars, name)
+			} else {
+				r.vars[name] = v
+			}
+		}
+		return
+	}
+
+	r.exec(ctx, args, assigns)
+}
+
+// exec runs an external command with extra environment variables.
+func (r *Runner) exec(ctx context.Context, args []string, env []string) {
+	path, err := r.lookPath(args[0])
+	if err != nil {
+		if r.autoCd(ctx, args) || r.notFoundHandler(ctx, args, env) {
+			return
+		}
+		r.errorf("didn't find '%s'", args[0])
+		r.correct(0, closest(args[0], r.commandNames()))
+		r.status = 127
+		return
+	}
+
+	cmd := exec.CommandContext(ctx, path, args[1:]...)
+	cmd.Args[0] = args[0]
+	cmd.Dir = r.Dir
+	cmd.Env = append(r.environ(), env...)
+	cmd.Stdin = r.Stdin
+	cmd.Stdout = r.Stdout
+	cmd.Stderr = r.Stderr
+	for _, ps := range r.procSubsts {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, ps.file)
+	}
+
+	// Jobs that are hung up pass the signal on to their processes
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(cancelSignal(ctx))
+	}
+
+	err = cmd.Run()
+	if r.status = exitStatus(err); r.status < 0 && ctx.Err() != nil {
+		// The job was stopped before the process could start
+		r.status = 128 + int(cancelSignal(ctx))
+	} else if r.status < 0 {
+		r.errorf("%s: %v", args[0], err)
+		r.status = 126
+	}
+}
+
+// exitStatus returns the exit status for the error from running a process,
+// or -1 if the process couldn't be started.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// lookPath finds the executable for a command name in the directories of
+// PATH, remembering where it was in the hash table.
+func (r *Runner) lookPath(name string) (string, error) {
+	if strings.ContainsRune(name, '/') {
+		path := r.absPath(name)
+		return path, isExecutable(path)
+	}
+
+	if e, ok := r.hashed(name); ok && isExecutable(e.path) == nil {
+		e.hits++
+		return e.path, nil
+	}
+	paths := r.searchPath(name, false)
+	if len(paths) == 0 {
+		return "", exec.ErrNotFound
+	}
+	if filepath.IsAbs(paths[0].dir) {
+		r.hash[name] = &hashEntry{path: paths[0].path, hits: 1}
+	}
+	return paths[0].path, nil
+}
+
+// pathMatch is an executable found in a directory of PATH.
+type pathMatch struct {
+	dir  string
+	path string
+}
+
+// searchPath returns the executables for a command name in the directories
+// of PATH, the first one only unless all is set.
+func (r *Runner) searchPath(name string, all bool) []pathMatch {
+	var matches []pathMatch
+	path, _ := r.getVar("PATH")
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		path := filepath.Join(r.absPath(dir), name)
+		if err := isExecutable(path); err == nil {
+			matches = append(matches, pathMatch{dir: dir, path: path})
+			if !all {
+				break
+			}
+		}
+	}
+	return matches
+}
+
+func isExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return os.ErrPermission
+	}
+	return nil
+}
+
+// absPath resolves path relative to the working directory.
+func (r *Runner) absPath(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(r.Dir, path)
+}
+
+// pipeline runs the commands of a pipeline concurrently, each in a subshell.
+func (r *Runner) pipeline(ctx context.Context, cmd *syntax.BinaryCmd) {
+	var stages []*syntax.Stmt
+	var ops []string
+	var flatten func(s *syntax.Stmt)
+	flatten = func(s *syntax.Stmt) {
+		if b, ok := s.Cmd.(*syntax.BinaryCmd); ok && !s.Negated && len(s.Redirs) == 0 && (b.Op == "|" || b.Op == "|&") {
+			flatten(b.X)
+			ops = append(ops, b.Op)
+			flatten(b.Y)
+			return
+		}
+		stages = append(stages, s)
+	}
+	flatten(cmd.X)
+	ops = append(ops, cmd.Op)
+	flatten(cmd.Y)
+
+	var wg sync.WaitGroup
+	statuses := make([]int, len(stages))
+	stdin := r.Stdin
+	var stdinPipe *os.File
+
+	for i, stage := range stages {
+		sub := r.subshell()
+		sub.Stdin = stdin
+
+		var pr, pw *os.File
+		if i < len(stages)-1 {
+			var err error
+			if pr, pw, err = os.Pipe(); err != nil {
+				r.errorf("%v", err)
+				r.status = 1
+				break
+			}
+			sub.Stdout = pw
+			if ops[i] == "|&" {
+				sub.Stderr = pw
+			}
+		}
+
+		wg.Add(1)
+		go func(i int, stage *syntax.Stmt, in, out *os.File) {
+			defer wg.Done()
+			sub.stmt(ctx, stage)
+			statuses[i] = sub.status
+			if out != nil {
+				out.Close()
+			}
+			if in != nil {
+				in.Close()
+			}
+		}(i, stage, stdinPipe, pw)
+
+		stdin = pr
+		stdinPipe = pr
+	}
+
+	wg.Wait()
+	r.status = statuses[len(statuses)-1]
+	if r.opts["pipefail"] {
+		// The status of the last command to fail
+		for _, status := range statuses {
+			if status != 0 {
+				r.status = status
+			}
+		}
+	}
+}
+
+// redirect applies redirections to the runner's standard streams. The
+// returned function restores them and closes any files opened.
+func (r *Runner) redirect(ctx context.Context, redirs []*syntax.Redirect) (func(), error) {
+	stdin, stdout, stderr := r.Stdin, r.Stdout, r.Stderr
+	var files []*os.File
+	restore := func() {
+		r.Stdin, r.Stdout, r.Stderr = stdin, stdout, stderr
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	for _, rd := range redirs {
+		word := rd.Word
+		if rd.Body != nil {
+			word = rd.Body
+		}
+		target, err := r.literal(ctx, word)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+
+		fd := rd.Fd
+		switch rd.Op {
+		case ">&", "<&":
+			if fd < 0 {
+				fd = 1
+				if rd.Op == "<&" {
+					fd = 0
+				}
+			}
+			if target == "-" {
+				err = r.setFd(fd, nil)
+				break
+			}
+			var src int
+			if _, scanErr := fmt.Sscanf(target, "%d", &src); scanErr != nil || fmt.Sprint(src) != target {
+				if rd.Op == "<&" || rd.Fd >= 0 {
+					err = fmt.Errorf("%s: ambiguous redirect", target)
+					break
+				}
+				// >&file redirects both stdout and stderr
+				var f *os.File
+				if f, err = os.OpenFile(r.absPath(target), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666); err == nil {
+					files = append(files, f)
+					r.Stdout, r.Stderr = f, f
+				}
+				break
+			}
+			var stream any
+			if stream, err = r.getFd(src); err == nil {
+				err = r.setFd(fd, stream)
+			}
+		case "<<", "<<-", "<<<":
+			// The here-document or here-string is the target
+			if fd < 0 {
+				fd = 0
+			}
+			if rd.Op == "<<<" {
+				target += "\n"
+			}
+			var f *os.File
+			if f, err = hereFile(target); err != nil {
+				break
+			}
+			files = append(files, f)
+			err = r.setFd(fd, f)
+		default:
+			flag := os.O_RDONLY
+			switch rd.Op {
+			case ">", ">|", "&>":
+				flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			case ">>", "&>>":
+				flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			case "<>":
+				flag = os.O_RDWR | os.O_CREATE
+			}
+			if fd < 0 {
+				fd = 1
+				if rd.Op == "<" || rd.Op == "<>" {
+					fd = 0
+				}
+			}
+
+			if r.opts["noclobber"] && (rd.Op == ">" || rd.Op == "&>") {
+				if info, statErr := os.Stat(r.absPath(target)); statErr == nil && info.Mode().IsRegular() {
+					err = fmt.Errorf("%s: cannot overwrite existing file", target)
+					break
+				}
+			}
+
+			var f *os.File
+			if f, err = r.openFile(target, flag); err != nil {
+				err = fmt.Errorf("%s: %v", target, errors.Unwrap(err))
+				break
+			}
+			files = append(files, f)
+			if rd.Op == "&>" || rd.Op == "&>>" {
+				r.Stdout, r.Stderr = f, f
+			} else {
+				err = r.setFd(fd, f)
+			}
+		}
+
+		if err != nil {
+			restore()
+			return nil, err
+		}
+	}
+
+	return restore, nil
+}
+
+// hereFile returns a file to read the body of a here-document or
+// here-string from, as bash does. Commands started then share its offset
+// with the read builtin, reading no more of it than they take, where a
+// reader would be copied to them whole.
+func hereFile(body string) (*os.File, error) {
+	f, err := os.CreateTemp("", "sushi-here")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name())
+	if _, err := f.WriteString(body); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// openFile opens a file for a redirection. The /dev/fd paths of process
+// substitutions only name the pipes in the commands the shell starts, so
+// here they're mapped back to the shell's own ends of the pipes.
+func (r *Runner) openFile(path string, flag int) (*os.File, error) {
+	if n, ok := strings.CutPrefix(path, "/dev/fd/"); ok {
+		if fd, err := strconv.Atoi(n); err == nil && fd >= 3 && fd-3 < len(r.procSubsts) {
+			f := r.procSubsts[fd-3].file
+			dup, err := unix.FcntlInt(f.Fd(), unix.F_DUPFD_CLOEXEC, 0)
+			if err != nil {
+				return nil, &os.PathError{Op: "open", Path: path, Err: err}
+			}
+			return os.NewFile(uintptr(dup), path), nil
+		}
+	}
+	return os.OpenFile(r.absPath(path), flag, 0666)
+}
+
+func (r *Runner) getFd(fd int) (any, error) {
+	switch fd {
+	case 0:
+		return r.Stdin, nil
+	case 1:
+		return r.Stdout, nil
+	case 2:
+		return r.Stderr, nil
+	}
+	return nil, fmt.Errorf("%d: bad file descriptor", fd)
+}
+
+// setFd points a standard stream at stream, which is closed if nil.
+func (r *Runner) setFd(fd int, stream any) error {
+	switch fd {
+	case 0:
+		if stream == nil {
+			r.Stdin = nil
+			return nil
+		}
+		if in, ok := stream.(io.Reader); ok {
+			r.Stdin = in
+			return nil
+		}
+	case 1, 2:
+		var out io.Writer = io.Discard
+		if stream != nil {
+			var ok bool
+			if out, ok = stream.(io.Writer); !ok {
+				break
+			}
+		}
+		if fd == 1 {
+			r.Stdout = out
+		} else {
+			r.Stderr = out
+		}
+		return nil
+	}
+	return fmt.Errorf("%d: bad file descriptor", fd)
+}
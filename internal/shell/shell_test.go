@@ -0,0 +1,213 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// buffer is a bytes.Buffer that the stages of a pipeline, and the
+// goroutines copying the output of commands, can write to at once.
+type buffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *buffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+// run runs src in a new runner in dir, returning what it wrote to stdout.
+func run(t *testing.T, dir, src string) (string, *Runner) {
+	t.Helper()
+	f, err := syntax.Parse(src)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", src, err)
+	}
+	var stdout, stderr buffer
+	r := New(dir)
+	r.Stdin = &bytes.Buffer{}
+	r.Stdout = &stdout
+	r.Stderr = &stderr
+	if err := r.Run(context.Background(), f); err != nil && err != ErrExit {
+		t.Fatalf("Run(%q): %v", src, err)
+	}
+	if stderr.Len() > 0 {
+		t.Logf("Run(%q) stderr: %s", src, stderr.String())
+	}
+	return stdout.String(), r
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		src    string
+		want   string
+		status int
+	}{
+		{`echo hello world`, "hello world\n", 0},
+		{`echo 'a  b' "c  d" e\ f`, "a  b c  d e f\n", 0},
+		{`echo a; echo b`, "a\nb\n", 0},
+		{`false && echo no || echo yes`, "yes\n", 0},
+		{`true || echo no`, "", 0},
+		{`false`, "", 1},
+		{`! false`, "", 0},
+		{`echo abc | tr a-c x-z`, "xyz\n", 0},
+		{`printf '%s\n' b a c | sort | head -n 2`, "a\nb\n", 0},
+		{`false | true`, "", 0},
+		{`if false; then echo a; elif true; then echo b; else echo c; fi`, "b\n", 0},
+		{`for i in 1 2 3; do echo $i; done`, "1\n2\n3\n", 0},
+		{`i=0; while [ $i != 3 ]; do i=$(echo $i | tr 012 123); echo $i; done`, "1\n2\n3\n", 0},
+		{`until true; do echo no; done; echo done`, "done\n", 0},
+		{`for i in 1 2 3 4; do if [ $i = 2 ]; then continue; fi; if [ $i = 4 ]; then break; fi; echo $i; done`, "1\n3\n", 0},
+		{`for i in 1 2; do for j in a b; do echo $i$j; continue 2; done; done`, "1a\n2a\n", 0},
+		{`for i in 1 2; do for j in a b; do echo $i$j; break 2; done; done`, "1a\n", 0},
+		{`case foo.go in *.txt) echo text;; *.go|*.c) echo code;; esac`, "code\n", 0},
+		{`case x in y) echo y;; esac`, "", 0},
+		{`a=1; echo $a ${a}b "$a"`, "1 1b 1\n", 0},
+		{`a=1 sh -c 'echo $a'`, "1\n", 0},
+		{`a=1; sh -c 'echo x$a'`, "x\n", 0},
+		{`export a=2; sh -c 'echo $a'`, "2\n", 0},
+		{`a=1; unset a; echo x$a`, "x\n", 0},
+		{`echo $(echo a $(echo b))`, "a b\n", 0},
+		{"echo `echo a`", "a\n", 0},
+		{`echo x > out; cat out; echo y >> out; cat < out`, "x\nx\ny\n", 0},
+		{`cat missing 2>/dev/null || echo failed`, "failed\n", 0},
+		{`cat missing 2>/dev/null; echo $?`, "1\n", 0},
+		{`exit 3`, "", 3},
+	}
+	for _, tt := range tests {
+		got, r := run(t, t.TempDir(), tt.src)
+		if got != tt.want || r.Status() != tt.status {
+			t.Errorf("Run(%q) = %q, status %d; want %q, status %d", tt.src, got, r.Status(), tt.want, tt.status)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.txt", ".hidden.go", "sub/d.go"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`echo *.go`, "a.go b.go\n"},
+		{`echo ?.txt`, "c.txt\n"},
+		{`echo [ab].go`, "a.go b.go\n"},
+		{`echo [!a].go`, "b.go\n"},
+		{`echo */*.go`, "sub/d.go\n"},
+		{`echo .*.go`, ".hidden.go\n"},
+		{`echo *.md`, "*.md\n"},
+		{`echo "*.go" '*.go' \*.go`, "*.go *.go *.go\n"},
+	}
+	for _, tt := range tests {
+		if got, _ := run(t, dir, tt.src); got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCd(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0o755)
+
+	got, r := run(t, dir, `cd sub; pwd; echo $PWD`)
+	sub := filepath.Join(dir, "sub")
+	if want := sub + "\n" + sub + "\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if r.Dir != sub {
+		t.Errorf("Dir = %q, want %q", r.Dir, sub)
+	}
+}
+
+func TestHeredoc(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"x=1; cat <<EOF\nhello $x\n$(echo sub) $((1+2))\nEOF", "hello 1\nsub 3\n"},
+		{"x=1; cat <<'EOF'\nhello $x $(echo sub)\nEOF", "hello $x $(echo sub)\n"},
+		{"x=1; cat <<\"EOF\"\nhello $x\nEOF", "hello $x\n"},
+		{"x=1; cat <<\\EOF\nhello $x\nEOF", "hello $x\n"},
+		{"x=1; cat <<EOF\n\\$x \\\\ \\a \"$x\"\nEOF", "$x \\ \\a \"1\"\n"},
+		{"cat <<-EOF\n\t\tindented\n\t  kept\n\tEOF", "indented\n  kept\n"},
+		{"cat <<EOF\n\tkept\nEOF", "\tkept\n"},
+		{"cat <<EOF\nEOF", ""},
+		{"cat <<A; cat <<B\na\nA\nb\nB", "a\nb\n"},
+		{"cat <<EOF | tr a-z A-Z\nshout\nEOF", "SHOUT\n"},
+		{"while read -r line; do echo \"<$line>\"; done <<EOF\none\ntwo\nEOF", "<one>\n<two>\n"},
+		{"x=1; cat <<<\"a $x\"", "a 1\n"},
+		{"cat <<< word", "word\n"},
+		{"cat <<<''", "\n"},
+		{"tr a-z A-Z <<<'$x'", "$X\n"},
+	}
+	for _, tt := range tests {
+		if got, _ := run(t, t.TempDir(), tt.src); got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestSubshell(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`a=1; (a=2; echo $a); echo $a`, "2\n1\n"},
+		{`(exit 3); echo $?`, "3\n"},
+		{`(echo a; echo b) | tr a-z A-Z`, "A\nB\n"},
+		{`a=1; { a=2; echo $a; }; echo $a`, "2\n2\n"},
+		{`{ echo a; echo b; } > out; cat out`, "a\nb\n"},
+		{`{ echo a; echo b; } | tail -n 1`, "b\n"},
+		{`x=$(cd sub; pwd); cd sub; [ "$x" = "$(pwd)" ] && echo same`, "same\n"},
+		{`printf 'a\nb\n' > x; printf 'a\nc\n' > y; diff <(cat x) <(cat y) >/dev/null; echo $?`, "1\n"},
+		{`diff <(echo a) <(echo a) && echo same`, "same\n"},
+		{`echo hi | tee >(tr a-z A-Z > up) > /dev/null; cat up`, "HI\n"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		os.Mkdir(filepath.Join(dir, "sub"), 0o755)
+		if got, _ := run(t, dir, tt.src); got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestSubshellDir(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0o755)
+
+	got, r := run(t, dir, `(cd sub; pwd); pwd`)
+	if want := filepath.Join(dir, "sub") + "\n" + dir + "\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if r.Dir != dir {
+		t.Errorf("Dir = %q, want %q", r.Dir, dir)
+	}
+}
@@ -0,0 +1,245 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// trapSignals are the signals the trap builtin can handle, besides the
+// EXIT and ERR conditions.
+var trapSignals = []struct {
+	name string
+	sig  syscall.Signal
+}{
+	{"HUP", syscall.SIGHUP},
+	{"INT", syscall.SIGINT},
+	{"TERM", syscall.SIGTERM},
+}
+
+// Signals returns the signals the shell handles, which the caller should
+// pass to Signal.
+func Signals() []os.Signal {
+	var sigs []os.Signal
+	for _, ts := range trapSignals {
+		sigs = append(sigs, ts.sig)
+	}
+	return sigs
+}
+
+// signalName returns the name used by trap for a signal, such as INT.
+func signalName(sig os.Signal) string {
+	for _, ts := range trapSignals {
+		if ts.sig == sig {
+			return ts.name
+		}
+	}
+	return ""
+}
+
+// trapName returns the name of a condition given to trap: EXIT, ERR or a
+// signal, by name with or without the SIG prefix or by number.
+func trapName(spec string) (string, bool) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n == 0 {
+			return "EXIT", true
+		}
+		for _, ts := range trapSignals {
+			if int(ts.sig) == n {
+				return ts.name, true
+			}
+		}
+		return "", false
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+	if name == "EXIT" || name == "ERR" || signalByName(name) != nil {
+		return name, true
+	}
+	return "", false
+}
+
+func signalByName(name string) os.Signal {
+	for _, ts := range trapSignals {
+		if ts.name == name {
+			return ts.sig
+		}
+	}
+	return nil
+}
+
+// Signal records a signal received by the shell. It's safe to call while
+// commands are running, and the signal is handled once the current
+// command is done: by running its trap, or by stopping the shell as the
+// signal would. For the command running to get the signal too, the caller
+// cancels the context given to Run with SignalCause.
+func (r *Runner) Signal(sig os.Signal) {
+	r.sigMu.Lock()
+	defer r.sigMu.Unlock()
+	r.pending = append(r.pending, sig)
+}
+
+// HandleSignals handles the signals received while no commands were
+// running. It returns ErrExit if one of them ends the shell.
+func (r *Runner) HandleSignals(ctx context.Context) error {
+	r.handleSignals(ctx)
+	r.aborted = false
+	if r.exiting {
+		return ErrExit
+	}
+	return nil
+}
+
+func (r *Runner) handleSignals(ctx context.Context) {
+	// The traps run even though the signal cancelled the input
+	ctx = context.WithoutCancel(ctx)
+
+	r.sigMu.Lock()
+	pending := r.pending
+	r.pending = nil
+	r.sigMu.Unlock()
+
+	for _, sig := range pending {
+		name := signalName(sig)
+		if action, ok := r.traps[name]; ok {
+			if action != "" {
+				r.runTrap(ctx, name)
+			}
+			continue
+		}
+
+		// Without a trap, an interactive shell only stops the current
+		// input on INT and ignores TERM
+		switch {
+		case r.Interactive && name == "INT":
+			r.aborted = true
+		case r.Interactive && name == "TERM":
+		default:
+			r.exiting = true
+			r.exitCode = 128 + int(sig.(syscall.Signal))
+		}
+	}
+}
+
+// runTrap runs the action for a trap condition, if one is set. The exit
+// status is kept, so a trap doesn't change $?.
+func (r *Runner) runTrap(ctx context.Context, name string) {
+	action := r.traps[name]
+	if action == "" || r.inTrap {
+		return
+	}
+	prog, err := syntax.Parse(action)
+	if err != nil {
+		r.errorf("trap: %s: %v", name, err)
+		return
+	}
+
+	status, src := r.status, r.src
+	r.inTrap, r.src = true, prog.Src
+	r.stmts(ctx, prog.Stmts)
+	r.inTrap, r.src = false, src
+	if !r.exiting {
+		r.status = status
+	}
+}
+
+// Exit ends the shell. It runs the EXIT trap, sends SIGHUP to the jobs
+// still running and returns the exit status of the shell.
+func (r *Runner) Exit(ctx context.Context) int {
+	code := r.exitTrap(ctx)
+	r.hangUp()
+	return code
+}
+
+// exitTrap runs the EXIT trap as the shell or a subshell exits, and returns
+// its exit status.
+func (r *Runner) exitTrap(ctx context.Context) int {
+	code := r.status
+	if r.exiting {
+		code = r.exitCode
+	}
+
+	// The trap can run commands, including exit to change the status
+	r.exiting = false
+	r.runTrap(ctx, "EXIT")
+	delete(r.traps, "EXIT")
+	if r.exiting {
+		code = r.exitCode
+	}
+	r.exiting, r.exitCode = true, code
+	return code
+}
+
+func builtinTrap(ctx context.Context, r *Runner, args []string) int {
+	args = args[1:]
+	print := false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		switch arg {
+		case "-l":
+			for _, ts := range trapSignals {
+				fmt.Fprintf(r.Stdout, "%2d) SIG%s\n", ts.sig, ts.name)
+			}
+			return 0
+		case "-p":
+			print = true
+		default:
+			r.errorf("trap: %s: invalid option", arg)
+			return 2
+		}
+	}
+
+	if len(args) == 0 || print {
+		names := args
+		if len(names) == 0 {
+			names = []string{"EXIT", "ERR"}
+			for _, ts := range trapSignals {
+				names = append(names, ts.name)
+			}
+		}
+		status := 0
+		for _, spec := range names {
+			name, ok := trapName(spec)
+			if !ok {
+				r.errorf("trap: %s: invalid signal specification", spec)
+				status = 1
+				continue
+			}
+			if action, ok := r.traps[name]; ok {
+				fmt.Fprintf(r.Stdout, "trap -- %s %s\n", quote(action), name)
+			}
+		}
+		return status
+	}
+
+	// With a single argument, or - as the action, the traps are reset
+	action, specs, reset := args[0], args[1:], args[0] == "-"
+	if len(args) == 1 {
+		specs, reset = args, true
+	}
+
+	status := 0
+	for _, spec := range specs {
+		name, ok := trapName(spec)
+		if !ok {
+			r.errorf("trap: %s: invalid signal specification", spec)
+			status = 1
+			continue
+		}
+		if reset {
+			delete(r.traps, name)
+		} else {
+			r.traps[name] = action
+		}
+	}
+	return status
+}
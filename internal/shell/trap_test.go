@@ -0,0 +1,130 @@
+package shell
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// interrupt runs src, sending sig to the shell and the command running
+// after a moment, as the TUI does for Ctrl-C.
+func interrupt(t *testing.T, r *Runner, src string, sig syscall.Signal) (string, error, time.Duration) {
+	t.Helper()
+	f, err := syntax.Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout buffer
+	r.Stdout, r.Stderr = &stdout, &stdout
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(100*time.Millisecond, func() {
+		r.Signal(sig)
+		cancel(SignalCause(sig))
+	})
+	start := time.Now()
+	err = r.Run(ctx, f)
+	return stdout.String(), err, time.Since(start)
+}
+
+func TestInterrupt(t *testing.T) {
+	tests := []struct {
+		src    string
+		sig    syscall.Signal
+		want   string
+		status int
+		exit   bool
+	}{
+		{`sleep 10; echo after`, syscall.SIGINT, "", 128 + 2, false},
+		{`trap 'echo trapped $?' INT; sleep 10; echo after`, syscall.SIGINT, "trapped 130\n", 130, false},
+		{`sh -c 'trap "echo child; exit 3" INT; while :; do sleep 0.05; done'`, syscall.SIGINT, "child\n", 3, false},
+		{`sleep 10`, syscall.SIGHUP, "", 128 + 1, true},
+		{`trap 'echo hup' HUP; sleep 10`, syscall.SIGHUP, "hup\n", 129, false},
+		{`sleep 10`, syscall.SIGTERM, "", 128 + 15, false},
+	}
+	for _, tt := range tests {
+		r := New(t.TempDir())
+		r.Interactive = true
+		got, err, took := interrupt(t, r, tt.src, tt.sig)
+		if took > 5*time.Second {
+			t.Errorf("Run(%q) took %v after %v", tt.src, took, tt.sig)
+		}
+		if got != tt.want || r.Status() != tt.status || (err == ErrExit) != tt.exit {
+			t.Errorf("Run(%q) after %v = %q, status %d, %v; want %q, status %d, exit %v", tt.src, tt.sig, got, r.Status(), err, tt.want, tt.status, tt.exit)
+		}
+	}
+}
+
+func TestInterruptKeepsJobs(t *testing.T) {
+	r := New(t.TempDir())
+	r.Interactive = true
+	interrupt(t, r, `sleep 10 & sleep 10`, syscall.SIGINT)
+	if n := r.runningJobs(); n != 1 {
+		t.Fatalf("%d jobs running after an interrupt, want 1", n)
+	}
+
+	start := time.Now()
+	r.Exit(context.Background())
+	if n := r.runningJobs(); n != 0 || time.Since(start) > 5*time.Second {
+		t.Errorf("%d jobs running after %v of exiting, want 0", n, time.Since(start))
+	}
+}
+
+// runOn runs src in r, returning what it wrote to stdout and stderr.
+func runOn(t *testing.T, r *Runner, src string) (string, string, error) {
+	t.Helper()
+	f, err := syntax.Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr buffer
+	r.Stdout, r.Stderr = &stdout, &stderr
+	err = r.Run(context.Background(), f)
+	return stdout.String(), stderr.String(), err
+}
+
+func TestExitHangsUpJobs(t *testing.T) {
+	dir := t.TempDir()
+	r := New(dir)
+	r.Interactive = true
+	runOn(t, r, `sh -c 'trap "echo hup > hup; exit" HUP; while :; do sleep 0.05; done' &`)
+	time.Sleep(100 * time.Millisecond)
+
+	r.Exit(context.Background())
+	if n := r.runningJobs(); n != 0 {
+		t.Errorf("%d jobs running after exiting, want 0", n)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "hup")); string(data) != "hup\n" {
+		t.Errorf("job didn't get SIGHUP: %q, %v", data, err)
+	}
+}
+
+func TestExitWarnsOfJobs(t *testing.T) {
+	r := New(t.TempDir())
+	r.Interactive = true
+	defer r.Exit(context.Background())
+	runOn(t, r, `sleep 10 &`)
+
+	_, stderr, err := runOn(t, r, `exit`)
+	if err == ErrExit || r.Status() != 1 || !strings.Contains(stderr, "there are running jobs") {
+		t.Errorf("first exit = %v, status %d, %q; want a warning", err, r.Status(), stderr)
+	}
+	if _, _, err := runOn(t, r, `exit`); err != ErrExit {
+		t.Errorf("exit after the warning = %v, want ErrExit", err)
+	}
+}
+
+func TestExitWithoutJobs(t *testing.T) {
+	r := New(t.TempDir())
+	r.Interactive = true
+	runOn(t, r, `sleep 0.01 & wait`)
+	if _, stderr, err := runOn(t, r, `exit 4`); err != ErrExit || r.ExitCode() != 4 || stderr != "" {
+		t.Errorf("exit 4 = %v, code %d, %q; want ErrExit, code 4 and no warning", err, r.ExitCode(), stderr)
+	}
+}
@@ -0,0 +1,411 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+// Variable is a shell variable.
+type Variable struct {
+	Value string
+
+	// Indexed holds the elements of an indexed array, and Assoc those of an
+	// associative array. At most one is set, and Value is unused then.
+	Indexed map[int]string
+	Assoc   map[string]string
+
+	// Exported variables are passed to the environment of commands.
+	Exported bool
+}
+
+func (v *Variable) isArray() bool {
+	return v.Indexed != nil || v.Assoc != nil
+}
+
+// clone returns a copy of v that doesn't share its elements.
+func (v *Variable) clone() *Variable {
+	c := *v
+	if v.Indexed != nil {
+		c.Indexed = make(map[int]string, len(v.Indexed))
+		for i, elem := range v.Indexed {
+			c.Indexed[i] = elem
+		}
+	}
+	if v.Assoc != nil {
+		c.Assoc = make(map[string]string, len(v.Assoc))
+		for k, elem := range v.Assoc {
+			c.Assoc[k] = elem
+		}
+	}
+	return &c
+}
+
+// keys returns the indexes of the elements of v in order. A variable that
+// isn't an array has the single index 0.
+func (v *Variable) keys() []string {
+	switch {
+	case v.Indexed != nil:
+		var keys []string
+		for _, i := range v.indexes() {
+			keys = append(keys, strconv.Itoa(i))
+		}
+		return keys
+	case v.Assoc != nil:
+		var keys []string
+		for k := range v.Assoc {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	return []string{"0"}
+}
+
+// elements returns the values of the elements of v, in the order of keys.
+func (v *Variable) elements() []string {
+	switch {
+	case v.Indexed != nil:
+		var elems []string
+		for _, i := range v.indexes() {
+			elems = append(elems, v.Indexed[i])
+		}
+		return elems
+	case v.Assoc != nil:
+		var elems []string
+		for _, k := range v.keys() {
+			elems = append(elems, v.Assoc[k])
+		}
+		return elems
+	}
+	return []string{v.Value}
+}
+
+// indexes returns the indexes of an indexed array, sorted.
+func (v *Variable) indexes() []int {
+	var indexes []int
+	for i := range v.Indexed {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// nextIndex returns the index after the last element of an indexed array.
+func (v *Variable) nextIndex() int {
+	next := 0
+	for i := range v.Indexed {
+		next = max(next, i+1)
+	}
+	return next
+}
+
+// Var returns the value of a shell variable and whether it's set.
+func (r *Runner) Var(name string) (string, bool) {
+	return r.getVar(name)
+}
+
+// SetVar sets a shell variable, keeping its exported flag if it exists.
+func (r *Runner) SetVar(name, value string) {
+	r.setVar(name, value)
+}
+
+// getVar returns the value of a variable, which is element 0 of an array.
+func (r *Runner) getVar(name string) (string, bool) {
+	v, ok := r.vars[name]
+	switch {
+	case !ok:
+		return "", false
+	case v.Indexed != nil:
+		value, ok := v.Indexed[0]
+		return value, ok
+	case v.Assoc != nil:
+		value, ok := v.Assoc["0"]
+		return value, ok
+	}
+	return v.Value, true
+}
+
+// setVar sets the value of a variable, which is element 0 of an array.
+func (r *Runner) setVar(name, value string) {
+	v, ok := r.vars[name]
+	switch {
+	case !ok:
+		r.vars[name] = &Variable{Value: value}
+	case v.Indexed != nil:
+		v.Indexed[0] = value
+	case v.Assoc != nil:
+		v.Assoc["0"] = value
+	default:
+		v.Value = value
+	}
+}
+
+// element returns an element of an array variable. The index of an indexed
+// array is an arithmetic expression, and counts back from the end if it's
+// negative.
+func (r *Runner) element(name, index string) (string, bool, error) {
+	v, ok := r.vars[name]
+	if ok && v.Assoc != nil {
+		value, ok := v.Assoc[index]
+		return value, ok, nil
+	}
+	n, err := r.arith(index)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	if v.Indexed == nil {
+		return v.Value, n == 0 || n == -1, nil
+	}
+	if n < 0 {
+		n += int64(v.nextIndex())
+	}
+	value, ok := v.Indexed[int(n)]
+	return value, ok, nil
+}
+
+// setElement sets an element of an array variable, turning a variable that
+// isn't an array into an indexed array whose element 0 is its value. With
+// add set, value is appended to the element.
+func (r *Runner) setElement(name, index, value string, add bool) error {
+	v, ok := r.vars[name]
+	if !ok {
+		v = &Variable{Indexed: make(map[int]string)}
+		r.vars[name] = v
+	} else if !v.isArray() {
+		v.Indexed = map[int]string{0: v.Value}
+		v.Value = ""
+	}
+
+	if v.Assoc != nil {
+		if add {
+			value = v.Assoc[index] + value
+		}
+		v.Assoc[index] = value
+		return nil
+	}
+
+	n, err := r.arith(index)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		n += int64(v.nextIndex())
+	}
+	if n < 0 {
+		return fmt.Errorf("%s[%s]: bad array subscript", name, index)
+	}
+	if add {
+		value = v.Indexed[int(n)] + value
+	}
+	v.Indexed[int(n)] = value
+	return nil
+}
+
+// unsetElement removes an element of an array variable.
+func (r *Runner) unsetElement(name, index string) error {
+	v, ok := r.vars[name]
+	switch {
+	case !ok:
+		return nil
+	case v.Assoc != nil:
+		delete(v.Assoc, index)
+		return nil
+	}
+	n, err := r.arith(index)
+	if err != nil {
+		return err
+	}
+	if v.Indexed == nil {
+		if n == 0 || n == -1 {
+			delete(r.vars, name)
+		}
+		return nil
+	}
+	if n < 0 {
+		n += int64(v.nextIndex())
+	}
+	delete(v.Indexed, int(n))
+	return nil
+}
+
+// param returns the value of a parameter, which may be a variable, a
+// positional parameter or a special parameter such as $?.
+func (r *Runner) param(name string) (string, bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(r.status), true
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "#":
+		return strconv.Itoa(len(r.params)), true
+	case "@", "*":
+		return strings.Join(r.params, " "), len(r.params) > 0
+	case "0":
+		return r.Name, true
+	case "-":
+		return r.flags(), true
+	case "!":
+		return "", false
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		if n > 0 && n <= len(r.params) {
+			return r.params[n-1], true
+		}
+		return "", false
+	}
+	return r.getVar(name)
+}
+
+// environ returns the exported variables in the form used by os/exec.
+func (r *Runner) environ() []string {
+	var env []string
+	for name, v := range r.vars {
+		if v.Exported && !v.isArray() {
+			env = append(env, name+"="+v.Value)
+		}
+	}
+	sort.Strings(env)
+	return env
+}
+
+// assign performs an assignment: to a variable, an element of an array or a
+// whole array.
+func (r *Runner) assign(ctx context.Context, as *syntax.Assign) error {
+	if as.Index != nil {
+		index, err := r.literal(ctx, as.Index)
+		if err != nil {
+			return err
+		}
+		value, err := r.assignValue(ctx, as.Value)
+		if err != nil {
+			return err
+		}
+		r.traceAssign(as, fmt.Sprintf("[%s]", index), quote(value))
+		return r.setElement(as.Name, index, value, as.Append)
+	}
+
+	if as.Array == nil {
+		value, err := r.assignValue(ctx, as.Value)
+		if err != nil {
+			return err
+		}
+		r.traceAssign(as, "", quote(value))
+		if as.Append {
+			old, _ := r.getVar(as.Name)
+			value = old + value
+		}
+		r.setVar(as.Name, value)
+		return nil
+	}
+
+	// An associative array stays one, and += keeps the existing elements
+	v, ok := r.vars[as.Name]
+	if !ok {
+		v = &Variable{}
+		r.vars[as.Name] = v
+	}
+	switch {
+	case v.Assoc != nil:
+		if !as.Append {
+			v.Assoc = make(map[string]string)
+		}
+	case v.Indexed != nil && as.Append:
+	case as.Append && ok:
+		v.Indexed = map[int]string{0: v.Value}
+	default:
+		v.Indexed = make(map[int]string)
+	}
+	v.Value = ""
+
+	next := v.nextIndex()
+	var traced []string
+	defer func() { r.traceAssign(as, "", "("+strings.Join(traced, " ")+")") }()
+	for _, elem := range as.Array.Elems {
+		if elem.Index == nil {
+			if v.Assoc != nil {
+				return fmt.Errorf("%s: must use subscript when assigning associative array", as.Name)
+			}
+			values, err := r.fields(ctx, elem.Value)
+			if err != nil {
+				return err
+			}
+			for _, value := range values {
+				v.Indexed[next] = value
+				next++
+				traced = append(traced, quote(value))
+			}
+			continue
+		}
+
+		index, err := r.literal(ctx, elem.Index)
+		if err != nil {
+			return err
+		}
+		value, err := r.assignValue(ctx, elem.Value)
+		if err != nil {
+			return err
+		}
+		traced = append(traced, fmt.Sprintf("[%s]=%s", index, quote(value)))
+		if v.Assoc != nil {
+			v.Assoc[index] = value
+			continue
+		}
+		n, err := r.arith(index)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return fmt.Errorf("%s[%s]: bad array subscript", as.Name, index)
+		}
+		v.Indexed[int(n)] = value
+		next = int(n) + 1
+	}
+	return nil
+}
+
+// trace prints a command about to run with its assignments, for set -x.
+func (r *Runner) trace(assigns, args []string) {
+	if !r.opts["xtrace"] {
+		return
+	}
+	var words []string
+	for _, as := range assigns {
+		name, value, _ := strings.Cut(as, "=")
+		words = append(words, name+"="+quote(value))
+	}
+	for _, arg := range args {
+		words = append(words, quote(arg))
+	}
+	r.traceLine(strings.Join(words, " "))
+}
+
+// traceAssign prints an assignment for set -x, given its index and value
+// as they should be shown.
+func (r *Runner) traceAssign(as *syntax.Assign, index, value string) {
+	if !r.opts["xtrace"] {
+		return
+	}
+	op := "="
+	if as.Append {
+		op = "+="
+	}
+	r.traceLine(as.Name + index + op + value)
+}
+
+func (r *Runner) traceLine(line string) {
+	ps4, ok := r.getVar("PS4")
+	if !ok {
+		ps4 = "+ "
+	}
+	w := r.Trace
+	if w == nil {
+		w = r.Stderr
+	}
+	fmt.Fprintf(w, "%s%s\n", ps4, line)
+}
@@ -0,0 +1,130 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/devenjarvis/sushi/internal/frecency"
+)
+
+// closeScore is how close to the best score another directory has to be for
+// z to let the user choose between them.
+const closeScore = 0.75
+
+// maxPick is the most directories z offers to choose from.
+const maxPick = 5
+
+func builtinZ(ctx context.Context, r *Runner, args []string) int {
+	if r.Dirs == nil {
+		r.errorf("z: no directory history")
+		return 1
+	}
+
+	list := false
+	args = args[1:]
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		switch arg {
+		case "-l":
+			list = true
+		case "-x":
+			// Forget the current directory
+			r.Dirs.Remove(r.Dir)
+			return 0
+		default:
+			r.errorf("z: %s: invalid option", arg)
+			return 2
+		}
+	}
+
+	matches := r.Dirs.Ranked(func(dir string) bool {
+		if !matchFragments(dir, args) {
+			return false
+		}
+		info, err := os.Stat(dir)
+		return err == nil && info.IsDir()
+	})
+	if list || len(args) == 0 {
+		// The best match is listed last, closest to the prompt
+		for i := len(matches) - 1; i >= 0; i-- {
+			fmt.Fprintf(r.Stdout, "%-10.1f %s\n", matches[i].Score, matches[i].Key)
+		}
+		return 0
+	}
+
+	// There's no point jumping to where we are
+	if len(matches) > 0 && matches[0].Key == r.Dir {
+		matches = matches[1:]
+	}
+	if len(matches) == 0 {
+		r.errorf("z: %s: no match", strings.Join(args, " "))
+		return 1
+	}
+
+	dir := matches[0].Key
+	if close := closeMatches(matches); len(close) > 1 && r.Pick != nil {
+		choice, err := r.Pick(ctx, strings.Join(args, " "), close)
+		if err != nil {
+			return 1
+		}
+		dir = choice
+	}
+	r.setDir(dir)
+	return 0
+}
+
+// matchFragments reports whether a directory contains the fragments in
+// order. The match ignores case unless a fragment has upper case letters.
+// Case is folded a rune at a time, so that both forms of the directory keep
+// the same positions.
+func matchFragments(dir string, fragments []string) bool {
+	runes := []rune(dir)
+	folded := make([]rune, len(runes))
+	for i, c := range runes {
+		folded[i] = unicode.ToLower(c)
+	}
+	for _, frag := range fragments {
+		want := []rune(frag)
+		path := runes
+		if strings.ToLower(frag) == frag {
+			path = folded
+		}
+		i := indexRunes(path, want)
+		if i < 0 {
+			return false
+		}
+		runes, folded = runes[i+len(want):], folded[i+len(want):]
+	}
+	return true
+}
+
+// indexRunes returns the index of the first instance of sub in s, or -1.
+func indexRunes(s, sub []rune) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		if slices.Equal(s[i:i+len(sub)], sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+// closeMatches returns the directories that score close to the best one,
+// so that it isn't clear which one is meant.
+func closeMatches(matches []frecency.Scored) []string {
+	var dirs []string
+	for _, m := range matches {
+		if m.Score < matches[0].Score*closeScore || len(dirs) == maxPick {
+			break
+		}
+		dirs = append(dirs, m.Key)
+	}
+	return dirs
+}
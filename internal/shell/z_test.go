@@ -0,0 +1,158 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/devenjarvis/sushi/internal/frecency"
+	"github.com/devenjarvis/sushi/internal/syntax"
+)
+
+func TestMatchFragments(t *testing.T) {
+	tests := []struct {
+		dir       string
+		fragments []string
+		want      bool
+	}{
+		{"/home/me/src/sushi", nil, true},
+		{"/home/me/src/sushi", []string{"sushi"}, true},
+		{"/home/me/src/sushi", []string{"src", "su"}, true},
+		{"/home/me/src/sushi", []string{"su", "src"}, false},
+		{"/home/me/src/sushi", []string{"sushi", "sushi"}, false},
+		// Lower case fragments ignore case, others don't
+		{"/home/me/Src/Sushi", []string{"src", "sushi"}, true},
+		{"/home/me/src/sushi", []string{"Sushi"}, false},
+		{"/home/me/Src/Sushi", []string{"Sushi"}, true},
+		// Folding case mustn't move what's left to match, even where it
+		// changes the length of a letter in bytes
+		{"/K ab ab", []string{"ab", "ab", "ab"}, false},
+		{"/K ab ab", []string{"k", "ab", "ab"}, true},
+		{"/İİab", []string{"a", "b"}, true},
+		{"/İİab", []string{"ab", "b"}, false},
+	}
+	for _, tt := range tests {
+		if got := matchFragments(tt.dir, tt.fragments); got != tt.want {
+			t.Errorf("matchFragments(%q, %q) = %v, want %v", tt.dir, tt.fragments, got, tt.want)
+		}
+	}
+}
+
+// zRunner returns a runner in a directory holding the ones z is given,
+// with the number of times each was visited, the latest now.
+func zRunner(t *testing.T, visits map[string]int) *Runner {
+	t.Helper()
+	root := t.TempDir()
+	r := New(root)
+	r.Dirs = frecency.New()
+	for dir, n := range visits {
+		path := filepath.Join(root, dir)
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			r.Dirs.Add(path, time.Now())
+		}
+	}
+	return r
+}
+
+// runZ runs src with r and returns what it wrote to stdout.
+func runZ(t *testing.T, r *Runner, src string) string {
+	t.Helper()
+	f, err := syntax.Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr buffer
+	r.Stdout, r.Stderr = &stdout, &stderr
+	if err := r.Run(context.Background(), f); err != nil {
+		t.Fatalf("Run(%q): %v", src, err)
+	}
+	return stdout.String()
+}
+
+func TestZ(t *testing.T) {
+	r := zRunner(t, map[string]int{"src/sushi": 10, "src/other": 3, "old/sushi": 1})
+	root := r.Dir
+
+	runZ(t, r, `z sushi`)
+	if want := filepath.Join(root, "src/sushi"); r.Dir != want {
+		t.Errorf("z sushi went to %q, want %q", r.Dir, want)
+	}
+	// Not where we already are
+	runZ(t, r, `z sushi`)
+	if want := filepath.Join(root, "old/sushi"); r.Dir != want {
+		t.Errorf("second z sushi went to %q, want %q", r.Dir, want)
+	}
+	runZ(t, r, `z src oth`)
+	if want := filepath.Join(root, "src/other"); r.Dir != want {
+		t.Errorf("z src oth went to %q, want %q", r.Dir, want)
+	}
+
+	if got := runZ(t, r, `z nothing; echo $?`); got != "1\n" {
+		t.Errorf("z without a match = %q, want status 1", got)
+	}
+
+	// Directories that are gone aren't jumped to
+	os.RemoveAll(filepath.Join(root, "src/sushi"))
+	runZ(t, r, `cd /; z sushi`)
+	if want := filepath.Join(root, "old/sushi"); r.Dir != want {
+		t.Errorf("z sushi with the best match gone went to %q, want %q", r.Dir, want)
+	}
+}
+
+func TestZList(t *testing.T) {
+	r := zRunner(t, map[string]int{"a": 2, "b": 1, "c": 3})
+	root := r.Dir
+
+	// The best match is listed last
+	want := "4.0        " + filepath.Join(root, "b") + "\n" +
+		"8.0        " + filepath.Join(root, "a") + "\n"
+	if got, want := runZ(t, r, `z -l /b`), "4.0        "+filepath.Join(root, "b")+"\n"; got != want {
+		t.Errorf("z -l /b = %q, want %q", got, want)
+	}
+	r.Dirs.Remove(filepath.Join(root, "c"))
+	if got := runZ(t, r, `z -l`); got != want {
+		t.Errorf("z -l = %q, want %q", got, want)
+	}
+
+	runZ(t, r, `cd a; z -x`)
+	if got := r.Dirs.Score(filepath.Join(root, "a")); got != 0 {
+		t.Errorf("z -x left the current directory with score %v", got)
+	}
+}
+
+func TestZPick(t *testing.T) {
+	r := zRunner(t, map[string]int{"x/proj": 4, "y/proj": 4, "z/proj": 1})
+	root := r.Dir
+
+	var query string
+	var choices []string
+	r.Pick = func(ctx context.Context, q string, c []string) (string, error) {
+		query, choices = q, c
+		return c[1], nil
+	}
+	// Those scoring close to the best are offered to choose from
+	runZ(t, r, `z proj`)
+	want := []string{filepath.Join(root, "x/proj"), filepath.Join(root, "y/proj")}
+	if query != "proj" || !reflect.DeepEqual(choices, want) {
+		t.Errorf("Pick(%q, %q), want Pick(proj, %q)", query, choices, want)
+	}
+	if r.Dir != want[1] {
+		t.Errorf("z went to %q, want the choice %q", r.Dir, want[1])
+	}
+
+	// Not choosing stays
+	r.Pick = func(context.Context, string, []string) (string, error) {
+		return "", errors.New("canceled")
+	}
+	runZ(t, r, `cd /; z proj`)
+	if r.Dir != "/" {
+		t.Errorf("z went to %q without a choice", r.Dir)
+	}
+}
@@ -0,0 +1,290 @@
+// Package spec completes the arguments of commands described by spec files:
+// their subcommands, flags and the values of their arguments.
+package spec
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/devenjarvis/sushi/internal/hint"
+)
+
+// The specs shipped with sushi, which spec files of the same name replace
+//
+//go:embed specs/*.json
+var shipped embed.FS
+
+// How long the values printed by a command stay cached, and how long the
+// command can take
+const (
+	valuesTTL     = 10 * time.Second
+	valuesTimeout = 3 * time.Second
+)
+
+// Spec describes a command, or one of its subcommands.
+type Spec struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Subcommands []*Spec `json:"subcommands,omitempty"`
+	Flags       []Flag  `json:"flags,omitempty"`
+
+	// Args are the positional arguments, after the subcommands. The last
+	// is repeated if variadic.
+	Args []Arg `json:"args,omitempty"`
+}
+
+// Flag is an option of a command, under one or more names, such as -v and
+// --verbose.
+type Flag struct {
+	Names       []string `json:"names"`
+	Description string   `json:"description,omitempty"`
+
+	// Arg is the value the flag takes, if any, as the next argument or
+	// after = in --name=value
+	Arg *Arg `json:"arg,omitempty"`
+}
+
+// Arg is an argument of a command or a flag.
+type Arg struct {
+	Name string `json:"name,omitempty"`
+
+	// Type is "file" or "dir" for paths, which are completed as any other
+	// argument, "enum" for one of Values, or "command" for a line printed by
+	// Command, which is run by sh in the directory completed in. Values of
+	// other types, such as "string", aren't completed here, though other
+	// providers may look them up with ArgType: git's completes "branch",
+	// "tag", "ref", "remote", "stash" and "changed".
+	Type     string   `json:"type"`
+	Values   []string `json:"values,omitempty"`
+	Command  string   `json:"command,omitempty"`
+	Variadic bool     `json:"variadic,omitempty"`
+}
+
+// Provider completes the arguments of the commands it has specs for.
+type Provider struct {
+	specs map[string]*Spec
+
+	// values holds the lines printed by the commands of arguments, by the
+	// directory they ran in
+	values *hint.Cache[[]string]
+}
+
+// Load returns a provider for the specs shipped with sushi and the spec
+// files in dir, which don't have to exist. Files that can't be read are
+// reported in the error, with the provider still using the others.
+func Load(dir string) (*Provider, error) {
+	p := &Provider{specs: make(map[string]*Spec), values: hint.NewCache[[]string](valuesTTL, valuesTimeout)}
+
+	var errs []error
+	files, _ := fs.Glob(shipped, "specs/*.json")
+	for _, file := range files {
+		if err := p.load(shipped, file); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	files, _ = filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, file := range files {
+		if err := p.load(os.DirFS(dir), filepath.Base(file)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+		}
+	}
+	return p, errors.Join(errs...)
+}
+
+func (p *Provider) load(fsys fs.FS, file string) error {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return err
+	}
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return err
+	}
+	if spec.Name == "" {
+		return errors.New("spec has no name")
+	}
+	p.specs[spec.Name] = &spec
+	return nil
+}
+
+// Has reports whether there's a spec for a command.
+func (p *Provider) Has(name string) bool {
+	return p.specs[name] != nil
+}
+
+// Complete offers the subcommands, flags and argument values of the command
+// the line is an argument of.
+func (p *Provider) Complete(ctx context.Context, line hint.Line) []hint.Candidate {
+	node, positional, pending, dashes, ok := p.find(line)
+	if !ok {
+		return nil
+	}
+
+	typed := line.Typed
+	switch {
+	case pending != nil:
+		return p.argValues(ctx, line, *pending, "", typed)
+	case strings.HasPrefix(typed, "-") && !dashes:
+		if name, value, ok := strings.Cut(typed, "="); ok {
+			if f := node.flag(name); f != nil && f.Arg != nil {
+				return p.argValues(ctx, line, *f.Arg, name+"=", value)
+			}
+			return nil
+		}
+		return node.flagCandidates(typed)
+	}
+
+	var candidates []hint.Candidate
+	if positional == 0 {
+		for _, sub := range node.Subcommands {
+			if score, ok := hint.Match(typed, sub.Name); ok {
+				candidates = append(candidates, hint.Candidate{Text: sub.Name, Description: sub.Description, Kind: hint.KindSubcommand, Score: score + hint.ProviderBonus})
+			}
+		}
+	}
+	if arg, ok := node.arg(positional); ok {
+		candidates = append(candidates, p.argValues(ctx, line, arg, "", typed)...)
+	}
+	return candidates
+}
+
+// ArgType returns the type of the argument the word completed is, of a
+// flag or positional, or "" if its command has no spec or it isn't one.
+// Flags typed with their value, as in --name=value, aren't looked at.
+func (p *Provider) ArgType(line hint.Line) string {
+	node, positional, pending, dashes, ok := p.find(line)
+	switch {
+	case !ok:
+		return ""
+	case pending != nil:
+		return pending.Type
+	case strings.HasPrefix(line.Typed, "-") && !dashes:
+		return ""
+	}
+	arg, _ := node.arg(positional)
+	return arg.Type
+}
+
+// find returns the subcommand the word completed is in, and how many
+// positional arguments come before it, or the argument of the flag before
+// it if it's that flag's value. dashes is set after a --.
+func (p *Provider) find(line hint.Line) (node *Spec, positional int, pending *Arg, dashes, ok bool) {
+	if len(line.Args) == 0 {
+		return nil, 0, nil, false, false
+	}
+	node = p.specs[filepath.Base(line.Args[0])]
+	if node == nil {
+		return nil, 0, nil, false, false
+	}
+	for _, arg := range line.Args[1:] {
+		switch {
+		case pending != nil:
+			pending = nil
+		case arg == "--" && !dashes:
+			dashes = true
+		case strings.HasPrefix(arg, "-") && !dashes:
+			name, _, hasValue := strings.Cut(arg, "=")
+			if f := node.flag(name); f != nil && f.Arg != nil && !hasValue {
+				pending = f.Arg
+			}
+		case positional == 0 && node.subcommand(arg) != nil:
+			node = node.subcommand(arg)
+		default:
+			positional++
+		}
+	}
+	return node, positional, pending, dashes, true
+}
+
+func (s *Spec) subcommand(name string) *Spec {
+	for _, sub := range s.Subcommands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+func (s *Spec) flag(name string) *Flag {
+	for i, f := range s.Flags {
+		for _, n := range f.Names {
+			if n == name {
+				return &s.Flags[i]
+			}
+		}
+	}
+	return nil
+}
+
+// arg returns the positional argument at index i.
+func (s *Spec) arg(i int) (Arg, bool) {
+	switch {
+	case i < len(s.Args):
+		return s.Args[i], true
+	case len(s.Args) > 0 && s.Args[len(s.Args)-1].Variadic:
+		return s.Args[len(s.Args)-1], true
+	}
+	return Arg{}, false
+}
+
+func (s *Spec) flagCandidates(typed string) []hint.Candidate {
+	var candidates []hint.Candidate
+	for _, f := range s.Flags {
+		for _, name := range f.Names {
+			if score, ok := hint.Match(typed, name); ok {
+				candidates = append(candidates, hint.Candidate{Text: name, Description: f.Description, Kind: hint.KindFlag, Score: score + hint.ProviderBonus})
+			}
+		}
+	}
+	return candidates
+}
+
+// argValues returns the values an argument can take that match what's
+// typed, replacing the word with them after prefix. Paths are left to be
+// completed as for any argument.
+func (p *Provider) argValues(ctx context.Context, line hint.Line, arg Arg, prefix, typed string) []hint.Candidate {
+	var values []string
+	switch arg.Type {
+	case "enum":
+		values = arg.Values
+	case "command":
+		values = p.commandValues(ctx, arg.Command, line.Dir)
+	}
+
+	var candidates []hint.Candidate
+	for _, value := range values {
+		if score, ok := hint.Match(typed, value); ok {
+			candidates = append(candidates, hint.Candidate{Text: value, Value: prefix + value, Description: arg.Name, Kind: hint.KindValue, Score: score + hint.ProviderBonus})
+		}
+	}
+	return candidates
+}
+
+// commandValues returns the lines printed by a command run in dir, which
+// are kept for a while so it doesn't run again for every letter typed.
+func (p *Provider) commandValues(ctx context.Context, command, dir string) []string {
+	return p.values.Get(ctx, dir+"\x00"+command, 0, func(ctx context.Context) ([]string, error) {
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		var values []string
+		for _, value := range strings.Split(string(out), "\n") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		return values, nil
+	})
+}
@@ -0,0 +1,38 @@
+package spec
+
+import (
+	"testing"
+
+	"github.com/devenjarvis/sushi/internal/hint"
+)
+
+func TestArgType(t *testing.T) {
+	p, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args  []string
+		typed string
+		want  string
+	}{
+		{[]string{"git"}, "", ""},
+		{[]string{"git", "switch"}, "ma", "branch"},
+		{[]string{"git", "-C", "/tmp", "checkout"}, "", "ref"},
+		{[]string{"git", "push"}, "", "remote"},
+		{[]string{"git", "push", "origin"}, "", "branch"},
+		{[]string{"git", "rebase", "--onto"}, "", "ref"},
+		{[]string{"git", "rebase"}, "--on", ""},
+		{[]string{"git", "add", "a.go"}, "", "changed"},
+		{[]string{"git", "commit", "-m"}, "", "string"},
+		{[]string{"git", "stash", "drop"}, "", "stash"},
+		{[]string{"git", "remote", "prune"}, "", "remote"},
+		{[]string{"git", "status"}, "", ""},
+		{[]string{"nospec"}, "", ""},
+	}
+	for _, tt := range tests {
+		if got := p.ArgType(hint.Line{Args: tt.args, Typed: tt.typed}); got != tt.want {
+			t.Errorf("ArgType(%q, %q) = %q, want %q", tt.args, tt.typed, got, tt.want)
+		}
+	}
+}
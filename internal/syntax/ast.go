@@ -0,0 +1,166 @@
+package syntax
+
+// File is a parsed program.
+type File struct {
+	Stmts []*Stmt
+
+	// Src is the source the program was parsed from, which positions refer
+	// to.
+	Src string
+}
+
+// Stmt is a command together with its redirections, as it appears in a list
+// of commands.
+type Stmt struct {
+	Pos, End int
+	Cmd      Command
+	Redirs   []*Redirect
+
+	// Negated is set for a command preceded by !.
+	Negated bool
+
+	// Background is set for a command terminated by &.
+	Background bool
+}
+
+// Command is one of *CallExpr, *DeclClause, *BinaryCmd, *Subshell, *Block,
+// *IfClause, *WhileClause, *ForClause or *CaseClause.
+type Command interface {
+	command()
+}
+
+// Word is a shell word made of literal text, quotes and expansions.
+type Word struct {
+	Pos, End int
+	Parts    []WordPart
+}
+
+// Literal returns the value of the word with quotes removed, and whether the
+// word consists only of literal text.
+func (w *Word) Literal() (string, bool) {
+	return literal(w.Parts)
+}
+
+// Assign is a variable assignment: name=value, name+=value, name[index]=value
+// or name=(array elements).
+type Assign struct {
+	Pos, End int
+	Name     string
+
+	// Index is the subscript of an array element, or nil.
+	Index *Word
+
+	// Append is set for +=.
+	Append bool
+
+	// Value is the value assigned, which is empty when Array is set.
+	Value *Word
+	Array *ArrayExpr
+
+	// Naked is set for an argument of a declaration command that isn't an
+	// assignment, such as a name or an option. It's held in Value.
+	Naked bool
+}
+
+// ArrayExpr is the list of elements in an array assignment.
+type ArrayExpr struct {
+	Pos, End int
+	Elems    []*ArrayElem
+}
+
+// ArrayElem is an element of an array assignment, optionally with its index
+// as in [index]=value.
+type ArrayElem struct {
+	Index *Word
+	Value *Word
+}
+
+// Redirect is a redirection such as >file, 2>&1 or <<EOF.
+type Redirect struct {
+	Pos, End int
+	Op       string
+	// Fd is the file descriptor given before the operator, or -1.
+	Fd   int
+	Word *Word
+
+	// Body is the body of a here-document, for << and <<-. Word is then
+	// the delimiter.
+	Body *Word
+}
+
+// CallExpr is a simple command: assignments followed by words.
+type CallExpr struct {
+	Assigns []*Assign
+	Args    []*Word
+}
+
+// BinaryCmd joins two statements with &&, ||, | or |&.
+type BinaryCmd struct {
+	Op   string
+	X, Y *Stmt
+}
+
+// IfClause is an if statement. Elif clauses are represented as an IfClause
+// in Else.
+type IfClause struct {
+	Cond []*Stmt
+	Then []*Stmt
+	Else []*Stmt
+}
+
+// WhileClause is a while or until loop.
+type WhileClause struct {
+	Until bool
+	Cond  []*Stmt
+	Do    []*Stmt
+}
+
+// ForClause is a for loop over Items, or over the positional parameters if
+// there was no in clause.
+type ForClause struct {
+	Name  string
+	HasIn bool
+	Items []*Word
+	Do    []*Stmt
+}
+
+// CaseClause is a case statement.
+type CaseClause struct {
+	Word  *Word
+	Items []*CaseItem
+}
+
+// CaseItem is one pattern list of a case statement and its commands.
+type CaseItem struct {
+	Patterns []*Word
+	Stmts    []*Stmt
+}
+
+// DeclClause is a declaration command such as declare, whose arguments may
+// be assignments.
+type DeclClause struct {
+	Variant string
+	Args    []*Assign
+}
+
+// Subshell is a list of commands in parentheses, run in a copy of the
+// shell's state.
+type Subshell struct {
+	Stmts []*Stmt
+}
+
+// Block is a list of commands grouped with braces, run in the current
+// shell.
+type Block struct {
+	Stmts []*Stmt
+}
+
+func (*CallExpr) command()    {}
+func (*BinaryCmd) command()   {}
+func (*IfClause) command()    {}
+func (*WhileClause) command() {}
+func (*ForClause) command()   {}
+func (*CaseClause) command()  {}
+func (*Subshell) command()    {}
+func (*DeclClause) command()  {}
+func (*Block) command()       {}
@@ -0,0 +1,313 @@
+package syntax
+
+import "strings"
+
+// Class is the highlighting class of a span of source.
+type Class int
+
+const (
+	ClassPlain Class = iota
+	ClassCommand
+	ClassKeyword
+	ClassArgument
+	ClassAssignment
+	ClassString
+	ClassVariable
+	ClassOperator
+	ClassRedirect
+	ClassComment
+)
+
+// Span is a highlighted range of source, [Pos, End).
+type Span struct {
+	Pos, End int
+	Class    Class
+
+	// Word is the unquoted value of a command or argument word, if it's made
+	// only of literal text. It's empty otherwise.
+	Word string
+}
+
+// Highlight returns the highlighting spans for src, in source order. Spans
+// for the parts of a word (strings, variables) follow the span of the word
+// itself and take precedence over it. Partial input is highlighted as far as
+// it can be lexed.
+func Highlight(src string) []Span {
+	toks, _ := Lex(src)
+	var h highlighter
+	h.tokens(toks)
+	return h.spans
+}
+
+type highlighter struct {
+	spans []Span
+}
+
+const (
+	stateCommand  = iota // expecting a command
+	stateArgs            // in the arguments of a command
+	stateForName         // after for, expecting the loop variable
+	stateForIn           // after the loop variable, expecting in
+	stateCaseWord        // after case, expecting the subject
+	stateCaseIn          // after the case subject, expecting in
+	statePattern         // expecting a case pattern
+	stateArray           // in the elements of an array assignment
+)
+
+func (h *highlighter) add(pos, end int, class Class, word string) {
+	h.spans = append(h.spans, Span{Pos: pos, End: end, Class: class, Word: word})
+}
+
+func (h *highlighter) tokens(toks []Token) {
+	state := stateCommand
+	redirTarget := false
+	cases := 0 // open case statements
+
+	// The end of a word ending in =, which starts an array assignment if
+	// a ( follows it directly
+	assignEnd := -1
+
+	for _, tok := range toks {
+		switch tok.Kind {
+		case COMMENT:
+			h.add(tok.Pos, tok.End, ClassComment, "")
+		case HEREDOC:
+			h.add(tok.Pos, tok.End, ClassString, "")
+			h.parts(tok.Parts)
+		case NEWLINE:
+			if state != statePattern && state != stateArray {
+				state = stateCommand
+			}
+		case REDIRECT:
+			h.add(tok.Pos, tok.End, ClassRedirect, "")
+			redirTarget = true
+		case OPERATOR:
+			h.add(tok.Pos, tok.End, ClassOperator, "")
+			switch tok.Text {
+			case ")":
+				if state == statePattern || state == stateArray {
+					state = stateCommand
+				} else {
+					state = stateArgs
+				}
+			case ";;":
+				state = statePattern
+			case "|":
+				if state != statePattern {
+					state = stateCommand
+				}
+			case "(":
+				if tok.Pos == assignEnd {
+					state = stateArray
+				} else if state != statePattern {
+					state = stateCommand
+				}
+			default:
+				state = stateCommand
+			}
+		case WORD:
+			value, literal := tok.Literal()
+			quoted := tok.Quoted()
+			isKeyword := literal && !quoted && keywords[value]
+			if strings.HasSuffix(tok.Text, "=") {
+				assignEnd = tok.End
+			}
+
+			switch {
+			case redirTarget:
+				redirTarget = false
+				h.word(tok, ClassArgument, value, literal)
+			case state == stateCommand && isKeyword:
+				h.add(tok.Pos, tok.End, ClassKeyword, "")
+				switch value {
+				case "for", "select":
+					state = stateForName
+				case "case":
+					state = stateCaseWord
+					cases++
+				case "esac":
+					cases--
+					state = stateArgs
+				case "fi", "done", "}":
+					state = stateArgs
+				}
+			case state == stateCommand && isAssignment(tok):
+				eq := strings.IndexRune(tok.Text, '=')
+				h.add(tok.Pos, tok.Pos+eq+1, ClassAssignment, "")
+				h.parts(tok.Parts)
+			case state == stateCommand:
+				h.word(tok, ClassCommand, value, literal)
+				state = stateArgs
+			case state == stateForName:
+				h.add(tok.Pos, tok.End, ClassVariable, "")
+				state = stateForIn
+			case state == stateForIn && isKeyword && value == "in":
+				h.add(tok.Pos, tok.End, ClassKeyword, "")
+				state = stateArgs
+			case state == stateCaseWord:
+				h.word(tok, ClassArgument, value, literal)
+				state = stateCaseIn
+			case state == stateCaseIn && isKeyword && value == "in":
+				h.add(tok.Pos, tok.End, ClassKeyword, "")
+				state = statePattern
+			case state == statePattern && cases > 0 && isKeyword && value == "esac":
+				h.add(tok.Pos, tok.End, ClassKeyword, "")
+				cases--
+				state = stateArgs
+			default:
+				h.word(tok, ClassArgument, value, literal)
+			}
+		}
+	}
+}
+
+// word adds the span of a whole word followed by the spans of its parts.
+func (h *highlighter) word(tok Token, class Class, value string, literal bool) {
+	if !literal {
+		value = ""
+	}
+	h.add(tok.Pos, tok.End, class, value)
+	h.parts(tok.Parts)
+}
+
+func (h *highlighter) parts(parts []WordPart) {
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *SglQuoted:
+			h.add(p.Pos, p.End, ClassString, "")
+		case *DblQuoted:
+			h.add(p.Pos, p.End, ClassString, "")
+			h.parts(p.Parts)
+		case *ParamExp:
+			h.add(p.Pos, p.End, ClassVariable, "")
+			h.parts(p.Index)
+			h.parts(p.Arg)
+			h.parts(p.Repl)
+		case *ArithExp:
+			h.add(p.Pos, p.End, ClassVariable, "")
+			h.parts(p.Parts)
+		case *CmdSubst:
+			h.add(p.Pos, p.End, ClassOperator, "")
+			inner := highlighter{}
+			inner.tokens(p.Tokens)
+			h.spans = append(h.spans, inner.spans...)
+		case *ProcSubst:
+			h.add(p.Pos, p.End, ClassOperator, "")
+			inner := highlighter{}
+			inner.tokens(p.Tokens)
+			h.spans = append(h.spans, inner.spans...)
+		}
+	}
+}
+
+// isAssignment reports whether a word has the form name=value.
+func isAssignment(tok Token) bool {
+	return splitAssign(tok) != nil
+}
+
+// WordAt returns the span of the command or argument word being typed at
+// rune offset pos of src, cut at pos, for completion. Words in command
+// substitutions are found too. If no word ends at pos, the span is empty,
+// with the class a word started at pos would have.
+func WordAt(src string, pos int) Span {
+	runes := []rune(src)
+	pos = max(0, min(pos, len(runes)))
+	before := string(runes[:pos])
+
+	// The innermost word comes last
+	word, found := Span{}, false
+	for _, span := range Highlight(before) {
+		switch span.Class {
+		case ClassCommand, ClassArgument, ClassKeyword:
+			if span.End == pos {
+				word, found = span, true
+			}
+		}
+	}
+	if found {
+		return word
+	}
+
+	// Any letter put at pos starts a word with the class wanted
+	for _, span := range Highlight(before + "x") {
+		if span.Pos == pos && span.End == pos+1 {
+			return Span{Pos: pos, End: pos, Class: span.Class}
+		}
+	}
+	return Span{Pos: pos, End: pos, Class: ClassPlain}
+}
+
+// CommandArgs returns the words of the simple command being typed at rune
+// offset pos of src, from the command name to the word before the one at
+// pos, with quotes removed. Words that aren't only literal text are empty,
+// and redirections are left out.
+func CommandArgs(src string, pos int) []string {
+	runes := []rune(src)
+	pos = max(0, min(pos, len(runes)))
+	word := WordAt(src, pos)
+
+	var args []string
+	skipTo, redirTarget := 0, false
+	for _, span := range Highlight(string(runes[:word.Pos])) {
+		if span.Pos < skipTo {
+			continue
+		}
+		switch span.Class {
+		case ClassOperator:
+			op := string(runes[span.Pos:span.End])
+			if isSubst(op) && !strings.HasSuffix(op, ")") && !strings.HasSuffix(op[1:], "`") {
+				// The command is in the substitution still open
+				args = nil
+			} else if isSubst(op) {
+				// A substitution in a word of the command
+				skipTo = span.End
+			} else {
+				args = nil
+			}
+		case ClassRedirect:
+			redirTarget = true
+		case ClassKeyword:
+			args = nil
+		case ClassCommand:
+			args = []string{span.Word}
+		case ClassArgument:
+			if redirTarget {
+				redirTarget = false
+				continue
+			}
+			args = append(args, span.Word)
+		}
+	}
+	return args
+}
+
+// isSubst reports whether the text of an operator span is a command or
+// process substitution.
+func isSubst(op string) bool {
+	return strings.HasPrefix(op, "$(") || strings.HasPrefix(op, "`") || strings.HasPrefix(op, "<(") || strings.HasPrefix(op, ">(")
+}
+
+// Commands returns the words of the simple commands in src, including
+// those in substitutions, with quotes removed. Words that aren't only
+// literal text are empty, and redirections are left out.
+func Commands(src string) [][]string {
+	var commands [][]string
+	redirTarget := false
+	for _, span := range Highlight(src) {
+		switch span.Class {
+		case ClassOperator, ClassKeyword:
+			redirTarget = false
+		case ClassRedirect:
+			redirTarget = true
+		case ClassCommand:
+			commands = append(commands, []string{span.Word})
+		case ClassArgument:
+			if redirTarget {
+				redirTarget = false
+			} else if len(commands) > 0 {
+				commands[len(commands)-1] = append(commands[len(commands)-1], span.Word)
+			}
+		}
+	}
+	return commands
+}
@@ -0,0 +1,830 @@
+// Package syntax implements the lexer and parser for the shell language
+// understood by sushi.
+//
+// All positions are rune offsets into the source, which is what the prompt
+// component works with.
+package syntax
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TokenKind identifies the kind of a lexical token.
+type TokenKind int
+
+const (
+	EOF TokenKind = iota
+	WORD
+	OPERATOR // control operators such as |, &&, ; and (
+	REDIRECT // redirection operators such as >, >> and <
+	NEWLINE
+	COMMENT
+	HEREDOC // the body of a here-document, after the newline ending its line
+)
+
+// Token is a lexical token of the shell language.
+type Token struct {
+	Kind TokenKind
+
+	// Pos and End delimit the token in the source, [Pos, End).
+	Pos int
+	End int
+
+	// Text is the raw source text of the token. For a REDIRECT it is only
+	// the operator, without any file descriptor.
+	Text string
+
+	// Fd is the file descriptor a REDIRECT applies to, as in 2>, or -1 if
+	// none was given.
+	Fd int
+
+	// Parts holds the parts of a WORD or HEREDOC.
+	Parts []WordPart
+}
+
+// Literal returns the value of the word with quotes removed, and whether the
+// word consists only of literal text (no expansions).
+func (t Token) Literal() (string, bool) {
+	return literal(t.Parts)
+}
+
+// Quoted reports whether any part of the word is quoted or escaped.
+func (t Token) Quoted() bool {
+	for _, part := range t.Parts {
+		switch p := part.(type) {
+		case *Lit:
+			if p.Quoted {
+				return true
+			}
+		case *SglQuoted, *DblQuoted:
+			return true
+		}
+	}
+	return false
+}
+
+func literal(parts []WordPart) (string, bool) {
+	var b strings.Builder
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *Lit:
+			b.WriteString(p.Value)
+		case *SglQuoted:
+			b.WriteString(p.Value)
+		case *DblQuoted:
+			s, ok := literal(p.Parts)
+			if !ok {
+				return "", false
+			}
+			b.WriteString(s)
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// WordPart is a piece of a word: literal text, a quoted string or an
+// expansion.
+type WordPart interface {
+	Span() (int, int)
+}
+
+// Lit is literal text. Quoted is set for text that was escaped with a
+// backslash, or appears inside double quotes, so that it is not subject to
+// globbing.
+type Lit struct {
+	Pos, End int
+	Value    string
+	Quoted   bool
+}
+
+// SglQuoted is a single-quoted string.
+type SglQuoted struct {
+	Pos, End int
+	Value    string
+}
+
+// DblQuoted is a double-quoted string, which may contain expansions.
+type DblQuoted struct {
+	Pos, End int
+	Parts    []WordPart
+}
+
+// ParamExp is a parameter expansion such as $HOME, ${HOME}, ${#HOME},
+// ${arr[1]} or ${HOME%/*}.
+type ParamExp struct {
+	Pos, End int
+	Name     string
+	// Short is set for the $name form without braces.
+	Short bool
+
+	// Length is set for ${#name}, and Indirect for ${!name}, which also
+	// gives the indexes of an array as ${!name[@]}.
+	Length   bool
+	Indirect bool
+
+	// Index holds the subscript of ${name[index]}, or nil if there is none.
+	Index []WordPart
+
+	// Op is the operator of an expansion such as ${name:-word},
+	// ${name#pattern} or ${name:offset}, or "" if there is none. Arg holds
+	// the word after it. Repl holds the replacement of ${name/pattern/repl}
+	// or the length of ${name:offset:length}, and HasRepl tells whether it
+	// was given.
+	Op      string
+	Arg     []WordPart
+	Repl    []WordPart
+	HasRepl bool
+}
+
+// CmdSubst is a command substitution, $(...) or `...`. Tokens holds the
+// tokens of the inner program, and Stmts its commands once parsed.
+type CmdSubst struct {
+	Pos, End  int
+	Tokens    []Token
+	Stmts     []*Stmt
+	Backquote bool
+}
+
+// ProcSubst is a process substitution, <(...) or >(...). Op is "<" or ">".
+type ProcSubst struct {
+	Pos, End int
+	Op       string
+	Tokens   []Token
+	Stmts    []*Stmt
+}
+
+// ArithExp is an arithmetic expansion, $((...)). The expression is kept as
+// word parts, as it's only parsed once its own expansions are done.
+type ArithExp struct {
+	Pos, End int
+	Parts    []WordPart
+}
+
+func (p *Lit) Span() (int, int)       { return p.Pos, p.End }
+func (p *SglQuoted) Span() (int, int) { return p.Pos, p.End }
+func (p *DblQuoted) Span() (int, int) { return p.Pos, p.End }
+func (p *ParamExp) Span() (int, int)  { return p.Pos, p.End }
+func (p *CmdSubst) Span() (int, int)  { return p.Pos, p.End }
+func (p *ArithExp) Span() (int, int)  { return p.Pos, p.End }
+func (p *ProcSubst) Span() (int, int) { return p.Pos, p.End }
+
+// Error is a syntax error at a position in the input.
+type Error struct {
+	Pos int
+	Msg string
+
+	// Incomplete reports whether the input may become valid by adding more
+	// text, as with an unterminated quote.
+	Incomplete bool
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// Lex splits src into tokens. Lexing continues past errors where it can so
+// that the result is useful for highlighting partial input; the first error
+// found is returned along with the tokens.
+func Lex(src string) ([]Token, error) {
+	l := &lexer{src: []rune(src)}
+	toks, _ := l.tokens(false)
+	if l.err != nil {
+		return toks, l.err
+	}
+	return toks, nil
+}
+
+type lexer struct {
+	src []rune
+	pos int
+	err *Error
+}
+
+func (l *lexer) errorf(pos int, incomplete bool, msg string) {
+	if l.err == nil {
+		l.err = &Error{Pos: pos, Msg: msg, Incomplete: incomplete}
+	}
+}
+
+func (l *lexer) peek(n int) rune {
+	if l.pos+n < len(l.src) {
+		return l.src[l.pos+n]
+	}
+	return 0
+}
+
+func isBlank(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+func isMeta(r rune) bool {
+	switch r {
+	case '|', '&', ';', '(', ')', '<', '>':
+		return true
+	}
+	return false
+}
+
+func isProcSubst(r, next rune) bool {
+	return (r == '<' || r == '>') && next == '('
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || (r >= '0' && r <= '9')
+}
+
+func isSpecialParam(r rune) bool {
+	switch r {
+	case '?', '$', '#', '@', '*', '!', '-', '0':
+		return true
+	}
+	return r >= '1' && r <= '9'
+}
+
+// tokens lexes until the end of the input or, if inner is set, until the
+// closing parenthesis of a command substitution, which is consumed. It
+// reports whether that closing parenthesis was found.
+func (l *lexer) tokens(inner bool) ([]Token, bool) {
+	var toks []Token
+	depth := 0
+
+	// Indexes of the delimiter words of here-documents whose bodies start
+	// on the next line
+	var heredocs []int
+	unterminated := func() {
+		for _, i := range heredocs {
+			l.errorf(toks[i-1].Pos, true, fmt.Sprintf("'%s' without '%s'", toks[i-1].Text, heredocDelim(toks[i])))
+		}
+	}
+
+	for {
+		// Skip blanks and line continuations
+		for l.pos < len(l.src) {
+			if isBlank(l.src[l.pos]) {
+				l.pos++
+			} else if l.src[l.pos] == '\\' && l.peek(1) == '\n' {
+				l.pos += 2
+			} else {
+				break
+			}
+		}
+		if l.pos >= len(l.src) {
+			unterminated()
+			return toks, false
+		}
+
+		r := l.src[l.pos]
+		switch {
+		case r == '\n':
+			toks = append(toks, Token{Kind: NEWLINE, Pos: l.pos, End: l.pos + 1, Text: "\n", Fd: -1})
+			l.pos++
+			for _, i := range heredocs {
+				toks = append(toks, l.heredoc(toks[i-1], toks[i]))
+			}
+			heredocs = nil
+		case r == '#':
+			start := l.pos
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+			toks = append(toks, Token{Kind: COMMENT, Pos: start, End: l.pos, Text: string(l.src[start:l.pos]), Fd: -1})
+		case isProcSubst(r, l.peek(1)):
+			toks = append(toks, l.word())
+		case isMeta(r):
+			if inner && r == ')' && depth == 0 {
+				unterminated()
+				l.pos++
+				return toks, true
+			}
+			tok := l.operator(-1, l.pos)
+			if tok.Text == "(" {
+				depth++
+			} else if tok.Text == ")" {
+				depth--
+			}
+			toks = append(toks, tok)
+		default:
+			tok := l.word()
+			if n := len(toks); tok.Kind == WORD && n > 0 && toks[n-1].Kind == REDIRECT && (toks[n-1].Text == "<<" || toks[n-1].Text == "<<-") {
+				heredocs = append(heredocs, n)
+			}
+			toks = append(toks, tok)
+		}
+	}
+}
+
+// heredocDelim returns the line that ends a here-document with the
+// delimiter word tok.
+func heredocDelim(tok Token) string {
+	if value, ok := tok.Literal(); ok {
+		return value
+	}
+	return tok.Text
+}
+
+// heredoc lexes the body of the here-document opened by the redirection op,
+// up to and including the delimiter line. If the delimiter is quoted the
+// body is literal text, and otherwise it's expanded as in double quotes.
+func (l *lexer) heredoc(op, delim Token) Token {
+	end := heredocDelim(delim)
+	quoted := delim.Quoted()
+	start := l.pos
+
+	var parts []WordPart
+	for {
+		if l.pos >= len(l.src) {
+			l.errorf(op.Pos, true, fmt.Sprintf("'%s' without '%s'", op.Text, end))
+			break
+		}
+		if op.Text == "<<-" {
+			for l.pos < len(l.src) && l.src[l.pos] == '\t' {
+				l.pos++
+			}
+		}
+		lineEnd := l.pos
+		for lineEnd < len(l.src) && l.src[lineEnd] != '\n' {
+			lineEnd++
+		}
+		if string(l.src[l.pos:lineEnd]) == end {
+			l.pos = min(lineEnd+1, len(l.src))
+			break
+		}
+
+		lineEnd = min(lineEnd+1, len(l.src))
+		if quoted {
+			parts = append(parts, &Lit{Pos: l.pos, End: lineEnd, Value: string(l.src[l.pos:lineEnd]), Quoted: true})
+		} else {
+			// Lex each line on its own, as the tabs stripped between them
+			// aren't part of the body
+			inner := &lexer{src: l.src[:lineEnd], pos: l.pos}
+			parts = append(parts, inner.quotedParts(0, "\\$`")...)
+			if inner.err != nil {
+				l.errorf(inner.err.Pos, false, inner.err.Msg)
+			}
+		}
+		l.pos = lineEnd
+	}
+
+	return Token{Kind: HEREDOC, Pos: start, End: l.pos, Text: string(l.src[start:l.pos]), Fd: -1, Parts: parts}
+}
+
+var redirects = []string{"&>>", "<<<", "<<-", "&>", "<<", "<&", "<>", ">>", ">&", ">|", "<", ">"}
+var operators = []string{"&&", "||", ";;", "|&", "|", "&", ";", "(", ")"}
+
+// operator lexes an operator at the current position. fd is the file
+// descriptor number that preceded it, and start where that number began.
+func (l *lexer) operator(fd int, start int) Token {
+	rest := string(l.src[l.pos:min(l.pos+3, len(l.src))])
+	for _, op := range redirects {
+		if strings.HasPrefix(rest, op) {
+			l.pos += len(op)
+			return Token{Kind: REDIRECT, Pos: start, End: l.pos, Text: op, Fd: fd}
+		}
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op) {
+			l.pos += len(op)
+			return Token{Kind: OPERATOR, Pos: start, End: l.pos, Text: op, Fd: -1}
+		}
+	}
+	// Unreachable for any rune accepted by isMeta
+	l.pos++
+	return Token{Kind: OPERATOR, Pos: start, End: l.pos, Text: string(l.src[start:l.pos]), Fd: -1}
+}
+
+// word lexes a word starting at the current position.
+func (l *lexer) word() Token {
+	start := l.pos
+
+	// A word made of digits directly followed by < or > is a file
+	// descriptor for a redirection.
+	i := l.pos
+	for i < len(l.src) && l.src[i] >= '0' && l.src[i] <= '9' {
+		i++
+	}
+	if i > l.pos && i < len(l.src) && (l.src[i] == '<' || l.src[i] == '>') {
+		fd := 0
+		for _, r := range l.src[l.pos:i] {
+			fd = fd*10 + int(r-'0')
+		}
+		l.pos = i
+		return l.operator(fd, start)
+	}
+
+	var parts []WordPart
+	var lit strings.Builder
+	litStart := l.pos
+	flush := func() {
+		if lit.Len() > 0 {
+			parts = append(parts, &Lit{Pos: litStart, End: l.pos, Value: lit.String()})
+			lit.Reset()
+		}
+	}
+
+loop:
+	for l.pos < len(l.src) {
+		r := l.src[l.pos]
+		switch {
+		case isProcSubst(r, l.peek(1)):
+			flush()
+			parts = append(parts, l.procSubst())
+			litStart = l.pos
+		case isBlank(r) || r == '\n' || isMeta(r):
+			break loop
+		case r == '\\':
+			if l.peek(1) == '\n' { // line continuation
+				flush()
+				l.pos += 2
+				litStart = l.pos
+				continue
+			}
+			flush()
+			if l.pos+1 >= len(l.src) {
+				l.errorf(l.pos, true, "unexpected end of input after \\")
+				l.pos++
+				break loop
+			}
+			parts = append(parts, &Lit{Pos: l.pos, End: l.pos + 2, Value: string(l.src[l.pos+1]), Quoted: true})
+			l.pos += 2
+			litStart = l.pos
+		case r == '\'':
+			flush()
+			parts = append(parts, l.sglQuoted())
+			litStart = l.pos
+		case r == '"':
+			flush()
+			parts = append(parts, l.dblQuoted())
+			litStart = l.pos
+		case r == '`':
+			flush()
+			parts = append(parts, l.backquote())
+			litStart = l.pos
+		case r == '$':
+			if part := l.dollar(); part != nil {
+				flush()
+				parts = append(parts, part)
+				litStart = l.pos
+			} else {
+				lit.WriteRune(r)
+				l.pos++
+			}
+		default:
+			lit.WriteRune(r)
+			l.pos++
+		}
+	}
+	flush()
+
+	return Token{Kind: WORD, Pos: start, End: l.pos, Text: string(l.src[start:l.pos]), Fd: -1, Parts: parts}
+}
+
+func (l *lexer) sglQuoted() WordPart {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.src) && l.src[l.pos] != '\'' {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		l.errorf(start, true, "unterminated quote")
+		return &SglQuoted{Pos: start, End: l.pos, Value: string(l.src[start+1:])}
+	}
+	l.pos++
+	return &SglQuoted{Pos: start, End: l.pos, Value: string(l.src[start+1 : l.pos-1])}
+}
+
+func (l *lexer) dblQuoted() WordPart {
+	start := l.pos
+	l.pos++
+	parts := l.quotedParts('"', "\"\\$`")
+	if l.pos >= len(l.src) {
+		l.errorf(start, true, "unterminated quote")
+		return &DblQuoted{Pos: start, End: l.pos, Parts: parts}
+	}
+	l.pos++
+	return &DblQuoted{Pos: start, End: l.pos, Parts: parts}
+}
+
+// quotedParts lexes text as in double quotes, where only $ and ` expansions
+// are recognized and a backslash only escapes the runes in escapes. It stops
+// at the end of the input or the rune stop, which isn't consumed.
+func (l *lexer) quotedParts(stop rune, escapes string) []WordPart {
+	var parts []WordPart
+	var lit strings.Builder
+	litStart := l.pos
+	flush := func(end int) {
+		if lit.Len() > 0 {
+			parts = append(parts, &Lit{Pos: litStart, End: end, Value: lit.String(), Quoted: true})
+			lit.Reset()
+		}
+	}
+
+	for l.pos < len(l.src) && l.src[l.pos] != stop {
+		r := l.src[l.pos]
+		switch r {
+		case '\\':
+			switch next := l.peek(1); {
+			case next == '\n':
+				l.pos += 2
+			case next != 0 && strings.ContainsRune(escapes, next):
+				lit.WriteRune(next)
+				l.pos += 2
+			default:
+				lit.WriteRune(r)
+				l.pos++
+			}
+		case '`':
+			flush(l.pos)
+			parts = append(parts, l.backquote())
+			litStart = l.pos
+		case '$':
+			dollar := l.pos
+			if part := l.dollar(); part != nil {
+				flush(dollar)
+				parts = append(parts, part)
+				litStart = l.pos
+			} else {
+				lit.WriteRune(r)
+				l.pos++
+			}
+		default:
+			lit.WriteRune(r)
+			l.pos++
+		}
+	}
+	flush(l.pos)
+	return parts
+}
+
+func (l *lexer) backquote() WordPart {
+	start := l.pos
+	end := l.pos + 1
+	for end < len(l.src) && l.src[end] != '`' {
+		if l.src[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(l.src) {
+		l.errorf(start, true, "unterminated command substitution")
+		end = len(l.src)
+	}
+
+	// Lex the inner program in place so positions stay absolute
+	inner := &lexer{src: l.src[:end], pos: start + 1}
+	toks, _ := inner.tokens(false)
+	if inner.err != nil {
+		l.errorf(inner.err.Pos, inner.err.Incomplete, inner.err.Msg)
+	}
+
+	l.pos = min(end+1, len(l.src))
+	return &CmdSubst{Pos: start, End: l.pos, Tokens: toks, Backquote: true}
+}
+
+// dollar lexes an expansion starting with $, or returns nil if the $ is
+// literal.
+func (l *lexer) dollar() WordPart {
+	start := l.pos
+	next := l.peek(1)
+
+	switch {
+	case next == '(' && l.peek(2) == '(':
+		return l.arithExp()
+	case next == '(':
+		l.pos += 2
+		toks, closed := l.tokens(true)
+		if !closed {
+			l.errorf(start, true, "unterminated command substitution")
+		}
+		return &CmdSubst{Pos: start, End: l.pos, Tokens: toks}
+	case next == '{':
+		return l.paramExp()
+	case isSpecialParam(next):
+		l.pos += 2
+		return &ParamExp{Pos: start, End: l.pos, Name: string(next), Short: true}
+	case isNameStart(next):
+		l.pos++
+		nameStart := l.pos
+		for l.pos < len(l.src) && isNameChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return &ParamExp{Pos: start, End: l.pos, Name: string(l.src[nameStart:l.pos]), Short: true}
+	}
+
+	return nil
+}
+
+// arithExp lexes an arithmetic expansion starting at $((.
+func (l *lexer) arithExp() WordPart {
+	start := l.pos
+	l.pos += 3
+
+	var parts []WordPart
+	var lit strings.Builder
+	litStart := l.pos
+	flush := func(end int) {
+		if lit.Len() > 0 {
+			parts = append(parts, &Lit{Pos: litStart, End: end, Value: lit.String(), Quoted: true})
+			lit.Reset()
+		}
+	}
+
+	depth := 0
+	for l.pos < len(l.src) {
+		r := l.src[l.pos]
+		switch {
+		case r == ')' && depth == 0 && l.peek(1) == ')':
+			flush(l.pos)
+			l.pos += 2
+			return &ArithExp{Pos: start, End: l.pos, Parts: parts}
+		case r == '`':
+			flush(l.pos)
+			parts = append(parts, l.backquote())
+			litStart = l.pos
+			continue
+		case r == '$':
+			dollar := l.pos
+			if part := l.dollar(); part != nil {
+				flush(dollar)
+				parts = append(parts, part)
+				litStart = l.pos
+				continue
+			}
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		}
+		lit.WriteRune(r)
+		l.pos++
+	}
+
+	flush(l.pos)
+	l.errorf(start, true, "unterminated arithmetic expansion")
+	return &ArithExp{Pos: start, End: l.pos, Parts: parts}
+}
+
+// procSubst lexes a process substitution starting at <( or >(.
+func (l *lexer) procSubst() WordPart {
+	start := l.pos
+	op := string(l.src[l.pos])
+	l.pos += 2
+	toks, closed := l.tokens(true)
+	if !closed {
+		l.errorf(start, true, "unterminated process substitution")
+	}
+	return &ProcSubst{Pos: start, End: l.pos, Op: op, Tokens: toks}
+}
+
+// Operators of parameter expansions, longest first.
+var paramOps = []string{
+	":-", ":=", ":?", ":+", "##", "#", "%%", "%", "//", "/#", "/%", "/",
+	"^^", "^", ",,", ",", ":", "-", "=", "?", "+",
+}
+
+// paramExp lexes a parameter expansion starting at ${.
+func (l *lexer) paramExp() WordPart {
+	start := l.pos
+	l.pos += 2
+	pe := &ParamExp{Pos: start}
+
+	switch next := l.peek(1); {
+	case l.peek(0) == '#' && next != '}' && (isNameStart(next) || isSpecialParam(next)):
+		pe.Length = true
+		l.pos++
+	case l.peek(0) == '!' && isNameStart(next):
+		pe.Indirect = true
+		l.pos++
+	}
+
+	nameStart := l.pos
+	switch r := l.peek(0); {
+	case r >= '0' && r <= '9':
+		for l.pos < len(l.src) && l.src[l.pos] >= '0' && l.src[l.pos] <= '9' {
+			l.pos++
+		}
+	case isSpecialParam(r):
+		l.pos++
+	default:
+		for l.pos < len(l.src) && isNameChar(l.src[l.pos]) {
+			l.pos++
+		}
+	}
+	pe.Name = string(l.src[nameStart:l.pos])
+
+	if pe.Name != "" && l.peek(0) == '[' {
+		l.pos++
+		pe.Index = l.paramWord("]")
+		if l.peek(0) == ']' {
+			l.pos++
+		}
+	}
+
+	if pe.Name != "" && !pe.Length && l.pos < len(l.src) && l.src[l.pos] != '}' {
+		rest := string(l.src[l.pos:min(l.pos+2, len(l.src))])
+		for _, op := range paramOps {
+			if strings.HasPrefix(rest, op) {
+				pe.Op = op
+				l.pos += len([]rune(op))
+				break
+			}
+		}
+
+		switch pe.Op {
+		case "":
+		case "/", "//", "/#", "/%":
+			pe.Arg = l.paramWord("/}")
+			if l.peek(0) == '/' {
+				l.pos++
+				pe.Repl, pe.HasRepl = l.paramWord("}"), true
+			}
+		case ":":
+			pe.Arg = l.paramWord(":}")
+			if l.peek(0) == ':' {
+				l.pos++
+				pe.Repl, pe.HasRepl = l.paramWord("}"), true
+			}
+		default:
+			pe.Arg = l.paramWord("}")
+		}
+	}
+
+	switch {
+	case l.pos >= len(l.src):
+		l.errorf(start, true, "unterminated parameter expansion")
+	case l.src[l.pos] != '}' || pe.Name == "":
+		l.errorf(l.pos, false, "bad substitution")
+		for l.pos < len(l.src) && l.src[l.pos] != '}' && !isBlank(l.src[l.pos]) && l.src[l.pos] != '\n' {
+			l.pos++
+		}
+		if l.pos < len(l.src) && l.src[l.pos] == '}' {
+			l.pos++
+		}
+	default:
+		l.pos++
+	}
+	pe.End = l.pos
+	return pe
+}
+
+// paramWord lexes a word inside a parameter expansion, which ends at any of
+// the unquoted runes in stops. Unlike other words it may contain blanks.
+func (l *lexer) paramWord(stops string) []WordPart {
+	var parts []WordPart
+	var lit strings.Builder
+	litStart := l.pos
+	flush := func() {
+		if lit.Len() > 0 {
+			parts = append(parts, &Lit{Pos: litStart, End: l.pos, Value: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	for l.pos < len(l.src) && !strings.ContainsRune(stops, l.src[l.pos]) {
+		r := l.src[l.pos]
+		switch r {
+		case '\\':
+			flush()
+			if l.pos+1 >= len(l.src) {
+				l.pos++
+				break
+			}
+			if l.peek(1) != '\n' {
+				parts = append(parts, &Lit{Pos: l.pos, End: l.pos + 2, Value: string(l.src[l.pos+1]), Quoted: true})
+			}
+			l.pos += 2
+		case '\'':
+			flush()
+			parts = append(parts, l.sglQuoted())
+		case '"':
+			flush()
+			parts = append(parts, l.dblQuoted())
+		case '`':
+			flush()
+			parts = append(parts, l.backquote())
+		case '$':
+			if part := l.dollar(); part != nil {
+				flush()
+				parts = append(parts, part)
+				litStart = l.pos
+				continue
+			}
+			lit.WriteRune(r)
+			l.pos++
+			continue
+		default:
+			lit.WriteRune(r)
+			l.pos++
+			continue
+		}
+		litStart = l.pos
+	}
+	flush()
+	return parts
+}
@@ -0,0 +1,747 @@
+package syntax
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var keywords = map[string]bool{
+	"if": true, "then": true, "elif": true, "else": true, "fi": true,
+	"for": true, "in": true, "while": true, "until": true, "do": true,
+	"done": true, "case": true, "esac": true, "!": true, "{": true, "}": true,
+}
+
+// IsKeyword reports whether s is a reserved word of the shell language.
+func IsKeyword(s string) bool {
+	return keywords[s]
+}
+
+// Parse parses src into a syntax tree. On failure the error is an *Error
+// holding the position of the first problem found.
+func Parse(src string) (*File, error) {
+	toks, lexErr := Lex(src)
+
+	p := newParser(toks, len([]rune(src)))
+	f := &File{Stmts: p.stmtList(), Src: src}
+	if p.err == nil && p.peek().Kind != EOF {
+		p.unexpected(p.peek())
+	}
+
+	var err *Error
+	if lexErr != nil {
+		err = lexErr.(*Error)
+	}
+	if p.err != nil && (err == nil || p.err.Pos < err.Pos) {
+		err = p.err
+	}
+	if err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+type parser struct {
+	toks []Token
+	i    int
+	end  int
+	err  *Error
+
+	// Here-document redirections waiting for their bodies, which follow the
+	// next newline
+	heredocs []*Redirect
+}
+
+func newParser(toks []Token, end int) *parser {
+	p := &parser{end: end}
+	for _, tok := range toks {
+		if tok.Kind != COMMENT {
+			p.toks = append(p.toks, tok)
+		}
+	}
+	return p
+}
+
+func (p *parser) peek() Token {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+	return Token{Kind: EOF, Pos: p.end, End: p.end, Fd: -1}
+}
+
+func (p *parser) next() Token {
+	tok := p.peek()
+	if p.i < len(p.toks) {
+		p.i++
+	}
+	if tok.Kind == NEWLINE {
+		p.heredocBodies()
+	}
+	return tok
+}
+
+// heredocBodies gives the pending here-documents the bodies that follow a
+// newline.
+func (p *parser) heredocBodies() {
+	for p.i < len(p.toks) && p.toks[p.i].Kind == HEREDOC {
+		tok := p.toks[p.i]
+		p.i++
+		if len(p.heredocs) > 0 {
+			p.heredocs[0].Body = p.word(tok)
+			p.heredocs = p.heredocs[1:]
+		}
+	}
+}
+
+func (p *parser) errorf(pos int, incomplete bool, format string, a ...any) {
+	if p.err == nil {
+		p.err = &Error{Pos: pos, Msg: fmt.Sprintf(format, a...), Incomplete: incomplete}
+	}
+}
+
+// unexpected records an error for a token that can't appear where it is.
+func (p *parser) unexpected(tok Token) {
+	switch tok.Kind {
+	case EOF:
+		p.errorf(tok.Pos, true, "unexpected end of input")
+	case NEWLINE:
+		p.errorf(tok.Pos, false, "unexpected newline")
+	default:
+		p.errorf(tok.Pos, false, "unexpected '%s'", tok.Text)
+	}
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	tok := p.peek()
+	if tok.Kind != OPERATOR {
+		return false
+	}
+	for _, op := range ops {
+		if tok.Text == op {
+			return true
+		}
+	}
+	return false
+}
+
+// keyword returns the reserved word at the current token, if any.
+func (p *parser) keyword() string {
+	tok := p.peek()
+	if tok.Kind != WORD || tok.Quoted() {
+		return ""
+	}
+	if value, ok := tok.Literal(); ok && keywords[value] {
+		return value
+	}
+	return ""
+}
+
+func (p *parser) newlines() {
+	for p.peek().Kind == NEWLINE {
+		p.next()
+	}
+}
+
+// expect consumes the reserved word kw, which closes the construct opened by
+// the keyword token opener.
+func (p *parser) expect(kw string, opener Token) bool {
+	if p.err != nil {
+		return false
+	}
+	if p.keyword() == kw {
+		p.next()
+		return true
+	}
+	if tok := p.peek(); tok.Kind == EOF {
+		p.errorf(opener.Pos, true, "'%s' without '%s'", opener.Text, kw)
+	} else {
+		p.unexpected(tok)
+	}
+	return false
+}
+
+// stmtList parses a list of statements up to the end of the input, a closing
+// operator or a reserved word that can't start a command.
+func (p *parser) stmtList() []*Stmt {
+	var stmts []*Stmt
+	for p.err == nil {
+		p.newlines()
+		tok := p.peek()
+		if tok.Kind == EOF || p.isOp(")", ";;") {
+			break
+		}
+		if kw := p.keyword(); closesList(kw) || kw == "in" {
+			break
+		}
+
+		s := p.andOr()
+		if s == nil {
+			break
+		}
+		stmts = append(stmts, s)
+
+		tok = p.peek()
+		switch {
+		case tok.Kind == OPERATOR && tok.Text == ";":
+			p.next()
+		case tok.Kind == OPERATOR && tok.Text == "&":
+			p.next()
+			s.Background = true
+			s.End = tok.End
+		case tok.Kind == NEWLINE || tok.Kind == EOF:
+		case p.isOp(")", ";;"):
+		case closesList(p.keyword()):
+		default:
+			p.unexpected(tok)
+		}
+	}
+	return stmts
+}
+
+func (p *parser) andOr() *Stmt {
+	s := p.pipeline()
+	for s != nil && p.isOp("&&", "||") {
+		op := p.next()
+		p.newlines()
+		if p.peek().Kind == EOF {
+			p.errorf(op.Pos, true, "expected a command after '%s'", op.Text)
+			return s
+		}
+		y := p.pipeline()
+		if y == nil {
+			return s
+		}
+		s = &Stmt{Pos: s.Pos, End: y.End, Cmd: &BinaryCmd{Op: op.Text, X: s, Y: y}}
+	}
+	return s
+}
+
+func (p *parser) pipeline() *Stmt {
+	negated := false
+	bang := p.peek()
+	if p.keyword() == "!" {
+		p.next()
+		negated = true
+	}
+
+	s := p.command()
+	for s != nil && p.isOp("|", "|&") {
+		op := p.next()
+		p.newlines()
+		if p.peek().Kind == EOF {
+			p.errorf(op.Pos, true, "expected a command after '%s'", op.Text)
+			return s
+		}
+		y := p.command()
+		if y == nil {
+			return s
+		}
+		s = &Stmt{Pos: s.Pos, End: y.End, Cmd: &BinaryCmd{Op: op.Text, X: s, Y: y}}
+	}
+
+	if s != nil && negated {
+		s.Negated = true
+		s.Pos = bang.Pos
+	}
+	return s
+}
+
+func (p *parser) command() *Stmt {
+	tok := p.peek()
+	s := &Stmt{Pos: tok.Pos}
+
+	switch kw := p.keyword(); {
+	case tok.Kind == OPERATOR && tok.Text == "(":
+		s.Cmd = p.subshell()
+	case kw == "{":
+		s.Cmd = p.block()
+	case kw == "if":
+		s.Cmd = p.ifClause()
+	case kw == "while" || kw == "until":
+		s.Cmd = p.whileClause()
+	case kw == "for":
+		s.Cmd = p.forClause()
+	case kw == "case":
+		s.Cmd = p.caseClause()
+	case kw == "":
+		if tok.Kind != WORD && tok.Kind != REDIRECT {
+			p.unexpected(tok)
+			return nil
+		}
+		if value, ok := tok.Literal(); ok && !tok.Quoted() && (value == "declare" || value == "typeset") {
+			s.Cmd = p.declClause(s)
+		} else {
+			s.Cmd = p.callExpr(s)
+		}
+		s.End = p.toks[p.i-1].End
+		return s
+	default:
+		p.unexpected(tok)
+		return nil
+	}
+	if p.err != nil {
+		return nil
+	}
+
+	// Compound commands may be followed by redirections
+	for p.peek().Kind == REDIRECT {
+		p.redirect(s)
+	}
+	s.End = p.toks[p.i-1].End
+	return s
+}
+
+func (p *parser) callExpr(s *Stmt) *CallExpr {
+	call := &CallExpr{}
+	for p.err == nil {
+		tok := p.peek()
+		if tok.Kind == REDIRECT {
+			p.redirect(s)
+		} else if tok.Kind == WORD {
+			p.next()
+			if as := splitAssign(tok); as != nil && len(call.Args) == 0 {
+				call.Assigns = append(call.Assigns, p.assign(tok, as))
+			} else {
+				call.Args = append(call.Args, p.word(tok))
+			}
+		} else {
+			break
+		}
+	}
+	return call
+}
+
+func (p *parser) declClause(s *Stmt) *DeclClause {
+	variant, _ := p.next().Literal()
+	decl := &DeclClause{Variant: variant}
+	for p.err == nil {
+		tok := p.peek()
+		if tok.Kind == REDIRECT {
+			p.redirect(s)
+		} else if tok.Kind == WORD {
+			p.next()
+			if as := splitAssign(tok); as != nil {
+				decl.Args = append(decl.Args, p.assign(tok, as))
+			} else {
+				decl.Args = append(decl.Args, &Assign{Pos: tok.Pos, End: tok.End, Naked: true, Value: p.word(tok)})
+			}
+		} else {
+			break
+		}
+	}
+	return decl
+}
+
+// assign finishes parsing an assignment found by splitAssign in tok,
+// including the elements of an array assignment that follow it.
+func (p *parser) assign(tok Token, as *Assign) *Assign {
+	if as.Index != nil {
+		p.subst(as.Index.Parts)
+	}
+	p.subst(as.Value.Parts)
+
+	if len(as.Value.Parts) == 0 && p.isOp("(") && p.peek().Pos == tok.End {
+		as.Array = p.arrayExpr()
+		as.End = as.Array.End
+	}
+	return as
+}
+
+func (p *parser) arrayExpr() *ArrayExpr {
+	opener := p.next()
+	array := &ArrayExpr{Pos: opener.Pos}
+	for p.err == nil {
+		p.newlines()
+		tok := p.peek()
+		switch {
+		case tok.Kind == OPERATOR && tok.Text == ")":
+			p.next()
+			array.End = tok.End
+			return array
+		case tok.Kind == EOF:
+			p.errorf(opener.Pos, true, "'(' without ')'")
+		case tok.Kind == WORD:
+			p.next()
+			elem := &ArrayElem{Value: p.word(tok)}
+			if index, value, ok := splitIndex(tok.Parts); ok {
+				p.subst(index)
+				elem.Index = &Word{Pos: tok.Pos + 1, End: tok.Pos + 1, Parts: index}
+				elem.Value = &Word{Pos: tok.Pos, End: tok.End, Parts: value}
+			}
+			array.Elems = append(array.Elems, elem)
+		default:
+			p.unexpected(tok)
+		}
+	}
+	return array
+}
+
+// splitAssign returns the assignment a word represents, without parsing any
+// command substitutions in it, or nil if it isn't one.
+func splitAssign(tok Token) *Assign {
+	if len(tok.Parts) == 0 {
+		return nil
+	}
+	lit, ok := tok.Parts[0].(*Lit)
+	if !ok || lit.Quoted {
+		return nil
+	}
+	n := 0
+	for n < len(lit.Value) && isNameChar(rune(lit.Value[n])) {
+		n++
+	}
+	if n == 0 || !isName(lit.Value[:n]) {
+		return nil
+	}
+
+	as := &Assign{Pos: tok.Pos, End: tok.End, Name: lit.Value[:n]}
+	rest := append(litSlice(lit, n, len(lit.Value)), tok.Parts[1:]...)
+	if strings.HasPrefix(lit.Value[n:], "[") {
+		index, after, ok := cutParts(append(litSlice(lit, n+1, len(lit.Value)), tok.Parts[1:]...), "]")
+		if !ok {
+			return nil
+		}
+		as.Index = &Word{Pos: lit.Pos + n + 1, End: lit.Pos + n + 1, Parts: index}
+		rest = after
+	}
+
+	first, ok := firstLit(rest)
+	switch {
+	case ok && strings.HasPrefix(first.Value, "="):
+		rest = append(litSlice(first, 1, len(first.Value)), rest[1:]...)
+	case ok && strings.HasPrefix(first.Value, "+="):
+		as.Append = true
+		rest = append(litSlice(first, 2, len(first.Value)), rest[1:]...)
+	default:
+		return nil
+	}
+
+	as.Value = &Word{Pos: tok.End, End: tok.End, Parts: rest}
+	if len(rest) > 0 {
+		as.Value.Pos, _ = rest[0].Span()
+	}
+	return as
+}
+
+// splitIndex splits an array element of the form [index]=value.
+func splitIndex(parts []WordPart) (index, value []WordPart, ok bool) {
+	first, ok := firstLit(parts)
+	if !ok || !strings.HasPrefix(first.Value, "[") {
+		return nil, nil, false
+	}
+	index, rest, ok := cutParts(append(litSlice(first, 1, len(first.Value)), parts[1:]...), "]")
+	if !ok {
+		return nil, nil, false
+	}
+	if first, ok := firstLit(rest); ok && strings.HasPrefix(first.Value, "=") {
+		return index, append(litSlice(first, 1, len(first.Value)), rest[1:]...), true
+	}
+	return nil, nil, false
+}
+
+// firstLit returns the first of parts if it's an unquoted literal.
+func firstLit(parts []WordPart) (*Lit, bool) {
+	if len(parts) == 0 {
+		return nil, false
+	}
+	lit, ok := parts[0].(*Lit)
+	return lit, ok && !lit.Quoted
+}
+
+// cutParts splits parts around the first occurrence of sep in an unquoted
+// literal.
+func cutParts(parts []WordPart, sep string) (before, after []WordPart, found bool) {
+	for i, part := range parts {
+		lit, ok := part.(*Lit)
+		if !ok || lit.Quoted {
+			continue
+		}
+		if j := strings.Index(lit.Value, sep); j >= 0 {
+			before = append(append([]WordPart(nil), parts[:i]...), litSlice(lit, 0, j)...)
+			after = append(litSlice(lit, j+len(sep), len(lit.Value)), parts[i+1:]...)
+			return before, after, true
+		}
+	}
+	return nil, nil, false
+}
+
+// litSlice returns the part of an unquoted literal between the byte offsets
+// from and to, or nothing if that's empty.
+func litSlice(lit *Lit, from, to int) []WordPart {
+	if from >= to {
+		return nil
+	}
+	pos := lit.Pos + utf8.RuneCountInString(lit.Value[:from])
+	end := pos + utf8.RuneCountInString(lit.Value[from:to])
+	return []WordPart{&Lit{Pos: pos, End: end, Value: lit.Value[from:to]}}
+}
+
+func (p *parser) redirect(s *Stmt) {
+	op := p.next()
+	tok := p.peek()
+	if tok.Kind != WORD {
+		p.errorf(op.Pos, false, "expected a file name after '%s'", op.Text)
+		return
+	}
+	p.next()
+	rd := &Redirect{Pos: op.Pos, End: tok.End, Op: op.Text, Fd: op.Fd, Word: p.word(tok)}
+	if op.Text == "<<" || op.Text == "<<-" {
+		p.heredocs = append(p.heredocs, rd)
+	}
+	s.Redirs = append(s.Redirs, rd)
+}
+
+func (p *parser) word(tok Token) *Word {
+	p.subst(tok.Parts)
+	return &Word{Pos: tok.Pos, End: tok.End, Parts: tok.Parts}
+}
+
+// subst parses the programs of any command substitutions in parts.
+func (p *parser) subst(parts []WordPart) {
+	for _, part := range parts {
+		switch part := part.(type) {
+		case *DblQuoted:
+			p.subst(part.Parts)
+		case *ArithExp:
+			p.subst(part.Parts)
+		case *ParamExp:
+			p.subst(part.Index)
+			p.subst(part.Arg)
+			p.subst(part.Repl)
+		case *CmdSubst:
+			part.Stmts = p.substStmts(part.Tokens, part.End-1)
+		case *ProcSubst:
+			part.Stmts = p.substStmts(part.Tokens, part.End-1)
+		}
+	}
+}
+
+// substStmts parses the tokens of a command or process substitution that
+// ends at end.
+func (p *parser) substStmts(toks []Token, end int) []*Stmt {
+	inner := newParser(toks, end)
+	stmts := inner.stmtList()
+	if inner.err == nil && inner.peek().Kind != EOF {
+		inner.unexpected(inner.peek())
+	}
+	if inner.err != nil && p.err == nil {
+		// An unterminated substitution is reported by the lexer, so
+		// anything found here is a real error
+		p.err = inner.err
+		p.err.Incomplete = false
+	}
+	return stmts
+}
+
+func (p *parser) ifClause() *IfClause {
+	opener := p.next()
+	clause := &IfClause{}
+
+	clause.Cond = p.condition(opener)
+	if !p.expect("then", opener) {
+		return clause
+	}
+	clause.Then = p.body(opener, "fi")
+
+	switch p.keyword() {
+	case "elif":
+		// Parse the rest as a nested if that shares our fi
+		elif := p.ifClause()
+		clause.Else = []*Stmt{{Pos: opener.Pos, Cmd: elif}}
+		return clause
+	case "else":
+		elseTok := p.next()
+		clause.Else = p.body(elseTok, "fi")
+	}
+	p.expect("fi", opener)
+	return clause
+}
+
+func (p *parser) whileClause() *WhileClause {
+	opener := p.next()
+	clause := &WhileClause{Until: opener.Text == "until"}
+
+	clause.Cond = p.condition(opener)
+	doTok := p.peek()
+	if !p.expect("do", opener) {
+		return clause
+	}
+	clause.Do = p.body(doTok, "done")
+	p.expect("done", doTok)
+	return clause
+}
+
+func (p *parser) forClause() *ForClause {
+	opener := p.next()
+	clause := &ForClause{}
+
+	tok := p.peek()
+	name, ok := tok.Literal()
+	if tok.Kind == EOF {
+		p.errorf(opener.Pos, true, "'for' without a variable name")
+		return clause
+	}
+	if tok.Kind != WORD || !ok || !isName(name) {
+		p.errorf(tok.Pos, false, "'%s' is not a valid variable name", tok.Text)
+		return clause
+	}
+	p.next()
+	clause.Name = name
+
+	p.newlines()
+	if p.keyword() == "in" {
+		p.next()
+		clause.HasIn = true
+		for p.peek().Kind == WORD {
+			clause.Items = append(clause.Items, p.word(p.next()))
+		}
+	}
+	if p.isOp(";") {
+		p.next()
+	} else if p.peek().Kind != NEWLINE && p.keyword() != "do" && p.peek().Kind != EOF {
+		p.unexpected(p.peek())
+		return clause
+	}
+	p.newlines()
+
+	doTok := p.peek()
+	if !p.expect("do", opener) {
+		return clause
+	}
+	clause.Do = p.body(doTok, "done")
+	p.expect("done", doTok)
+	return clause
+}
+
+func (p *parser) caseClause() *CaseClause {
+	opener := p.next()
+	clause := &CaseClause{}
+
+	tok := p.peek()
+	if tok.Kind == EOF {
+		p.errorf(opener.Pos, true, "'case' without a word")
+		return clause
+	}
+	if tok.Kind != WORD {
+		p.unexpected(tok)
+		return clause
+	}
+	clause.Word = p.word(p.next())
+
+	p.newlines()
+	if !p.expect("in", opener) {
+		return clause
+	}
+
+	for p.err == nil {
+		p.newlines()
+		if p.keyword() == "esac" {
+			p.next()
+			return clause
+		}
+		if p.peek().Kind == EOF {
+			p.errorf(opener.Pos, true, "'case' without 'esac'")
+			return clause
+		}
+
+		item := &CaseItem{}
+		if p.isOp("(") {
+			p.next()
+		}
+		for {
+			tok := p.peek()
+			if tok.Kind != WORD {
+				p.unexpected(tok)
+				return clause
+			}
+			item.Patterns = append(item.Patterns, p.word(p.next()))
+			if !p.isOp("|") {
+				break
+			}
+			p.next()
+		}
+		if !p.isOp(")") {
+			p.unexpected(p.peek())
+			return clause
+		}
+		p.next()
+
+		item.Stmts = p.stmtList()
+		clause.Items = append(clause.Items, item)
+
+		if p.isOp(";;") {
+			p.next()
+		} else if p.keyword() != "esac" && p.peek().Kind != EOF {
+			p.unexpected(p.peek())
+		}
+	}
+	return clause
+}
+
+func (p *parser) subshell() *Subshell {
+	opener := p.next()
+	sub := &Subshell{Stmts: p.body(opener, ")")}
+	if p.err != nil {
+		return sub
+	}
+	if p.isOp(")") {
+		p.next()
+	} else if tok := p.peek(); tok.Kind == EOF {
+		p.errorf(opener.Pos, true, "'(' without ')'")
+	} else {
+		p.unexpected(tok)
+	}
+	return sub
+}
+
+func (p *parser) block() *Block {
+	opener := p.next()
+	block := &Block{Stmts: p.body(opener, "}")}
+	p.expect("}", opener)
+	return block
+}
+
+// condition parses the condition list of an if or loop.
+func (p *parser) condition(opener Token) []*Stmt {
+	stmts := p.stmtList()
+	if p.err == nil && len(stmts) == 0 {
+		if tok := p.peek(); tok.Kind == EOF {
+			p.errorf(opener.Pos, true, "'%s' without a condition", opener.Text)
+		} else {
+			p.unexpected(tok)
+		}
+	}
+	return stmts
+}
+
+// body parses the commands that follow opener in a compound command that is
+// closed by the reserved word kw.
+func (p *parser) body(opener Token, kw string) []*Stmt {
+	stmts := p.stmtList()
+	if p.err == nil && len(stmts) == 0 {
+		if tok := p.peek(); tok.Kind == EOF {
+			p.errorf(opener.Pos, true, "'%s' without '%s'", opener.Text, kw)
+		} else {
+			p.unexpected(tok)
+		}
+	}
+	return stmts
+}
+
+// closesList reports whether the reserved word kw ends a list of commands.
+func closesList(kw string) bool {
+	switch kw {
+	case "then", "elif", "else", "fi", "do", "done", "esac", "}":
+		return true
+	}
+	return false
+}
+
+func isName(s string) bool {
+	for i, r := range s {
+		if i == 0 && !isNameStart(r) || !isNameChar(r) {
+			return false
+		}
+	}
+	return s != ""
+}
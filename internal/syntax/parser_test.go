@@ -0,0 +1,123 @@
+package syntax
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		src  string
+		want Error
+	}{
+		{`echo "abc`, Error{Pos: 5, Msg: "unterminated quote", Incomplete: true}},
+		{`echo 'a b`, Error{Pos: 5, Msg: "unterminated quote", Incomplete: true}},
+		{`ls |`, Error{Pos: 3, Msg: "expected a command after '|'", Incomplete: true}},
+		{`ls | wc |  `, Error{Pos: 8, Msg: "expected a command after '|'", Incomplete: true}},
+		{`make &&`, Error{Pos: 5, Msg: "expected a command after '&&'", Incomplete: true}},
+		{`false || `, Error{Pos: 6, Msg: "expected a command after '||'", Incomplete: true}},
+		// Positions are in runes, for the caret under the input
+		{`echo é "abc`, Error{Pos: 7, Msg: "unterminated quote", Incomplete: true}},
+		{`echo )`, Error{Pos: 5, Msg: "unexpected ')'", Incomplete: false}},
+		{`echo a) b`, Error{Pos: 6, Msg: "unexpected ')'", Incomplete: false}},
+		{`(echo a) b)`, Error{Pos: 9, Msg: "unexpected 'b'", Incomplete: false}},
+		{`( echo`, Error{Pos: 0, Msg: "'(' without ')'", Incomplete: true}},
+		{`{ echo a;`, Error{Pos: 0, Msg: "'{' without '}'", Incomplete: true}},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		var got *Error
+		if !errors.As(err, &got) {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.src, err, tt.want)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("Parse(%q) error = %+v, want %+v", tt.src, *got, tt.want)
+		}
+	}
+}
+
+func TestParseValid(t *testing.T) {
+	for _, src := range []string{`echo "a|b" 'c)'`, `ls | wc -l`, `make && ./run || echo failed`, `echo \)`, `(cd /tmp && ls)`, `{ echo a; } > out`, `diff <(ls a) <(ls b)`, `ls | tee >(wc -l)`} {
+		if _, err := Parse(src); err != nil {
+			t.Errorf("Parse(%q) error = %v", src, err)
+		}
+	}
+}
+
+func TestParseHeredocIncomplete(t *testing.T) {
+	// The body is typed over several lines, which are incomplete until the
+	// delimiter line
+	tests := []struct {
+		src  string
+		want *Error
+	}{
+		{"cat <<EOF", &Error{Pos: 4, Msg: "'<<' without 'EOF'", Incomplete: true}},
+		{"cat <<EOF\nhello", &Error{Pos: 4, Msg: "'<<' without 'EOF'", Incomplete: true}},
+		{"cat <<EOF\nhello\nEOF x", &Error{Pos: 4, Msg: "'<<' without 'EOF'", Incomplete: true}},
+		{"cat <<EOF\nhello\n\tEOF", &Error{Pos: 4, Msg: "'<<' without 'EOF'", Incomplete: true}},
+		{"cat <<EOF\nhello\nEOF", nil},
+		{"cat <<EOF\nhello\nEOF\n", nil},
+		{"cat <<-EOF\n\thello\n\tEOF", nil},
+		{"cat <<'EOF'\n$x\nEOF", nil},
+		{"cat <<A; cat <<B\na\nA", &Error{Pos: 13, Msg: "'<<' without 'B'", Incomplete: true}},
+		{"cat <<A; cat <<B\na\nA\nb\nB", nil},
+		{"cat <<<word", nil},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("Parse(%q) error = %v", tt.src, err)
+			}
+			continue
+		}
+		var got *Error
+		if !errors.As(err, &got) || *got != *tt.want {
+			t.Errorf("Parse(%q) error = %v, want %+v", tt.src, err, *tt.want)
+		}
+	}
+}
+
+func TestParseHeredocBody(t *testing.T) {
+	tests := []struct {
+		src    string
+		op     string
+		body   string
+		quoted bool
+	}{
+		{"cat <<EOF\nhello $x\nEOF", "<<", "hello $x\n", false},
+		{"cat <<'EOF'\nhello $x\nEOF", "<<", "hello $x\n", true},
+		{"cat <<\"EOF\"\nhello $x\nEOF", "<<", "hello $x\n", true},
+		{"cat <<\\EOF\nhello $x\nEOF", "<<", "hello $x\n", true},
+		{"cat <<-EOF\n\t\thello $x\n\tworld\n\tEOF", "<<-", "hello $x\nworld\n", false},
+		{"cat <<-'EOF'\n\thello $x\nEOF", "<<-", "hello $x\n", true},
+	}
+	for _, tt := range tests {
+		f, err := Parse(tt.src)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.src, err)
+			continue
+		}
+		r := f.Stmts[0].Redirs[0]
+		if r.Op != tt.op || r.Body == nil {
+			t.Errorf("Parse(%q) redirect = %q with body %v, want %q with a body", tt.src, r.Op, r.Body, tt.op)
+			continue
+		}
+
+		// The text of the body, with the tabs <<- strips left out, and
+		// whether $x is left literal
+		var body string
+		quoted := true
+		for _, p := range r.Body.Parts {
+			pos, end := p.Span()
+			body += string([]rune(tt.src)[pos:end])
+			if _, ok := p.(*Lit); !ok {
+				quoted = false
+			}
+		}
+		if body != tt.body || quoted != tt.quoted {
+			t.Errorf("Parse(%q) body = %q, quoted %v; want %q, quoted %v", tt.src, body, quoted, tt.body, tt.quoted)
+		}
+	}
+}
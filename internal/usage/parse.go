@@ -0,0 +1,283 @@
+package usage
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// flagName matches the name of a flag, such as -v or --verbose.
+var flagName = regexp.MustCompile(`^--?[A-Za-z0-9?#@][A-Za-z0-9_.+-]*$`)
+
+// parseHelp returns the flags listed in the output of --help, on lines
+// starting with them, followed by their description on the same line or
+// the next one.
+func parseHelp(text string) []Flag {
+	var flags []Flag
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		if !strings.HasPrefix(trimmed, "-") || len(line)-len(trimmed) > 16 {
+			continue
+		}
+		tag, desc := splitColumns(trimmed)
+		if desc == "" && i+1 < len(lines) {
+			if next := strings.TrimSpace(lines[i+1]); !strings.HasPrefix(next, "-") {
+				desc = next
+			}
+		}
+		flags = addFlag(flags, tag, desc)
+	}
+	return flags
+}
+
+// splitColumns splits a line listing a flag into the flag, with its
+// argument, and its description, which is separated by two spaces or a tab,
+// and maybe a colon.
+func splitColumns(line string) (string, string) {
+	i := -1
+	for _, sep := range []string{"  ", "\t", " : "} {
+		if j := strings.Index(line, sep); j >= 0 && (i < 0 || j < i) {
+			i = j
+		}
+	}
+	if i < 0 {
+		return line, ""
+	}
+	desc := strings.TrimSpace(line[i:])
+	desc = strings.TrimSpace(strings.TrimPrefix(desc, ":"))
+	return line[:i], desc
+}
+
+// addFlag adds the flag listed as tag, such as "-o, --output=FILE", with
+// its description, unless it's not a flag or already listed.
+func addFlag(flags []Flag, tag, desc string) []Flag {
+	var f Flag
+	for _, field := range strings.FieldsFunc(tag, func(r rune) bool { return r == ',' || r == ' ' || r == '|' }) {
+		if !strings.HasPrefix(field, "-") {
+			// An argument, such as FILE or <file>, after the name
+			f.Arg = f.Arg || len(f.Names) > 0
+			continue
+		}
+		name := field
+		if i := strings.IndexAny(name, "=["); i >= 0 {
+			name, f.Arg = name[:i], f.Arg || name[i] == '='
+		}
+		if flagName.MatchString(name) {
+			f.Names = append(f.Names, name)
+		}
+	}
+	if len(f.Names) == 0 {
+		return flags
+	}
+	for _, other := range flags {
+		if other.Names[0] == f.Names[0] {
+			return flags
+		}
+	}
+	f.Description = firstSentence(desc)
+	return append(flags, f)
+}
+
+// firstSentence returns the start of a description, up to the end of its
+// first sentence.
+func firstSentence(desc string) string {
+	desc = strings.Join(strings.Fields(desc), " ")
+	if i := strings.Index(desc, ". "); i > 0 && desc[i-1] != ' ' {
+		return desc[:i]
+	}
+	if strings.HasSuffix(desc, ".") && !strings.HasSuffix(desc, " .") {
+		desc = desc[:len(desc)-1]
+	}
+	return desc
+}
+
+// manPage returns the source of the man page of a command in section 1 or
+// 8, from the directories in manpath.
+func manPage(name, manpath string) string {
+	for _, root := range filepath.SplitList(manpath) {
+		for _, section := range []string{"1", "8"} {
+			matches, _ := filepath.Glob(filepath.Join(root, "man"+section, name+"."+section+"*"))
+			for _, file := range matches {
+				if src, ok := readMan(root, file, true); ok {
+					return src
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// readMan reads a man page, which may be compressed, following a .so
+// request that includes another one in its place if follow is set.
+func readMan(root, file string, follow bool) (string, bool) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return "", false
+		}
+		r = gz
+	}
+	data, err := io.ReadAll(io.LimitReader(r, 1<<20))
+	if err != nil {
+		return "", false
+	}
+	src := string(data)
+	if other, ok := strings.CutPrefix(strings.TrimSpace(src), ".so "); ok && follow {
+		return readMan(root, filepath.Join(root, strings.TrimSpace(other)), false)
+	}
+	return src, true
+}
+
+// parseMan returns the flags in the source of a man page: the tags of the
+// paragraphs that start with a flag, with the text of the paragraph as
+// their description.
+func parseMan(src string) []Flag {
+	var flags []Flag
+	lines := strings.Split(src, "\n")
+	for i := 0; i < len(lines); i++ {
+		request, args := splitRequest(lines[i])
+		var tag string
+		switch request {
+		case ".TP":
+			// The tag is on the next line
+			if i+1 < len(lines) {
+				i++
+				tag = manText(lines[i])
+			}
+		case ".IP":
+			tag = manText(unquote(args))
+		case ".It":
+			tag = mdocText(args)
+		default:
+			continue
+		}
+		if !strings.HasPrefix(tag, "-") {
+			continue
+		}
+
+		var desc []string
+		for i+1 < len(lines) {
+			next, _ := splitRequest(lines[i+1])
+			if next != "" && !isFontRequest(next) && !isMdocRequest(next) || strings.TrimSpace(lines[i+1]) == "" {
+				break
+			}
+			i++
+			desc = append(desc, manText(lines[i]))
+		}
+		tag, _ = splitColumns(tag)
+		flags = addFlag(flags, tag, strings.Join(desc, " "))
+	}
+	return flags
+}
+
+// splitRequest returns the request a line of a man page starts with, such
+// as .TP, and its arguments, or an empty request for a line of text.
+func splitRequest(line string) (string, string) {
+	if !strings.HasPrefix(line, ".") && !strings.HasPrefix(line, "'") {
+		return "", line
+	}
+	request, args, _ := strings.Cut(line, " ")
+	return request, strings.TrimSpace(args)
+}
+
+// isFontRequest reports whether a request only sets the font of its text.
+func isFontRequest(request string) bool {
+	switch request {
+	case ".B", ".I", ".BR", ".RB", ".BI", ".IB", ".IR", ".RI", ".SM":
+		return true
+	}
+	return false
+}
+
+// isMdocRequest reports whether a request of an mdoc man page marks up
+// text within a paragraph.
+func isMdocRequest(request string) bool {
+	switch request {
+	case ".Nm", ".Ar", ".Fl", ".Pa", ".Cm", ".Ql", ".Dq", ".Sq", ".Xr", ".Em", ".Li", ".Va", ".Ev", ".Sy", ".Op":
+		return true
+	}
+	return false
+}
+
+// troffEscapes are the escapes replaced in the text of a man page.
+var troffEscapes = strings.NewReplacer(
+	`\-`, "-", `\e`, `\`, `\&`, "", `\ `, " ", `\|`, "", `\^`, "", `\(em`, "—", `\(en`, "–",
+	`\(aq`, "'", `\(dq`, `"`, `\(lq`, `"`, `\(rq`, `"`, `\(oq`, "'", `\(cq`, "'",
+)
+
+// fontEscape matches the escapes changing the font.
+var fontEscape = regexp.MustCompile(`\\f(\(..|\[[^]]*\]|.)`)
+
+// manText returns the text of a line of a man page, without the requests
+// and escapes setting fonts.
+func manText(line string) string {
+	request, args := splitRequest(line)
+	switch {
+	case isFontRequest(request) && len(request) == 3:
+		// Alternating fonts join their arguments
+		line = strings.Join(splitArgs(args), "")
+	case isFontRequest(request):
+		line = strings.Join(splitArgs(args), " ")
+	case isMdocRequest(request):
+		return mdocText(request[1:] + " " + args)
+	}
+	line = fontEscape.ReplaceAllString(line, "")
+	return strings.TrimSpace(troffEscapes.Replace(line))
+}
+
+// mdocText returns the text of the arguments of an .It request of an
+// mdoc man page, such as "Fl o Ar file" for "-o file".
+func mdocText(args string) string {
+	var words []string
+	fields := strings.Fields(args)
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "Fl":
+			if i+1 < len(fields) {
+				i++
+				words = append(words, "-"+fields[i])
+			} else {
+				words = append(words, "-")
+			}
+		case "Ar", "Op", "Oo", "Oc", "Ns", "Cm", "Pa", "Ql", "Nm", "Dq", "Sq", "Xr", "Em", "Li", "Va", "Ev", "Sy":
+		default:
+			words = append(words, fields[i])
+		}
+	}
+	return manText(strings.Join(words, " "))
+}
+
+// splitArgs splits the arguments of a request, which are separated by
+// spaces unless quoted.
+func splitArgs(args string) []string {
+	var fields []string
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		if strings.HasPrefix(args, `"`) {
+			field, rest, _ := strings.Cut(args[1:], `"`)
+			fields, args = append(fields, field), rest
+			continue
+		}
+		field, rest, _ := strings.Cut(args, " ")
+		fields, args = append(fields, field), rest
+	}
+	return fields
+}
+
+func unquote(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		if end := strings.Index(s[1:], `"`); end >= 0 {
+			return s[1 : end+1]
+		}
+	}
+	return s
+}
@@ -0,0 +1,221 @@
+// Package usage completes the flags of commands, as listed in their man
+// page or printed by their --help.
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devenjarvis/sushi/internal/hint"
+)
+
+// helpTimeout is how long a command can take to print its --help.
+const helpTimeout = 3 * time.Second
+
+// defaultManPath is where man pages are looked for if MANPATH isn't set.
+const defaultManPath = "/usr/local/share/man:/usr/share/man"
+
+// Flag is an option of a command, under one or more names.
+type Flag struct {
+	Names       []string `json:"names"`
+	Description string   `json:"description,omitempty"`
+
+	// Arg is set if the flag takes a value
+	Arg bool `json:"arg,omitempty"`
+}
+
+// entry holds the flags found for a command, and when the command was
+// modified, so they're found again if it changes. NoHelp is set if the
+// command wasn't run with --help when it had no man page.
+type entry struct {
+	ModTime int64  `json:"mtime"`
+	Flags   []Flag `json:"flags"`
+	NoHelp  bool   `json:"nohelp,omitempty"`
+}
+
+// Provider completes the flags of commands, reading them from the man
+// page of a command, or running it with --help if it doesn't have one. The
+// flags found are kept in a file, by the path of the command.
+//
+// Only commands found in the absolute directories of PATH are run with
+// --help, as a script named by its path may well not handle it and do its
+// work instead. Those listed in SUSHI_NO_HELP, separated by colons, aren't
+// run either.
+type Provider struct {
+	path string
+	skip func(name string) bool
+
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]entry
+	// pending holds the commands whose flags are being found, closed when
+	// they are
+	pending map[string]chan struct{}
+}
+
+// New returns a provider keeping the flags found in the file at path. It
+// doesn't complete the commands skip reports, such as those described by
+// spec files.
+func New(path string, skip func(name string) bool) *Provider {
+	return &Provider{
+		path:    path,
+		skip:    skip,
+		entries: make(map[string]entry),
+		pending: make(map[string]chan struct{}),
+	}
+}
+
+// Complete offers the flags of the command when a word starting with - is
+// typed.
+func (p *Provider) Complete(ctx context.Context, line hint.Line) []hint.Candidate {
+	if len(line.Args) == 0 || line.Args[0] == "" || !strings.HasPrefix(line.Typed, "-") {
+		return nil
+	}
+	name := line.Args[0]
+	if p.skip != nil && p.skip(filepath.Base(name)) {
+		return nil
+	}
+	path, inPath := lookPath(name, line.Var("PATH"), line.Dir)
+	if path == "" {
+		return nil
+	}
+	runHelp := inPath && !slices.Contains(filepath.SplitList(line.Var("SUSHI_NO_HELP")), name)
+
+	var candidates []hint.Candidate
+	for _, f := range p.flags(ctx, path, line.Dir, runHelp) {
+		for _, name := range f.Names {
+			if score, ok := hint.Match(line.Typed, name); ok {
+				candidates = append(candidates, hint.Candidate{Text: name, Description: f.Description, Kind: hint.KindFlag, Score: score + hint.ProviderBonus})
+			}
+		}
+	}
+	return candidates
+}
+
+// flags returns the flags of the command at path, running it in dir with
+// --help if runHelp is set and it has no man page. They're found in the
+// background the first time, and again once the command is modified or
+// may be run when it wasn't, waiting for them until ctx is done.
+func (p *Provider) flags(ctx context.Context, path, dir string, runHelp bool) []Flag {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	modTime := info.ModTime().UnixNano()
+
+	p.mu.Lock()
+	p.load()
+	if e, ok := p.entries[path]; ok && e.ModTime == modTime && (!e.NoHelp || !runHelp) {
+		p.mu.Unlock()
+		return e.Flags
+	}
+	done, ok := p.pending[path]
+	if !ok {
+		// Found apart from ctx, so that typing on doesn't stop it
+		done = make(chan struct{})
+		p.pending[path] = done
+		go p.find(path, dir, modTime, runHelp, done)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-done:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.entries[path].Flags
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// find finds the flags of the command at path and saves them.
+func (p *Provider) find(path, dir string, modTime int64, runHelp bool, done chan struct{}) {
+	manpath := os.Getenv("MANPATH")
+	if manpath == "" {
+		manpath = defaultManPath
+	}
+	flags := parseMan(manPage(filepath.Base(path), manpath))
+	noHelp := false
+	if len(flags) == 0 {
+		if runHelp {
+			flags = parseHelp(help(path, dir))
+		} else {
+			noHelp = true
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries[path] = entry{ModTime: modTime, Flags: flags, NoHelp: noHelp}
+	delete(p.pending, path)
+	close(done)
+	p.save()
+}
+
+// help returns what the command at path prints with --help in dir, on its
+// output or its error output.
+func help(path, dir string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), helpTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, "--help")
+	cmd.Dir = dir
+	out, _ := cmd.CombinedOutput()
+	return string(out)
+}
+
+// load reads the flags kept in the file, the first time they're needed.
+func (p *Provider) load() {
+	if p.loaded {
+		return
+	}
+	p.loaded = true
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &p.entries)
+}
+
+// save writes the flags found to the file, through a temporary file so
+// that it's never left half written.
+func (p *Provider) save() {
+	data, err := json.Marshal(p.entries)
+	if err != nil {
+		return
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	os.Rename(tmp, p.path)
+}
+
+// lookPath returns the path of the executable a command name runs, found
+// in the directories of path if it has no slash, and whether it was found
+// in one of them that's absolute.
+func lookPath(name, path, dir string) (string, bool) {
+	if strings.ContainsRune(name, '/') {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		return name, false
+	}
+	for _, d := range filepath.SplitList(path) {
+		abs := filepath.IsAbs(d)
+		if !abs {
+			d = filepath.Join(dir, d)
+		}
+		file := filepath.Join(d, name)
+		if info, err := os.Stat(file); err == nil && !info.IsDir() && info.Mode().Perm()&0111 != 0 {
+			return file, abs
+		}
+	}
+	return "", false
+}
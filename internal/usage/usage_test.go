@@ -0,0 +1,61 @@
+package usage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookPath(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"bin", "local"} {
+		os.Mkdir(filepath.Join(dir, sub), 0o755)
+		os.WriteFile(filepath.Join(dir, sub, "tool-"+sub), nil, 0o755)
+	}
+	os.WriteFile(filepath.Join(dir, "bin", "data"), nil, 0o644)
+	path := filepath.Join(dir, "bin") + ":local"
+
+	tests := []struct {
+		name   string
+		want   string
+		inPath bool
+	}{
+		{"tool-bin", filepath.Join(dir, "bin", "tool-bin"), true},
+		{"tool-local", filepath.Join(dir, "local", "tool-local"), false},
+		{"./bin/tool-bin", filepath.Join(dir, "bin", "tool-bin"), false},
+		{filepath.Join(dir, "bin", "tool-bin"), filepath.Join(dir, "bin", "tool-bin"), false},
+		{"data", "", false},
+		{"missing", "", false},
+	}
+	for _, tt := range tests {
+		got, inPath := lookPath(tt.name, path, dir)
+		if got != tt.want || inPath != tt.inPath {
+			t.Errorf("lookPath(%q) = %q, %v; want %q, %v", tt.name, got, inPath, tt.want, tt.inPath)
+		}
+	}
+}
+
+func TestFlagsRunHelp(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("MANPATH", dir)
+	script := filepath.Join(dir, "script")
+	os.WriteFile(script, []byte("#!/bin/sh\ntouch ran\necho '  -x, --extra   Do more.'\n"), 0o755)
+	ran := filepath.Join(dir, "ran")
+	p := New(filepath.Join(dir, "flags.json"), nil)
+
+	if flags := p.flags(context.Background(), script, dir, false); len(flags) != 0 {
+		t.Errorf("flags without --help = %v, want none", flags)
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Fatal("script ran without runHelp")
+	}
+
+	flags := p.flags(context.Background(), script, dir, true)
+	if len(flags) != 1 || flags[0].Names[1] != "--extra" || flags[0].Description != "Do more" {
+		t.Errorf("flags with --help = %+v, want --extra", flags)
+	}
+	if _, err := os.Stat(ran); err != nil {
+		t.Errorf("script didn't run with --help in its directory: %v", err)
+	}
+}